@@ -19,6 +19,8 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -28,6 +30,8 @@ import (
 
 	airshipv1 "sipcluster/pkg/api/v1"
 	"sipcluster/pkg/controllers"
+	"sipcluster/pkg/services"
+	"sipcluster/pkg/vbmh"
 
 	corev1 "k8s.io/api/core/v1"
 
@@ -57,11 +61,26 @@ func init() {
 
 func main() {
 	var metricsAddr string
+	var powerProxyAddr string
+	var powerProxyCertDir string
 	var enableLeaderElection bool
+	var resyncInterval time.Duration
+	var networkDataKeys string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&powerProxyAddr, "power-proxy-addr", "0",
+		"The address the jump host power proxy binds to. Set to \"0\" to disable the power proxy.")
+	flag.StringVar(&powerProxyCertDir, "power-proxy-cert-dir", "/tmp/k8s-power-proxy/serving-certs",
+		"The directory holding the serving certificate (tls.crt) and key (tls.key) of the jump host power proxy, "+
+			"which is served over TLS only.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&resyncInterval, "resync-interval", 10*time.Minute,
+		"The interval at which SIPClusters are reconciled to restore infrastructure services that drifted from "+
+			"their desired state. Set to 0 to disable periodic reconciliation.")
+	flag.StringVar(&networkDataKeys, "network-data-keys", strings.Join(vbmh.DefaultNetworkDataKeys, ","),
+		"Comma-separated keys of the BMH Network Data secrets that may hold the Network Data, in order of "+
+			"preference. The Network Data may be in the network_data.json, nmstate or netplan format.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
@@ -79,17 +98,46 @@ func main() {
 	}
 
 	if err = (&controllers.SIPClusterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Recorder:        mgr.GetEventRecorderFor("sipcluster-controller"),
+		ResyncInterval:  resyncInterval,
+		NetworkDataKeys: splitList(networkDataKeys),
+		APIReader:       mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SIPCluster")
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
 
+	if powerProxyAddr != "0" {
+		if err = mgr.Add(&services.PowerProxy{
+			Client:   mgr.GetClient(),
+			Recorder: mgr.GetEventRecorderFor("power-proxy"),
+			Log:      ctrl.Log.WithName("power-proxy"),
+			Addr:     powerProxyAddr,
+			CertDir:  powerProxyCertDir,
+		}); err != nil {
+			setupLog.Error(err, "unable to add power proxy")
+			os.Exit(1)
+		}
+	}
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma-separated flag value, ignoring spaces around and empty elements.
+func splitList(value string) []string {
+	var elements []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+
+	return elements
+}
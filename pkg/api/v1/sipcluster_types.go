@@ -17,7 +17,10 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -36,6 +39,12 @@ type SIPClusterList struct {
 
 // SIPCluster is the Schema for the sipclusters API
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name=Ready,type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name=Scheduled,type=string,JSONPath=`.status.conditions[?(@.type=="Scheduled")].status`
+// +kubebuilder:printcolumn:name=LB,type=string,JSONPath=`.status.conditions[?(@.type=="LoadBalancerReady")].status`
+// +kubebuilder:printcolumn:name=JumpHost,type=string,JSONPath=`.status.conditions[?(@.type=="JumpHostReady")].status`
+// +kubebuilder:printcolumn:name=Reason,type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`,priority=1
+// +kubebuilder:printcolumn:name=Age,type=date,JSONPath=`.metadata.creationTimestamp`
 type SIPCluster struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -57,22 +66,46 @@ type SIPClusterSpec struct {
 
 	// Services defines the services that are deployed when a SIPCluster is provisioned.
 	Services SIPClusterServices `json:"services"`
+
+	// ControlPlaneEndpointRef references a Cluster API cluster whose control plane endpoint is kept in sync with the
+	// address of the SIPCluster load balancer.
+	// +optional
+	ControlPlaneEndpointRef *ControlPlaneEndpointRef `json:"controlPlaneEndpointRef,omitempty"`
+}
+
+// ControlPlaneEndpointRef references a Cluster API Cluster or infrastructure cluster, e.g. a Metal3Cluster, whose
+// spec.controlPlaneEndpoint host and port are set from a load balancer frontend.
+type ControlPlaneEndpointRef struct {
+	// APIVersion is the API version of the referenced object, e.g. infrastructure.cluster.x-k8s.io/v1alpha4.
+	APIVersion string `json:"apiVersion"`
+	// Kind is the kind of the referenced object, e.g. Metal3Cluster.
+	Kind string `json:"kind"`
+	// Name is the name of the referenced object.
+	Name string `json:"name"`
+	// Namespace is the namespace of the referenced object. Defaults to the namespace of the SIPCluster.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Frontend is the name of the load balancer frontend providing the control plane endpoint. Defaults to apiserver.
+	// +optional
+	Frontend string `json:"frontend,omitempty"`
 }
 
 // SIPClusterServices defines the services that are deployed when a SIPCluster is provisioned.
 type SIPClusterServices struct {
 	// LoadBalancer defines the sub-cluster load balancer services.
-	LoadBalancer []SIPClusterService `json:"loadBalancer,omitempty"`
+	LoadBalancer []LoadBalancerService `json:"loadBalancer,omitempty"`
 	// Auth defines the sub-cluster authentication services.
 	Auth []SIPClusterService `json:"auth,omitempty"`
 	// JumpHost defines the sub-cluster jump host services.
 	JumpHost []JumpHostService `json:"jumpHost,omitempty"`
+	// Custom defines sub-cluster services of types registered with SIP in addition to the built-in types.
+	Custom []CustomService `json:"custom,omitempty"`
 }
 
 func (s SIPClusterServices) GetAll() []SIPClusterService {
 	all := []SIPClusterService{}
 	for _, s := range s.LoadBalancer {
-		all = append(all, s)
+		all = append(all, s.SIPClusterService)
 	}
 	for _, s := range s.Auth {
 		all = append(all, s)
@@ -80,36 +113,353 @@ func (s SIPClusterServices) GetAll() []SIPClusterService {
 	for _, s := range s.JumpHost {
 		all = append(all, s.SIPClusterService)
 	}
+	for _, s := range s.Custom {
+		all = append(all, s.SIPClusterService)
+	}
 	return all
 }
 
+// CustomService is an infrastructure service of a type registered with SIP, configured by a type-specific
+// configuration.
+type CustomService struct {
+	SIPClusterService `json:",inline"`
+	// Type is the registered type of the service.
+	Type string `json:"type"`
+	// Name distinguishes custom services of the same type, and is part of the names of their objects. Custom services
+	// of the same type must have unique names, so a name is required for all but one of them.
+	// +kubebuilder:validation:MaxLength=20
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Config is the configuration of the service, whose schema is defined by the service type.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Config runtime.RawExtension `json:"config,omitempty"`
+}
+
+// ManifestTemplateConfig is the configuration of manifest-template custom services, which render Go-templated
+// Kubernetes manifests against the hosts scheduled for a SIPCluster and apply them with the infrastructure services.
+type ManifestTemplateConfig struct {
+	// ConfigMap is the ConfigMap in the namespace of the SIPCluster holding the manifest templates. Each key holds a
+	// template of one or more YAML documents.
+	ConfigMap corev1.LocalObjectReference `json:"configMap"`
+}
+
+// DNSConfig is the configuration of dns custom services, which serve a zone resolving the names of the hosts
+// scheduled for a SIPCluster, as well as the names of its load balancer and jump host. Host records resolve to the
+// IP address of each host on the node interface of the service.
+type DNSConfig struct {
+	// Zone is the DNS zone served for the sub-cluster. Defaults to <clusterName>.sip.local.
+	Zone string `json:"zone,omitempty"`
+	// Upstreams are the addresses, as IP or IP:port, of the DNS servers to which queries for names outside the zone
+	// are forwarded. Such queries are refused when no upstreams are specified.
+	Upstreams []string `json:"upstreams,omitempty"`
+	// TTL is the time to live, in seconds, of the zone records. Defaults to 60.
+	TTL int `json:"ttl,omitempty"`
+}
+
+// NTPConfig is the configuration of ntp custom services, which serve time to the hosts of a sub-cluster that cannot
+// reach other NTP servers. The nodeInterfaceId of ntp services is not used: time is served to any client that reaches
+// the service, not only to the hosts of the sub-cluster.
+type NTPConfig struct {
+	// Upstreams are the hostnames or IP addresses of the NTP servers the service synchronizes with. The service
+	// keeps serving time at stratum 10 when they are unreachable, and only serves the clock of the base cluster node
+	// it runs on when no upstreams are specified.
+	Upstreams []string `json:"upstreams,omitempty"`
+}
+
+// RegistryMirrorConfig is the configuration of registry-mirror custom services, which cache the images pulled by a
+// sub-cluster from upstream registries.
+type RegistryMirrorConfig struct {
+	// Upstreams are the registries mirrored by the service, each on its own port. At least one is required.
+	Upstreams []RegistryUpstream `json:"upstreams"`
+	// Storage is the persistent storage of the cached images.
+	Storage RegistryStorage `json:"storage,omitempty"`
+	// TLSSecretRef references a Secret, in the SIPCluster namespace, containing the serving certificate of the mirror.
+	// The Secret must contain the keys tls.crt and tls.key. The mirror is served over plain HTTP when no Secret is
+	// referenced.
+	TLSSecretRef *corev1.LocalObjectReference `json:"tlsSecretRef,omitempty"`
+}
+
+// RegistryUpstream is a registry mirrored by a registry-mirror service.
+type RegistryUpstream struct {
+	// Name identifies the mirror of the upstream, and is the name of its port in the status endpoints.
+	Name string `json:"name"`
+	// URL is the URL of the upstream registry, such as https://registry-1.docker.io.
+	URL string `json:"url"`
+	// NodePort is the node port on which the mirror of the upstream is exposed. Mirrors are only exposed on a cluster
+	// IP when no upstream specifies a node port.
+	NodePort int `json:"nodePort,omitempty"`
+}
+
+// RegistryStorage is the persistent storage of a registry-mirror service.
+type RegistryStorage struct {
+	// Size is the requested size of the PersistentVolumeClaim. Defaults to 10Gi.
+	Size *resource.Quantity `json:"size,omitempty"`
+	// StorageClassName is the StorageClass of the PersistentVolumeClaim. The default StorageClass of the base cluster
+	// is used when none is specified.
+	StorageClassName *string `json:"storageClassName,omitempty"`
+}
+
+// LoadBalancerService is an infrastructure service type that represents the sub-cluster load balancer service.
+type LoadBalancerService struct {
+	SIPClusterService `json:",inline"`
+	// Frontends defines the ports exposed by the load balancer and the sub-cluster VMs they are forwarded to. When
+	// no frontends are specified, the load balancer fronts the Kubernetes API server of the control plane VMs on
+	// port 6443, exposed on the nodePort of the load balancer. The nodePort of the load balancer cannot be combined
+	// with frontends, which define their own node ports. Frontend names must be valid port names other than stats
+	// and metrics, which are reserved, and frontends cannot listen on the metrics port.
+	Frontends []LoadBalancerFrontend `json:"frontends,omitempty"`
+	// Template references a key of a ConfigMap, in the namespace of the SIPCluster, holding a Go template used
+	// instead of the default HAProxy configuration. The template is rendered with the load balancer frontends and
+	// their backends, as well as the SIPCluster metadata. The Bind field of each frontend and of the metrics holds
+	// the address and options to bind it with: the virtual IP when one is configured, and otherwise the IPv6
+	// wildcard address when the ipFamily is IPv6 or DualStack. Changes to the ConfigMap are applied to the load
+	// balancer as soon as they are observed.
+	Template *corev1.ConfigMapKeySelector `json:"template,omitempty"`
+	// Replicas is the number of load balancer replicas. Replicas are spread across base cluster nodes and protected
+	// by a PodDisruptionBudget when more than one replica is requested. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	Replicas *int32 `json:"replicas,omitempty"`
+	// VirtualIP enables a keepalived VRRP sidecar that assigns a floating virtual IP to the base cluster node of one
+	// of the load balancer replicas. Load balancer pods use the host network when a virtual IP is configured.
+	VirtualIP *VirtualIPOpts `json:"virtualIP,omitempty"`
+	// Metrics enables the HAProxy statistics and Prometheus exporter frontend, a metrics Service and a
+	// ServiceMonitor. The state of each backend server is reported in the SIPCluster status.
+	Metrics *LoadBalancerMetrics `json:"metrics,omitempty"`
+}
+
+// LoadBalancerMetrics contains options for the load balancer statistics and metrics frontend.
+type LoadBalancerMetrics struct {
+	// Port is the port of the statistics and metrics frontend. Defaults to 8405.
+	Port int `json:"port,omitempty"`
+	// ServiceMonitorLabels are additional labels of the ServiceMonitor, e.g. to match the ServiceMonitor selector
+	// of a Prometheus instance.
+	ServiceMonitorLabels map[string]string `json:"serviceMonitorLabels,omitempty"`
+}
+
+// VirtualIPOpts contains options for the keepalived VRRP virtual IP of a load balancer. A load balancer with a virtual
+// IP uses the host network of the base cluster nodes, and its frontends, including the metrics frontend, bind only the
+// virtual IP. Its container ports are host ports on the host network, so load balancers of SIPClusters that use the
+// same frontend or metrics ports are not scheduled on the same node.
+type VirtualIPOpts struct {
+	// Address is the virtual IP address. Required unless addressPool is set.
+	// +optional
+	Address string `json:"address,omitempty"`
+	// AddressPool allocates the virtual IP address from an IP pool when address is not set. The allocated address is
+	// recorded in the SIPCluster status.
+	// +optional
+	AddressPool *IPPoolReference `json:"addressPool,omitempty"`
+	// Interface is the base cluster node network interface the virtual IP is assigned to.
+	Interface string `json:"interface"`
+	// VirtualRouterID is the VRRP virtual router ID, which must be unique on the network. Defaults to 51.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=255
+	VirtualRouterID int `json:"virtualRouterID,omitempty"`
+	// Image is the keepalived image.
+	Image string `json:"image,omitempty"`
+}
+
+// LoadBalancerFrontend defines a port exposed by the load balancer and the backends it forwards traffic to.
+type LoadBalancerFrontend struct {
+	// Name identifies the frontend. It is also used as the name of the load balancer Service port.
+	// +kubebuilder:validation:MaxLength=15
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// FrontendPort is the port the load balancer listens on.
+	FrontendPort int `json:"frontendPort"`
+	// BackendPort is the port of the backend VMs that traffic is forwarded to.
+	BackendPort int `json:"backendPort"`
+	// Mode is the proxy mode of the frontend. Defaults to tcp.
+	Mode LoadBalancerMode `json:"mode,omitempty"`
+	// HealthCheck defines how the backends are checked. Backends are checked with a TCP connection when no health
+	// check is specified.
+	HealthCheck *LoadBalancerHealthCheck `json:"healthCheck,omitempty"`
+	// TargetRole is the role of the VMs used as backends.
+	TargetRole VMRole `json:"targetRole"`
+	// NodePort is the node port of the load balancer Service for this frontend. A node port is allocated when none
+	// is specified.
+	NodePort int `json:"nodePort,omitempty"`
+}
+
+// LoadBalancerMode is the proxy mode of a load balancer frontend.
+// +kubebuilder:validation:Enum=tcp;http
+type LoadBalancerMode string
+
+const (
+	// LoadBalancerModeTCP proxies TCP connections.
+	LoadBalancerModeTCP LoadBalancerMode = "tcp"
+
+	// LoadBalancerModeHTTP proxies HTTP requests.
+	LoadBalancerModeHTTP LoadBalancerMode = "http"
+)
+
+// LoadBalancerHealthCheck defines how the load balancer checks the health of the backends of a frontend.
+type LoadBalancerHealthCheck struct {
+	// HTTPPath is the path of an HTTP GET request used to check backends. Backends must respond with status 200.
+	// Backends are checked with a TCP connection when no path is specified.
+	HTTPPath string `json:"httpPath,omitempty"`
+	// SSL enables TLS for health checks. Server certificates are not verified.
+	SSL bool `json:"ssl,omitempty"`
+}
+
 // JumpHostService is an infrastructure service type that represents the sub-cluster jump-host service.
 type JumpHostService struct {
 	SIPClusterService `json:"inline"`
-	BMC               *BMCOpts `json:"bmc,omitempty"`
-	SSHKey            string   `json:"sshkey,omitempty"`
+	BMC               *BMCOpts     `json:"bmc,omitempty"`
+	SSHKey            string       `json:"sshkey,omitempty"`
+	Libvirt           *LibvirtOpts `json:"libvirt,omitempty"`
+	// SessionLogging enables the jump host audit log. When enabled, SSH session logins and logouts and every power
+	// action performed with the jump host utilities are written to the output of the jump host audit container as
+	// JSON records. Power actions are also recorded as Events of the SIPCluster, by the power proxy when it is
+	// configured and by the audit container otherwise.
+	SessionLogging bool `json:"sessionLogging,omitempty"`
 }
 
 // SIPClusterStatus defines the observed state of SIPCluster
 type SIPClusterStatus struct {
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// LoadBalancers reports the state of the backend servers of load balancers with metrics enabled.
+	LoadBalancers []LoadBalancerStatus `json:"loadBalancers,omitempty"`
+	// Endpoints are the addresses of the deployed infrastructure services.
+	Endpoints []ServiceEndpoint `json:"endpoints,omitempty"`
+	// IPAllocations are the cluster IPs and virtual IPs of the infrastructure services, whether allocated from an IP
+	// pool or specified. They are released when the SIPCluster is deleted or no longer uses them.
+	IPAllocations []IPAllocation `json:"ipAllocations,omitempty"`
+}
+
+// IPAllocation is an address used by an infrastructure service.
+type IPAllocation struct {
+	// Service is the instance name of the infrastructure service, which is the name of its objects, e.g.
+	// loadbalancer-<SIPCluster name>.
+	Service string `json:"service"`
+	// Type is the use of the address by the service.
+	Type IPAllocationType `json:"type"`
+	// Address is the IP address.
+	Address string `json:"address"`
+	// Pool is the IP pool the address is allocated from, as <namespace>/<name>. Addresses specified in the
+	// SIPCluster spec have no pool.
+	// +optional
+	Pool string `json:"pool,omitempty"`
+}
+
+// IPAllocationType is the use of an address allocated to an infrastructure service.
+// +kubebuilder:validation:Enum=ClusterIP;VirtualIP
+type IPAllocationType string
+
+const (
+	// IPAllocationClusterIP is the cluster IP of the Service of an infrastructure service.
+	IPAllocationClusterIP IPAllocationType = "ClusterIP"
+	// IPAllocationVirtualIP is the virtual IP of a load balancer.
+	IPAllocationVirtualIP IPAllocationType = "VirtualIP"
+)
+
+// ServiceEndpoint is the address of a port exposed by an infrastructure service.
+type ServiceEndpoint struct {
+	// Service is the name of the infrastructure service instance, e.g. loadbalancer-<SIPCluster name>.
+	Service string `json:"service"`
+	// Name is the name of the exposed port, e.g. the name of a load balancer frontend, or ssh for jump hosts.
+	Name string `json:"name"`
+	// Addresses are the host:port addresses of the endpoint, in order of preference: the load balancer virtual IP,
+	// the node port on each base cluster node, and the cluster IP of the Service.
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// LoadBalancerStatus is the observed state of a load balancer infrastructure service.
+type LoadBalancerStatus struct {
+	// Name is the name of the load balancer instance.
+	Name string `json:"name"`
+	// Backends is the state of each backend server, as reported by HAProxy. With several replicas, the state is
+	// that seen by the single replica that served the statistics.
+	Backends []LoadBalancerBackendStatus `json:"backends,omitempty"`
+	// LastUpdateTime is the time the backend states were retrieved.
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// LoadBalancerBackendStatus is the observed state of a load balancer backend server.
+type LoadBalancerBackendStatus struct {
+	// Backend is the name of the HAProxy backend.
+	Backend string `json:"backend"`
+	// Server is the name of the backend server, which is the name of the BareMetalHost.
+	Server string `json:"server"`
+	// State is the HAProxy check state of the server, e.g. UP, DOWN or MAINT.
+	State string `json:"state"`
 }
 
 const (
 	// ConditionTypeReady indicates whether a resource is available for utilization
 	ConditionTypeReady string = "Ready"
 
+	// ConditionTypeLoadBalancerReady indicates whether the load balancer services of a SIPCluster are ready.
+	ConditionTypeLoadBalancerReady string = "LoadBalancerReady"
+
+	// ConditionTypeJumpHostReady indicates whether the jump host services of a SIPCluster are ready.
+	ConditionTypeJumpHostReady string = "JumpHostReady"
+
+	// ConditionTypeAuthReady indicates whether the authentication services of a SIPCluster are ready.
+	ConditionTypeAuthReady string = "AuthReady"
+
+	// ConditionTypeScheduled indicates whether vBMHs have been scheduled for a SIPCluster.
+	ConditionTypeScheduled string = "Scheduled"
+
+	// ConditionTypeControlPlaneEndpointUpdated indicates whether the control plane endpoint of the Cluster API
+	// cluster referenced by a SIPCluster matches the address of its load balancer.
+	ConditionTypeControlPlaneEndpointUpdated string = "ControlPlaneEndpointUpdated"
+
+	// ConditionTypeMachineTemplatesUpdated indicates whether the hostSelectors of the Metal3MachineTemplates
+	// referenced by a SIPCluster match the vBMHs scheduled for it.
+	ConditionTypeMachineTemplatesUpdated string = "MachineTemplatesUpdated"
+
+	// ConditionTypeLabeled indicates whether the vBMHs scheduled for a SIPCluster have been labeled.
+	ConditionTypeLabeled string = "Labeled"
+
 	// ReasonTypeInfraServiceFailure indicates that a resource has a specified condition because SIP was unable
 	// to configure infrastructure services for the SIPCluster.
 	ReasonTypeInfraServiceFailure string = "InfraServiceFailure"
 
+	// ReasonTypeInvalidLoadBalancerTemplate indicates that a resource has a specified condition because the template
+	// referenced by a load balancer is missing or cannot be rendered.
+	ReasonTypeInvalidLoadBalancerTemplate string = "InvalidLoadBalancerTemplate"
+
+	// ReasonTypeControlPlaneEndpointUpdated indicates that a resource has a specified condition because SIP set the
+	// control plane endpoint of the referenced Cluster API cluster.
+	ReasonTypeControlPlaneEndpointUpdated string = "ControlPlaneEndpointUpdated"
+
+	// ReasonTypeInfraServiceNotReady indicates that a resource has a specified condition because infrastructure
+	// services of the SIPCluster are deployed but not yet ready.
+	ReasonTypeInfraServiceNotReady string = "InfraServiceNotReady"
+
+	// ReasonTypeInfraServiceReady indicates that a resource has a specified condition because infrastructure
+	// services of the SIPCluster are ready.
+	ReasonTypeInfraServiceReady string = "InfraServiceReady"
+
+	// ReasonTypeLabelsApplied indicates that a resource has a specified condition because SIP applied labels to the
+	// vBMHs of the SIPCluster.
+	ReasonTypeLabelsApplied string = "LabelsApplied"
+
+	// ReasonTypeMachineTemplatesUpdated indicates that a resource has a specified condition because SIP set the
+	// hostSelectors of the referenced Metal3MachineTemplates.
+	ReasonTypeMachineTemplatesUpdated string = "MachineTemplatesUpdated"
+
 	// ReasonTypeProgressing indicates that a resource has a specified condition because SIP is processing it.
 	ReasonTypeProgressing string = "Progressing"
 
+	// ReasonTypeUnableToAllocateIPs indicates that a resource has a specified condition because SIP was unable to
+	// allocate the IP addresses of its infrastructure services.
+	ReasonTypeUnableToAllocateIPs string = "UnableToAllocateIPs"
+
 	// ReasonTypeUnableToApplyLabels indicates that a resource has a specified condition because SIP was unable to
 	// apply labels to vBMHs for the SIPCluster.
 	ReasonTypeUnableToApplyLabels string = "UnableToApplyLabels"
 
+	// ReasonTypeUnableToUpdateControlPlaneEndpoint indicates that a resource has a specified condition because SIP was
+	// unable to set the control plane endpoint of the referenced Cluster API cluster.
+	ReasonTypeUnableToUpdateControlPlaneEndpoint string = "UnableToUpdateControlPlaneEndpoint"
+
+	// ReasonTypeUnableToUpdateMachineTemplates indicates that a resource has a specified condition because SIP was
+	// unable to generate or patch the referenced Metal3MachineTemplates.
+	ReasonTypeUnableToUpdateMachineTemplates string = "UnableToUpdateMachineTemplates"
+
 	// ReasonTypeUnableToDecommission indicates that a resource has a specified condition because SIP was unable to
 	// decommission the existing SIPCluster.
 	ReasonTypeUnableToDecommission string = "UnableToDecommission"
@@ -118,6 +468,10 @@ const (
 	// schedule vBMHs for the SIPCluster.
 	ReasonTypeUnschedulable string = "Unschedulable"
 
+	// ReasonTypeScheduled indicates that a resource has a specified condition because SIP scheduled vBMHs for the
+	// SIPCluster.
+	ReasonTypeScheduled string = "Scheduled"
+
 	// ReasonTypeReconciliationSucceeded indicates that a resource has a specified condition because SIP completed
 	// reconciliation of the SIPCluster.
 	ReasonTypeReconciliationSucceeded string = "ReconciliationSucceeded"
@@ -145,6 +499,41 @@ type NodeSet struct {
 	Scheduling SpreadTopology `json:"spreadTopology,omitempty"`
 	// Count defines the scale expectations for the Nodes
 	Count *VMCount `json:"count,omitempty"`
+	// MachineTemplate identifies a Metal3MachineTemplate whose hostSelector is set to match exactly the BMHs
+	// scheduled for the node set, so that Cluster API only claims those hosts for the VM role.
+	// +optional
+	MachineTemplate *MachineTemplateOpts `json:"machineTemplate,omitempty"`
+}
+
+// MachineTemplateOpts identifies a Metal3MachineTemplate generated or patched by SIP.
+type MachineTemplateOpts struct {
+	// APIVersion is the API version of the Metal3MachineTemplate. Defaults to
+	// infrastructure.cluster.x-k8s.io/v1alpha4.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Name is the name of the Metal3MachineTemplate.
+	Name string `json:"name"`
+	// Namespace is the namespace of the Metal3MachineTemplate. Defaults to the namespace of the SIPCluster.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Image is the image provisioned on the hosts. When set, the Metal3MachineTemplate is created if it does not
+	// exist; otherwise only the hostSelector of an existing Metal3MachineTemplate is patched.
+	// +optional
+	Image *MachineImage `json:"image,omitempty"`
+}
+
+// MachineImage is the image provisioned on the hosts claimed through a Metal3MachineTemplate.
+type MachineImage struct {
+	// URL is the location of the image.
+	URL string `json:"url"`
+	// Checksum is the location of the checksum of the image.
+	Checksum string `json:"checksum"`
+	// ChecksumType is the checksum algorithm, e.g. md5, sha256 or sha512.
+	// +optional
+	ChecksumType string `json:"checksumType,omitempty"`
+	// DiskFormat is the format of the image, e.g. raw or qcow2.
+	// +optional
+	DiskFormat string `json:"format,omitempty"`
 }
 
 // +kubebuilder:validation:Enum=PerRack;PerHost
@@ -164,11 +553,89 @@ type SIPClusterService struct {
 	NodePort      int               `json:"nodePort,omitempty"`
 	NodeInterface string            `json:"nodeInterfaceId,omitempty"`
 	ClusterIP     *string           `json:"clusterIP,omitempty"`
+	// ClusterIPPool allocates the cluster IP of the service from an IP pool when clusterIP is not set. The allocated
+	// address is recorded in the SIPCluster status.
+	// +optional
+	ClusterIPPool *IPPoolReference `json:"clusterIPPool,omitempty"`
+	// IPFamily selects the addresses of the hosts used by the service. By default, the addresses of the hosts on the
+	// node interface network are used. IPv4 and IPv6 select the addresses of that family on the link of the node
+	// interface network, so that the IPv4 and IPv6 networks of a link can be used through either of them. DualStack
+	// selects the addresses of both families. Hosts without addresses of the selected families are not scheduled.
+	// +optional
+	IPFamily IPFamily `json:"ipFamily,omitempty"`
+	// NodeInterfaceSelector selects the node interface network of the hosts by alternate keys, for sites whose
+	// network IDs differ from nodeInterfaceId, such as sites with nmstate or netplan Network Data, whose network IDs
+	// are derived from the link and network type, e.g. bond0.41-ipv4. The host label
+	// network.sip.airshipit.org/<nodeInterfaceId>, whose value is the network ID on the host, takes precedence over
+	// this selector. Hosts without the label use the first network matching this selector or, when no selector is
+	// set, the network whose ID is nodeInterfaceId. The resolved address is available to the service under
+	// nodeInterfaceId.
+	// +optional
+	NodeInterfaceSelector *NodeInterfaceSelector `json:"nodeInterfaceSelector,omitempty"`
 }
 
+// IPPoolReference references an IP pool: a ConfigMap whose cidrs key lists the CIDRs of the addresses allocated to
+// infrastructure services, separated by whitespace. The network and broadcast addresses of IPv4 CIDRs are not
+// allocated. An address is allocated to a single SIPCluster, including addresses specified rather than allocated.
+type IPPoolReference struct {
+	// Name is the name of the ConfigMap.
+	Name string `json:"name"`
+	// Namespace is the namespace of the ConfigMap. Defaults to the namespace of the SIPCluster.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// NodeInterfaceSelector selects the first network of the Network Data of a host that matches all of its keys.
+type NodeInterfaceSelector struct {
+	// LinkName is the name, or ID when it has no name, of the link of the network, e.g. bond0.41.
+	// +optional
+	LinkName string `json:"linkName,omitempty"`
+	// VLANID is the VLAN ID of the link of the network.
+	// +optional
+	VLANID *int `json:"vlanID,omitempty"`
+	// NetworkType is the type of the network, e.g. ipv4 or ipv6.
+	// +optional
+	NetworkType string `json:"networkType,omitempty"`
+}
+
+// IPFamily selects the address families of the hosts used by an infrastructure service.
+// +kubebuilder:validation:Enum=IPv4;IPv6;DualStack
+type IPFamily string
+
+const (
+	// IPFamilyIPv4 selects the IPv4 addresses of the hosts.
+	IPFamilyIPv4 IPFamily = "IPv4"
+	// IPFamilyIPv6 selects the IPv6 addresses of the hosts.
+	IPFamilyIPv6 IPFamily = "IPv6"
+	// IPFamilyDualStack selects both the IPv4 and IPv6 addresses of the hosts.
+	IPFamilyDualStack IPFamily = "DualStack"
+)
+
 // BMCOpts contains options for BMC communication.
 type BMCOpts struct {
 	Proxy bool `json:"proxy,omitempty"`
+	// PowerProxyURL is the URL of the SIP power proxy, as reachable from the jump host. When set, BMC credentials are
+	// not provided to the jump host. Power actions are instead sent to the SIP power proxy, which reads the
+	// credentials of each BareMetalHost from its BMC credentials Secret and records every action in its audit log.
+	// The URL must use https.
+	PowerProxyURL string `json:"powerProxyURL,omitempty"`
+	// PowerProxyCABundle is the PEM-encoded CA certificates used by the jump host to verify the serving certificate
+	// of the SIP power proxy. Defaults to the CA certificates of the jump host image.
+	// +optional
+	PowerProxyCABundle string `json:"powerProxyCABundle,omitempty"`
+}
+
+// LibvirtOpts contains options for accessing the libvirt consoles of sub-cluster VMs from the jump host.
+type LibvirtOpts struct {
+	// TLSSecretRef references a Secret, in the SIPCluster namespace, containing the libvirt TLS client
+	// certificates. The Secret must contain the keys cacert.pem, clientcert.pem, and clientkey.pem.
+	TLSSecretRef corev1.LocalObjectReference `json:"tlsSecretRef"`
+	// Hypervisors maps the name of each BareMetalHost to the address of the hypervisor running its VM. Only
+	// BareMetalHosts scheduled to the SIPCluster are made available on the jump host.
+	Hypervisors map[string]string `json:"hypervisors,omitempty"`
+	// ConsoleLogPool is the libvirt storage pool on each hypervisor that holds VM console logs. Each log is
+	// expected to be a volume named <vm>.log. Defaults to "console-logs".
+	ConsoleLogPool string `json:"consoleLogPool,omitempty"`
 }
 
 // VMRole defines the states the provisioner will report
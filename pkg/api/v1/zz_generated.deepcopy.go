@@ -21,8 +21,9 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -40,6 +41,88 @@ func (in *BMCOpts) DeepCopy() *BMCOpts {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControlPlaneEndpointRef) DeepCopyInto(out *ControlPlaneEndpointRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControlPlaneEndpointRef.
+func (in *ControlPlaneEndpointRef) DeepCopy() *ControlPlaneEndpointRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ControlPlaneEndpointRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomService) DeepCopyInto(out *CustomService) {
+	*out = *in
+	in.SIPClusterService.DeepCopyInto(&out.SIPClusterService)
+	in.Config.DeepCopyInto(&out.Config)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomService.
+func (in *CustomService) DeepCopy() *CustomService {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomService)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSConfig) DeepCopyInto(out *DNSConfig) {
+	*out = *in
+	if in.Upstreams != nil {
+		in, out := &in.Upstreams, &out.Upstreams
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSConfig.
+func (in *DNSConfig) DeepCopy() *DNSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAllocation) DeepCopyInto(out *IPAllocation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAllocation.
+func (in *IPAllocation) DeepCopy() *IPAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPPoolReference) DeepCopyInto(out *IPPoolReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPPoolReference.
+func (in *IPPoolReference) DeepCopy() *IPPoolReference {
+	if in == nil {
+		return nil
+	}
+	out := new(IPPoolReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *JumpHostService) DeepCopyInto(out *JumpHostService) {
 	*out = *in
@@ -49,6 +132,11 @@ func (in *JumpHostService) DeepCopyInto(out *JumpHostService) {
 		*out = new(BMCOpts)
 		**out = **in
 	}
+	if in.Libvirt != nil {
+		in, out := &in.Libvirt, &out.Libvirt
+		*out = new(LibvirtOpts)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JumpHostService.
@@ -61,6 +149,256 @@ func (in *JumpHostService) DeepCopy() *JumpHostService {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LibvirtOpts) DeepCopyInto(out *LibvirtOpts) {
+	*out = *in
+	out.TLSSecretRef = in.TLSSecretRef
+	if in.Hypervisors != nil {
+		in, out := &in.Hypervisors, &out.Hypervisors
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LibvirtOpts.
+func (in *LibvirtOpts) DeepCopy() *LibvirtOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(LibvirtOpts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerBackendStatus) DeepCopyInto(out *LoadBalancerBackendStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerBackendStatus.
+func (in *LoadBalancerBackendStatus) DeepCopy() *LoadBalancerBackendStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerBackendStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerFrontend) DeepCopyInto(out *LoadBalancerFrontend) {
+	*out = *in
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(LoadBalancerHealthCheck)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerFrontend.
+func (in *LoadBalancerFrontend) DeepCopy() *LoadBalancerFrontend {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerFrontend)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerHealthCheck) DeepCopyInto(out *LoadBalancerHealthCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerHealthCheck.
+func (in *LoadBalancerHealthCheck) DeepCopy() *LoadBalancerHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerMetrics) DeepCopyInto(out *LoadBalancerMetrics) {
+	*out = *in
+	if in.ServiceMonitorLabels != nil {
+		in, out := &in.ServiceMonitorLabels, &out.ServiceMonitorLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerMetrics.
+func (in *LoadBalancerMetrics) DeepCopy() *LoadBalancerMetrics {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerMetrics)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerService) DeepCopyInto(out *LoadBalancerService) {
+	*out = *in
+	in.SIPClusterService.DeepCopyInto(&out.SIPClusterService)
+	if in.Frontends != nil {
+		in, out := &in.Frontends, &out.Frontends
+		*out = make([]LoadBalancerFrontend, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.VirtualIP != nil {
+		in, out := &in.VirtualIP, &out.VirtualIP
+		*out = new(VirtualIPOpts)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = new(LoadBalancerMetrics)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerService.
+func (in *LoadBalancerService) DeepCopy() *LoadBalancerService {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerService)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerStatus) DeepCopyInto(out *LoadBalancerStatus) {
+	*out = *in
+	if in.Backends != nil {
+		in, out := &in.Backends, &out.Backends
+		*out = make([]LoadBalancerBackendStatus, len(*in))
+		copy(*out, *in)
+	}
+	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerStatus.
+func (in *LoadBalancerStatus) DeepCopy() *LoadBalancerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachineImage) DeepCopyInto(out *MachineImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineImage.
+func (in *MachineImage) DeepCopy() *MachineImage {
+	if in == nil {
+		return nil
+	}
+	out := new(MachineImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachineTemplateOpts) DeepCopyInto(out *MachineTemplateOpts) {
+	*out = *in
+	if in.Image != nil {
+		in, out := &in.Image, &out.Image
+		*out = new(MachineImage)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineTemplateOpts.
+func (in *MachineTemplateOpts) DeepCopy() *MachineTemplateOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(MachineTemplateOpts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManifestTemplateConfig) DeepCopyInto(out *ManifestTemplateConfig) {
+	*out = *in
+	out.ConfigMap = in.ConfigMap
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManifestTemplateConfig.
+func (in *ManifestTemplateConfig) DeepCopy() *ManifestTemplateConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ManifestTemplateConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NTPConfig) DeepCopyInto(out *NTPConfig) {
+	*out = *in
+	if in.Upstreams != nil {
+		in, out := &in.Upstreams, &out.Upstreams
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NTPConfig.
+func (in *NTPConfig) DeepCopy() *NTPConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(NTPConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeInterfaceSelector) DeepCopyInto(out *NodeInterfaceSelector) {
+	*out = *in
+	if in.VLANID != nil {
+		in, out := &in.VLANID, &out.VLANID
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeInterfaceSelector.
+func (in *NodeInterfaceSelector) DeepCopy() *NodeInterfaceSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeInterfaceSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeSet) DeepCopyInto(out *NodeSet) {
 	*out = *in
@@ -69,6 +407,11 @@ func (in *NodeSet) DeepCopyInto(out *NodeSet) {
 		*out = new(VMCount)
 		**out = **in
 	}
+	if in.MachineTemplate != nil {
+		in, out := &in.MachineTemplate, &out.MachineTemplate
+		*out = new(MachineTemplateOpts)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeSet.
@@ -81,6 +424,72 @@ func (in *NodeSet) DeepCopy() *NodeSet {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryMirrorConfig) DeepCopyInto(out *RegistryMirrorConfig) {
+	*out = *in
+	if in.Upstreams != nil {
+		in, out := &in.Upstreams, &out.Upstreams
+		*out = make([]RegistryUpstream, len(*in))
+		copy(*out, *in)
+	}
+	in.Storage.DeepCopyInto(&out.Storage)
+	if in.TLSSecretRef != nil {
+		in, out := &in.TLSSecretRef, &out.TLSSecretRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryMirrorConfig.
+func (in *RegistryMirrorConfig) DeepCopy() *RegistryMirrorConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistryMirrorConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryStorage) DeepCopyInto(out *RegistryStorage) {
+	*out = *in
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryStorage.
+func (in *RegistryStorage) DeepCopy() *RegistryStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistryStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryUpstream) DeepCopyInto(out *RegistryUpstream) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryUpstream.
+func (in *RegistryUpstream) DeepCopy() *RegistryUpstream {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistryUpstream)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SIPCluster) DeepCopyInto(out *SIPCluster) {
 	*out = *in
@@ -155,6 +564,16 @@ func (in *SIPClusterService) DeepCopyInto(out *SIPClusterService) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.ClusterIPPool != nil {
+		in, out := &in.ClusterIPPool, &out.ClusterIPPool
+		*out = new(IPPoolReference)
+		**out = **in
+	}
+	if in.NodeInterfaceSelector != nil {
+		in, out := &in.NodeInterfaceSelector, &out.NodeInterfaceSelector
+		*out = new(NodeInterfaceSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SIPClusterService.
@@ -172,7 +591,7 @@ func (in *SIPClusterServices) DeepCopyInto(out *SIPClusterServices) {
 	*out = *in
 	if in.LoadBalancer != nil {
 		in, out := &in.LoadBalancer, &out.LoadBalancer
-		*out = make([]SIPClusterService, len(*in))
+		*out = make([]LoadBalancerService, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -191,6 +610,13 @@ func (in *SIPClusterServices) DeepCopyInto(out *SIPClusterServices) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Custom != nil {
+		in, out := &in.Custom, &out.Custom
+		*out = make([]CustomService, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SIPClusterServices.
@@ -214,6 +640,11 @@ func (in *SIPClusterSpec) DeepCopyInto(out *SIPClusterSpec) {
 		}
 	}
 	in.Services.DeepCopyInto(&out.Services)
+	if in.ControlPlaneEndpointRef != nil {
+		in, out := &in.ControlPlaneEndpointRef, &out.ControlPlaneEndpointRef
+		*out = new(ControlPlaneEndpointRef)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SIPClusterSpec.
@@ -236,6 +667,25 @@ func (in *SIPClusterStatus) DeepCopyInto(out *SIPClusterStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.LoadBalancers != nil {
+		in, out := &in.LoadBalancers, &out.LoadBalancers
+		*out = make([]LoadBalancerStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]ServiceEndpoint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.IPAllocations != nil {
+		in, out := &in.IPAllocations, &out.IPAllocations
+		*out = make([]IPAllocation, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SIPClusterStatus.
@@ -248,6 +698,26 @@ func (in *SIPClusterStatus) DeepCopy() *SIPClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceEndpoint) DeepCopyInto(out *ServiceEndpoint) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceEndpoint.
+func (in *ServiceEndpoint) DeepCopy() *ServiceEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VMCount) DeepCopyInto(out *VMCount) {
 	*out = *in
@@ -262,3 +732,23 @@ func (in *VMCount) DeepCopy() *VMCount {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualIPOpts) DeepCopyInto(out *VirtualIPOpts) {
+	*out = *in
+	if in.AddressPool != nil {
+		in, out := &in.AddressPool, &out.AddressPool
+		*out = new(IPPoolReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualIPOpts.
+func (in *VirtualIPOpts) DeepCopy() *VirtualIPOpts {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualIPOpts)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,47 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package bmc
+
+import (
+	"fmt"
+)
+
+// ErrUnsupportedBMCAddress occurs when a BMC address does not use a supported management protocol.
+type ErrUnsupportedBMCAddress struct {
+	Address string
+}
+
+func (e ErrUnsupportedBMCAddress) Error() string {
+	return fmt.Sprintf("unsupported BMC address %s. Only Redfish BMCs are supported", e.Address)
+}
+
+// ErrUnsupportedPowerAction occurs when an unknown power action is requested.
+type ErrUnsupportedPowerAction struct {
+	Action PowerAction
+}
+
+func (e ErrUnsupportedPowerAction) Error() string {
+	return fmt.Sprintf("unsupported power action '%s'", e.Action)
+}
+
+// ErrRedfishRequestFailed occurs when a BMC responds to a Redfish request with an unsuccessful status code.
+type ErrRedfishRequestFailed struct {
+	Address    string
+	StatusCode int
+}
+
+func (e ErrRedfishRequestFailed) Error() string {
+	return fmt.Sprintf("redfish request to BMC %s failed with status %d", e.Address, e.StatusCode)
+}
@@ -0,0 +1,75 @@
+package bmc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"sipcluster/pkg/bmc"
+)
+
+var _ = Describe("Redfish power management", func() {
+	var server *httptest.Server
+	var requests []*http.Request
+	var resetTypes []string
+
+	BeforeEach(func() {
+		requests = nil
+		resetTypes = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body := map[string]string{}
+			Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+			requests = append(requests, r)
+			resetTypes = append(resetTypes, body["ResetType"])
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Should send a reset request to the Redfish system", func() {
+		address := "redfish+" + server.URL + "/redfish/v1/Systems/System.Embedded.1"
+		creds := bmc.Credentials{Username: "root", Password: "password"}
+		Expect(bmc.Power(context.Background(), address, creds, false, bmc.Reboot)).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Method).To(Equal(http.MethodPost))
+		Expect(requests[0].URL.Path).To(Equal("/redfish/v1/Systems/System.Embedded.1/Actions/ComputerSystem.Reset"))
+		username, password, ok := requests[0].BasicAuth()
+		Expect(ok).To(BeTrue())
+		Expect(username).To(Equal(creds.Username))
+		Expect(password).To(Equal(creds.Password))
+		Expect(resetTypes).To(Equal([]string{"GracefulRestart"}))
+	})
+
+	It("Should report unsuccessful responses from the BMC", func() {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+
+		address := "redfish+" + server.URL + "/redfish/v1/Systems/1"
+		err := bmc.Power(context.Background(), address, bmc.Credentials{}, false, bmc.PowerOn)
+		Expect(err).To(Equal(bmc.ErrRedfishRequestFailed{Address: address, StatusCode: http.StatusUnauthorized}))
+	})
+
+	It("Should not perform unsupported power actions", func() {
+		address := "redfish+" + server.URL + "/redfish/v1/Systems/1"
+		err := bmc.Power(context.Background(), address, bmc.Credentials{}, false, "explode")
+		Expect(err).To(Equal(bmc.ErrUnsupportedPowerAction{Action: "explode"}))
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("Should not manage non-Redfish BMCs", func() {
+		address := "ipmi://" + strings.TrimPrefix(server.URL, "http://")
+		err := bmc.Power(context.Background(), address, bmc.Credentials{}, false, bmc.Reboot)
+		Expect(err).To(Equal(bmc.ErrUnsupportedBMCAddress{Address: address}))
+		Expect(requests).To(BeEmpty())
+	})
+})
@@ -18,17 +18,29 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
 
 	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	kerror "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	airshipv1 "sipcluster/pkg/api/v1"
 	airshipsvc "sipcluster/pkg/services"
@@ -40,10 +52,28 @@ type SIPClusterReconciler struct {
 	client.Client
 	Scheme         *runtime.Scheme
 	NamespacedName types.NamespacedName
+	Recorder       record.EventRecorder
+
+	// ResyncInterval is the interval at which SIPClusters are reconciled to restore their infrastructure services to
+	// their desired state. Changes to infrastructure service objects are reconciled immediately regardless. A zero
+	// interval disables periodic reconciliation.
+	ResyncInterval time.Duration
+
+	// NetworkDataKeys are the keys of the BMH Network Data secrets that may hold the Network Data, in order of
+	// preference. Defaults to vbmh.DefaultNetworkDataKeys.
+	NetworkDataKeys []string
+
+	// APIReader reads the SIPClusters and IP pools used to allocate infrastructure service IPs from the API server,
+	// so that addresses are not allocated from stale reservations. Defaults to Client.
+	APIReader client.Reader
 }
 
 const (
 	sipFinalizerName = "sip.airship.airshipit.org/finalizer"
+
+	// infraReadyRequeueInterval is the interval at which the readiness of infrastructure services is verified until
+	// they are ready.
+	infraReadyRequeueInterval = 10 * time.Second
 )
 
 // +kubebuilder:rbac:groups=airship.airshipit.org,resources=sipclusters,verbs=get;list;watch;create;update;patch;delete
@@ -51,6 +81,9 @@ const (
 // +kubebuilder:rbac:groups=airship.airshipit.org,resources=sipclusters/status,verbs=get;update;patch
 
 // +kubebuilder:rbac:groups="metal3.io",resources=baremetalhosts,verbs=get;update;patch;list
+// +kubebuilder:rbac:groups="cluster.x-k8s.io",resources=clusters,verbs=get;patch
+// +kubebuilder:rbac:groups="infrastructure.cluster.x-k8s.io",resources=metal3clusters,verbs=get;patch
+// +kubebuilder:rbac:groups="infrastructure.cluster.x-k8s.io",resources=metal3machinetemplates,verbs=get;create;patch
 
 func (r *SIPClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	r.NamespacedName = req.NamespacedName
@@ -109,6 +142,14 @@ func (r *SIPClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	machines, err := r.gatherVBMH(ctx, sip)
 	if err != nil {
+		apimeta.SetStatusCondition(&sip.Status.Conditions, metav1.Condition{
+			Status:             metav1.ConditionFalse,
+			Reason:             airshipv1.ReasonTypeUnschedulable,
+			Type:               airshipv1.ConditionTypeScheduled,
+			Message:            err.Error(),
+			ObservedGeneration: sip.GetGeneration(),
+		})
+
 		readyCondition = metav1.Condition{
 			Status:             metav1.ConditionFalse,
 			Reason:             airshipv1.ReasonTypeUnschedulable,
@@ -127,11 +168,48 @@ func (r *SIPClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{Requeue: true}, err
 	}
 
-	err = r.deployInfra(sip, machines, log)
+	apimeta.SetStatusCondition(&sip.Status.Conditions, metav1.Condition{
+		Status:             metav1.ConditionTrue,
+		Reason:             airshipv1.ReasonTypeScheduled,
+		Type:               airshipv1.ConditionTypeScheduled,
+		ObservedGeneration: sip.GetGeneration(),
+	})
+
+	previousAllocations := sip.Status.IPAllocations
+	if err = airshipsvc.AllocateIPs(&sip, r.apiReader()); err != nil {
+		readyCondition = metav1.Condition{
+			Status:             metav1.ConditionFalse,
+			Reason:             airshipv1.ReasonTypeUnableToAllocateIPs,
+			Type:               airshipv1.ConditionTypeReady,
+			Message:            err.Error(),
+			ObservedGeneration: sip.GetGeneration(),
+		}
+
+		apimeta.SetStatusCondition(&sip.Status.Conditions, readyCondition)
+		if patchStatusErr := r.patchStatus(ctx, &sip); patchStatusErr != nil {
+			err = kerror.NewAggregate([]error{err, patchStatusErr})
+			log.Error(err, "unable to set condition", "condition", readyCondition)
+		}
+
+		log.Error(err, "unable to allocate infrastructure service IPs")
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	// Allocations are persisted before the infrastructure services are deployed with them, so that they are reserved
+	// when other SIPClusters are reconciled. The status is patched from a copy, since the patch response would reset
+	// the addresses allocated in the spec.
+	if !reflect.DeepEqual(previousAllocations, sip.Status.IPAllocations) {
+		if err = r.patchStatus(ctx, sip.DeepCopy()); err != nil {
+			log.Error(err, "unable to record infrastructure service IP allocations")
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
+
+	err = r.deployInfra(&sip, machines, log)
 	if err != nil {
 		readyCondition = metav1.Condition{
 			Status:             metav1.ConditionFalse,
-			Reason:             airshipv1.ReasonTypeInfraServiceFailure,
+			Reason:             infraFailureReason(err),
 			Type:               airshipv1.ConditionTypeReady,
 			Message:            err.Error(),
 			ObservedGeneration: sip.GetGeneration(),
@@ -147,8 +225,35 @@ func (r *SIPClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{Requeue: true}, err
 	}
 
+	if err = r.updateControlPlaneEndpoint(&sip, log); err != nil {
+		readyCondition = metav1.Condition{
+			Status:             metav1.ConditionFalse,
+			Reason:             airshipv1.ReasonTypeUnableToUpdateControlPlaneEndpoint,
+			Type:               airshipv1.ConditionTypeReady,
+			Message:            err.Error(),
+			ObservedGeneration: sip.GetGeneration(),
+		}
+
+		apimeta.SetStatusCondition(&sip.Status.Conditions, readyCondition)
+		if patchStatusErr := r.patchStatus(ctx, &sip); patchStatusErr != nil {
+			err = kerror.NewAggregate([]error{err, patchStatusErr})
+			log.Error(err, "unable to set condition", "condition", readyCondition)
+		}
+
+		log.Error(err, "unable to update control plane endpoint")
+		return ctrl.Result{Requeue: true}, err
+	}
+
 	err = r.finish(sip, machines)
 	if err != nil {
+		apimeta.SetStatusCondition(&sip.Status.Conditions, metav1.Condition{
+			Status:             metav1.ConditionFalse,
+			Reason:             airshipv1.ReasonTypeUnableToApplyLabels,
+			Type:               airshipv1.ConditionTypeLabeled,
+			Message:            err.Error(),
+			ObservedGeneration: sip.GetGeneration(),
+		})
+
 		readyCondition = metav1.Condition{
 			Status:             metav1.ConditionFalse,
 			Reason:             airshipv1.ReasonTypeUnableToApplyLabels,
@@ -167,6 +272,51 @@ func (r *SIPClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{Requeue: true}, err
 	}
 
+	apimeta.SetStatusCondition(&sip.Status.Conditions, metav1.Condition{
+		Status:             metav1.ConditionTrue,
+		Reason:             airshipv1.ReasonTypeLabelsApplied,
+		Type:               airshipv1.ConditionTypeLabeled,
+		ObservedGeneration: sip.GetGeneration(),
+	})
+
+	if err = r.updateMachineTemplates(&sip, log); err != nil {
+		readyCondition = metav1.Condition{
+			Status:             metav1.ConditionFalse,
+			Reason:             airshipv1.ReasonTypeUnableToUpdateMachineTemplates,
+			Type:               airshipv1.ConditionTypeReady,
+			Message:            err.Error(),
+			ObservedGeneration: sip.GetGeneration(),
+		}
+
+		apimeta.SetStatusCondition(&sip.Status.Conditions, readyCondition)
+		if patchStatusErr := r.patchStatus(ctx, &sip); patchStatusErr != nil {
+			err = kerror.NewAggregate([]error{err, patchStatusErr})
+			log.Error(err, "unable to set condition", "condition", readyCondition)
+		}
+
+		log.Error(err, "unable to update machine templates")
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if err = r.checkInfra(&sip, machines, log); err != nil {
+		readyCondition = metav1.Condition{
+			Status:             metav1.ConditionFalse,
+			Reason:             airshipv1.ReasonTypeInfraServiceNotReady,
+			Type:               airshipv1.ConditionTypeReady,
+			Message:            err.Error(),
+			ObservedGeneration: sip.GetGeneration(),
+		}
+
+		apimeta.SetStatusCondition(&sip.Status.Conditions, readyCondition)
+		if patchStatusErr := r.patchStatus(ctx, &sip); patchStatusErr != nil {
+			log.Error(patchStatusErr, "unable to set condition", "condition", readyCondition)
+			return ctrl.Result{Requeue: true}, patchStatusErr
+		}
+
+		log.Info("infrastructure services are not ready", "reason", err.Error())
+		return ctrl.Result{RequeueAfter: infraReadyRequeueInterval}, nil
+	}
+
 	readyCondition = metav1.Condition{
 		Status:             metav1.ConditionTrue,
 		Reason:             airshipv1.ReasonTypeReconciliationSucceeded,
@@ -182,7 +332,7 @@ func (r *SIPClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{Requeue: true}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
 }
 
 func (r *SIPClusterReconciler) patchStatus(ctx context.Context, sip *airshipv1.SIPCluster) error {
@@ -196,12 +346,106 @@ func (r *SIPClusterReconciler) patchStatus(ctx context.Context, sip *airshipv1.S
 	return r.Client.Status().Patch(ctx, sip, client.MergeFrom(latest))
 }
 
+func (r *SIPClusterReconciler) apiReader() client.Reader {
+	if r.APIReader == nil {
+		return r.Client
+	}
+
+	return r.APIReader
+}
+
 func (r *SIPClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&airshipv1.SIPCluster{}, builder.WithPredicates(
 			predicate.GenerationChangedPredicate{},
-		)).
-		Complete(r)
+		))
+
+	// Infrastructure service objects are in the namespace of the sub-cluster, so they are mapped to their SIPCluster
+	// through labels rather than owner references.
+	for _, obj := range []client.Object{
+		&appsv1.Deployment{},
+		&corev1.Service{},
+		&corev1.Secret{},
+		&policyv1beta1.PodDisruptionBudget{},
+	} {
+		b = b.Watches(&source.Kind{Type: obj}, handler.EnqueueRequestsFromMapFunc(ownerRequests),
+			builder.WithPredicates(infraServiceChangedPredicate()))
+	}
+	b = b.Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.configMapRequests),
+		builder.WithPredicates(infraServiceChangedPredicate()))
+
+	return b.Complete(r)
+}
+
+// configMapRequests maps a ConfigMap to reconcile requests for the SIPCluster owning it, if any, and for the
+// SIPClusters whose load balancers or manifest-template services are rendered from templates it holds, so that
+// template changes are applied without waiting for the next resync.
+func (r *SIPClusterReconciler) configMapRequests(obj client.Object) []reconcile.Request {
+	requests := ownerRequests(obj)
+
+	sips := &airshipv1.SIPClusterList{}
+	if err := r.Client.List(context.Background(), sips, client.InNamespace(obj.GetNamespace())); err != nil {
+		ctrl.Log.WithName("sipcluster").Error(err, "unable to list SIPClusters referencing ConfigMap", "configmap",
+			obj.GetNamespace()+"/"+obj.GetName())
+		return requests
+	}
+
+	for i := range sips.Items {
+		if templatesIn(sips.Items[i], obj.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&sips.Items[i])})
+		}
+	}
+
+	return requests
+}
+
+// templatesIn reports whether the load balancers or manifest-template services of a SIPCluster are rendered from
+// templates held by the ConfigMap with the given name.
+func templatesIn(sip airshipv1.SIPCluster, configMapName string) bool {
+	for _, lb := range sip.Spec.Services.LoadBalancer {
+		if lb.Template != nil && lb.Template.Name == configMapName {
+			return true
+		}
+	}
+
+	for _, svc := range sip.Spec.Services.Custom {
+		if svc.Type != airshipsvc.ManifestTemplateServiceType {
+			continue
+		}
+		config := airshipv1.ManifestTemplateConfig{}
+		if err := json.Unmarshal(svc.Config.Raw, &config); err == nil && config.ConfigMap.Name == configMapName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ownerRequests maps an infrastructure service object to a reconcile request for the SIPCluster owning it.
+func ownerRequests(obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	name, namespace := labels[airshipsvc.SIPClusterNameLabel], labels[airshipsvc.SIPClusterNamespaceLabel]
+	if name == "" || namespace == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}}
+}
+
+// infraServiceChangedPredicate filters out updates of infrastructure service objects that only change their status.
+// Objects without a generation, such as Secrets and ConfigMaps, have no status, so all their updates are accepted.
+func infraServiceChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectNew.GetGeneration() == 0 {
+				return true
+			}
+
+			return e.ObjectNew.GetGeneration() != e.ObjectOld.GetGeneration() ||
+				!reflect.DeepEqual(e.ObjectNew.GetLabels(), e.ObjectOld.GetLabels()) ||
+				!reflect.DeepEqual(e.ObjectNew.GetAnnotations(), e.ObjectOld.GetAnnotations())
+		},
+	}
 }
 
 func (r *SIPClusterReconciler) handleFinalizers(ctx context.Context, sip airshipv1.SIPCluster) (ctrl.Result, error) {
@@ -212,6 +456,15 @@ func (r *SIPClusterReconciler) handleFinalizers(ctx context.Context, sip airship
 		return ctrl.Result{}, err
 	}
 
+	// Release the addresses of the infrastructure services, now that they are removed.
+	if len(sip.Status.IPAllocations) > 0 {
+		sip.Status.IPAllocations = nil
+		if err = r.patchStatus(ctx, &sip); err != nil {
+			log.Error(err, "unable to release infrastructure service IPs")
+			return ctrl.Result{}, err
+		}
+	}
+
 	// remove the finalizer from the list and update it.
 	sip.ObjectMeta.Finalizers = removeString(sip.ObjectMeta.Finalizers, sipFinalizerName)
 	return ctrl.Result{}, r.Update(context.Background(), &sip)
@@ -272,8 +525,9 @@ func (r *SIPClusterReconciler) gatherVBMH(ctx context.Context, sip airshipv1.SIP
 	logger := logr.FromContext(ctx)
 	logger.Info("starting to gather BaremetalHost machines for SIPcluster")
 	machines := &airshipvms.MachineList{
-		Log:            logger.WithName("machines"),
-		NamespacedName: r.NamespacedName,
+		Log:             logger.WithName("machines"),
+		NamespacedName:  r.NamespacedName,
+		NetworkDataKeys: r.NetworkDataKeys,
 	}
 	// TODO : this is a loop until we succeed or cannot find a schedule
 	for {
@@ -306,25 +560,191 @@ func (r *SIPClusterReconciler) gatherVBMH(ctx context.Context, sip airshipv1.SIP
 	return machines, nil
 }
 
-func (r *SIPClusterReconciler) deployInfra(sip airshipv1.SIPCluster, machines *airshipvms.MachineList,
+func (r *SIPClusterReconciler) deployInfra(sip *airshipv1.SIPCluster, machines *airshipvms.MachineList,
 	logger logr.Logger) error {
 	if err := airshipsvc.CreateNS(sip.Spec.ClusterName, r.Client); err != nil {
 		return err
 	}
-	newServiceSet := airshipsvc.NewServiceSet(logger, sip, machines, r.Client)
+	newServiceSet := airshipsvc.NewServiceSet(logger, *sip, machines, r.Client, r.Recorder)
 	serviceList, err := newServiceSet.ServiceList()
 	if err != nil {
+		if errors.As(err, &airshipsvc.ErrInfraServiceNotSupported{}) {
+			setServiceFailure(sip, airshipv1.ConditionTypeAuthReady, err)
+		}
 		return err
 	}
+	removeServiceConditions(sip, serviceList)
 	for _, svc := range serviceList {
 		err := svc.Deploy()
 		if err != nil {
+			setServiceFailure(sip, svc.ConditionType(), err)
 			return err
 		}
 	}
+
+	// Service status is informational, so failing to retrieve it does not fail the reconciliation. Endpoints and
+	// load balancer states are reported afresh so that those of removed services are not published.
+	sip.Status.Endpoints = nil
+	sip.Status.LoadBalancers = nil
+	for _, svc := range serviceList {
+		if reporter, ok := svc.(airshipsvc.StatusReporter); ok {
+			if err := reporter.ReportStatus(&sip.Status); err != nil {
+				logger.Error(err, "unable to retrieve infrastructure service status")
+			}
+		}
+	}
+	return nil
+}
+
+// updateControlPlaneEndpoint sets the control plane endpoint of the Cluster API cluster referenced by the SIPCluster,
+// and reports the result in a condition.
+func (r *SIPClusterReconciler) updateControlPlaneEndpoint(sip *airshipv1.SIPCluster, logger logr.Logger) error {
+	if sip.Spec.ControlPlaneEndpointRef == nil {
+		apimeta.RemoveStatusCondition(&sip.Status.Conditions, airshipv1.ConditionTypeControlPlaneEndpointUpdated)
+		return nil
+	}
+
+	if err := airshipsvc.UpdateControlPlaneEndpoint(*sip, r.Client, logger); err != nil {
+		apimeta.SetStatusCondition(&sip.Status.Conditions, metav1.Condition{
+			Status:             metav1.ConditionFalse,
+			Reason:             airshipv1.ReasonTypeUnableToUpdateControlPlaneEndpoint,
+			Type:               airshipv1.ConditionTypeControlPlaneEndpointUpdated,
+			Message:            err.Error(),
+			ObservedGeneration: sip.GetGeneration(),
+		})
+		return err
+	}
+
+	apimeta.SetStatusCondition(&sip.Status.Conditions, metav1.Condition{
+		Status:             metav1.ConditionTrue,
+		Reason:             airshipv1.ReasonTypeControlPlaneEndpointUpdated,
+		Type:               airshipv1.ConditionTypeControlPlaneEndpointUpdated,
+		ObservedGeneration: sip.GetGeneration(),
+	})
 	return nil
 }
 
+// updateMachineTemplates sets the hostSelectors of the Metal3MachineTemplates referenced by the node sets of the
+// SIPCluster, and reports the result in a condition.
+func (r *SIPClusterReconciler) updateMachineTemplates(sip *airshipv1.SIPCluster, logger logr.Logger) error {
+	referenced := false
+	for _, nodeSet := range sip.Spec.Nodes {
+		if nodeSet.MachineTemplate != nil {
+			referenced = true
+		}
+	}
+	if !referenced {
+		apimeta.RemoveStatusCondition(&sip.Status.Conditions, airshipv1.ConditionTypeMachineTemplatesUpdated)
+		return nil
+	}
+
+	if err := airshipsvc.UpdateMachineTemplates(*sip, r.Client, logger); err != nil {
+		apimeta.SetStatusCondition(&sip.Status.Conditions, metav1.Condition{
+			Status:             metav1.ConditionFalse,
+			Reason:             airshipv1.ReasonTypeUnableToUpdateMachineTemplates,
+			Type:               airshipv1.ConditionTypeMachineTemplatesUpdated,
+			Message:            err.Error(),
+			ObservedGeneration: sip.GetGeneration(),
+		})
+		return err
+	}
+
+	apimeta.SetStatusCondition(&sip.Status.Conditions, metav1.Condition{
+		Status:             metav1.ConditionTrue,
+		Reason:             airshipv1.ReasonTypeMachineTemplatesUpdated,
+		Type:               airshipv1.ConditionTypeMachineTemplatesUpdated,
+		ObservedGeneration: sip.GetGeneration(),
+	})
+	return nil
+}
+
+// removeServiceConditions removes the readiness conditions of infrastructure service types that are no longer
+// configured for the SIPCluster.
+func removeServiceConditions(sip *airshipv1.SIPCluster, serviceList []airshipsvc.InfraService) {
+	configured := map[string]bool{airshipv1.ConditionTypeReady: true}
+	for _, svc := range serviceList {
+		configured[svc.ConditionType()] = true
+	}
+
+	for _, condition := range append([]metav1.Condition{}, sip.Status.Conditions...) {
+		switch condition.Reason {
+		case airshipv1.ReasonTypeInfraServiceReady, airshipv1.ReasonTypeInfraServiceNotReady,
+			airshipv1.ReasonTypeInfraServiceFailure:
+			if !configured[condition.Type] {
+				apimeta.RemoveStatusCondition(&sip.Status.Conditions, condition.Type)
+			}
+		}
+	}
+}
+
+// setServiceFailure sets the readiness condition of an infrastructure service type that could not be deployed.
+func setServiceFailure(sip *airshipv1.SIPCluster, conditionType string, err error) {
+	apimeta.SetStatusCondition(&sip.Status.Conditions, metav1.Condition{
+		Status:             metav1.ConditionFalse,
+		Reason:             infraFailureReason(err),
+		Type:               conditionType,
+		Message:            err.Error(),
+		ObservedGeneration: sip.GetGeneration(),
+	})
+}
+
+// infraFailureReason returns the condition reason of an infrastructure service deployment failure, distinguishing
+// invalid load balancer templates, which are fixed by editing the referenced ConfigMap.
+func infraFailureReason(err error) string {
+	if errors.As(err, &airshipsvc.ErrInvalidLoadBalancerTemplate{}) {
+		return airshipv1.ReasonTypeInvalidLoadBalancerTemplate
+	}
+
+	return airshipv1.ReasonTypeInfraServiceFailure
+}
+
+// checkInfra sets a condition reporting the readiness of each type of infrastructure service, and returns an error
+// describing the first service that is not ready.
+func (r *SIPClusterReconciler) checkInfra(sip *airshipv1.SIPCluster, machines *airshipvms.MachineList,
+	logger logr.Logger) error {
+	serviceList, err := airshipsvc.NewServiceSet(logger, *sip, machines, r.Client, r.Recorder).ServiceList()
+	if err != nil {
+		return err
+	}
+
+	notReady := map[string]error{}
+	conditionTypes := []string{}
+	for _, svc := range serviceList {
+		conditionType := svc.ConditionType()
+		if _, exists := notReady[conditionType]; !exists {
+			conditionTypes = append(conditionTypes, conditionType)
+			notReady[conditionType] = nil
+		}
+
+		if notReady[conditionType] == nil {
+			notReady[conditionType] = svc.Ready()
+		}
+	}
+
+	var firstErr error
+	for _, conditionType := range conditionTypes {
+		condition := metav1.Condition{
+			Status:             metav1.ConditionTrue,
+			Reason:             airshipv1.ReasonTypeInfraServiceReady,
+			Type:               conditionType,
+			ObservedGeneration: sip.GetGeneration(),
+		}
+
+		if err := notReady[conditionType]; err != nil {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = airshipv1.ReasonTypeInfraServiceNotReady
+			condition.Message = err.Error()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		apimeta.SetStatusCondition(&sip.Status.Conditions, condition)
+	}
+
+	return firstErr
+}
+
 /*
 finish shoulld  take care of any wrpa up tasks..
 */
@@ -340,18 +760,13 @@ Such as i'e what are we doing with the lables on the vBMH's
 func (r *SIPClusterReconciler) finalize(ctx context.Context, sip airshipv1.SIPCluster) error {
 	logger := logr.FromContext(ctx)
 	machines := &airshipvms.MachineList{}
-	serviceSet := airshipsvc.NewServiceSet(logger, sip, machines, r.Client)
-	serviceList, err := serviceSet.ServiceList()
-	if err != nil {
-		return err
-	}
-	for _, svc := range serviceList {
-		err = svc.Finalize()
-		if err != nil {
+	serviceSet := airshipsvc.NewServiceSet(logger, sip, machines, r.Client, r.Recorder)
+	for _, svc := range serviceSet.FinalizableServiceList() {
+		if err := svc.Finalize(); err != nil {
 			return err
 		}
 	}
-	err = serviceSet.Finalize()
+	err := serviceSet.Finalize()
 	if err != nil {
 		return err
 	}
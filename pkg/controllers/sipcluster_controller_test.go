@@ -24,12 +24,17 @@ import (
 	. "github.com/onsi/gomega"
 
 	metal3 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	airshipv1 "sipcluster/pkg/api/v1"
+	"sipcluster/pkg/services"
 	"sipcluster/pkg/vbmh"
 	"sipcluster/testutil"
 )
@@ -91,6 +96,39 @@ var _ = Describe("SIPCluster controller", func() {
 
 				return compareLabels(expectedLabels, bmh.GetLabels())
 			}, 30, 5).Should(Succeed())
+
+			// Infrastructure services are deployed, but never become ready in the test environment
+			Eventually(func() bool {
+				var sipCR airshipv1.SIPCluster
+				Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+					Name:      clusterName,
+					Namespace: testNamespace,
+				}, &sipCR)).To(Succeed())
+
+				ready := apimeta.FindStatusCondition(sipCR.Status.Conditions, airshipv1.ConditionTypeReady)
+				return ready != nil && ready.Reason == airshipv1.ReasonTypeInfraServiceNotReady &&
+					apimeta.IsStatusConditionTrue(sipCR.Status.Conditions, airshipv1.ConditionTypeScheduled) &&
+					apimeta.IsStatusConditionTrue(sipCR.Status.Conditions, airshipv1.ConditionTypeLabeled) &&
+					apimeta.IsStatusConditionFalse(sipCR.Status.Conditions, airshipv1.ConditionTypeLoadBalancerReady) &&
+					apimeta.IsStatusConditionFalse(sipCR.Status.Conditions, airshipv1.ConditionTypeJumpHostReady) &&
+					apimeta.FindStatusCondition(sipCR.Status.Conditions, airshipv1.ConditionTypeAuthReady) == nil
+			}, 30, 5).Should(BeTrue())
+
+			By("Restoring infrastructure services that drifted from their desired state")
+			jumpHost := types.NamespacedName{
+				Name:      services.JumpHostServiceName + "-" + clusterName,
+				Namespace: sipCluster.Spec.ClusterName,
+			}
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(context.Background(), jumpHost, deployment)).To(Succeed())
+			scaledDown := int32(0)
+			deployment.Spec.Replicas = &scaledDown
+			Expect(k8sClient.Update(context.Background(), deployment)).To(Succeed())
+
+			Eventually(func() int32 {
+				Expect(k8sClient.Get(context.Background(), jumpHost, deployment)).To(Succeed())
+				return *deployment.Spec.Replicas
+			}, 30, 1).Should(Equal(int32(1)))
 		})
 
 		It("Should not schedule nodes when there is an insufficient number of available ControlPlane nodes", func() {
@@ -136,6 +174,8 @@ var _ = Describe("SIPCluster controller", func() {
 
 			Expect(apimeta.IsStatusConditionFalse(sipCR.Status.Conditions,
 				airshipv1.ConditionTypeReady)).To(BeTrue())
+			Expect(apimeta.IsStatusConditionFalse(sipCR.Status.Conditions,
+				airshipv1.ConditionTypeScheduled)).To(BeTrue())
 		})
 
 		It("Should not schedule nodes when there is an insufficient number of available Worker nodes", func() {
@@ -444,6 +484,41 @@ var _ = Describe("SIPCluster controller", func() {
 			})
 		})
 	})
+
+	Context("When a ConfigMap holding templates changes", func() {
+		It("Should reconcile the SIPClusters rendered from its templates", func() {
+			templates := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "templates", Namespace: testNamespace},
+			}
+
+			lbTemplate := testutil.CreateSIPCluster("lb-template", testNamespace, 1, 1)
+			lbTemplate.Spec.Services.LoadBalancer[0].Template = &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: templates.GetName()},
+				Key:                  "haproxy.cfg",
+			}
+			Expect(k8sClient.Create(context.Background(), lbTemplate)).Should(Succeed())
+
+			manifestTemplate := testutil.CreateSIPCluster("manifest-template", testNamespace, 1, 1)
+			manifestTemplate.Spec.Services.Custom = []airshipv1.CustomService{{
+				Type:   services.ManifestTemplateServiceType,
+				Config: runtime.RawExtension{Raw: []byte(`{"configMap":{"name":"templates"}}`)},
+			}}
+			Expect(k8sClient.Create(context.Background(), manifestTemplate)).Should(Succeed())
+
+			otherTemplates := testutil.CreateSIPCluster("other-templates", testNamespace, 1, 1)
+			otherTemplates.Spec.Services.Custom = []airshipv1.CustomService{{
+				Type:   services.ManifestTemplateServiceType,
+				Config: runtime.RawExtension{Raw: []byte(`{"configMap":{"name":"other-templates"}}`)},
+			}}
+			Expect(k8sClient.Create(context.Background(), otherTemplates)).Should(Succeed())
+
+			r := &SIPClusterReconciler{Client: k8sClient}
+			Expect(r.configMapRequests(templates)).To(ConsistOf(
+				reconcile.Request{NamespacedName: client.ObjectKeyFromObject(lbTemplate)},
+				reconcile.Request{NamespacedName: client.ObjectKeyFromObject(manifestTemplate)},
+			))
+		})
+	})
 })
 
 func compareLabels(expected map[string]string, actual map[string]string) error {
@@ -0,0 +1,112 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+)
+
+// defaultControlPlaneFrontend is the load balancer frontend providing the control plane endpoint when none is
+// specified.
+const defaultControlPlaneFrontend = "apiserver"
+
+// UpdateControlPlaneEndpoint sets the spec.controlPlaneEndpoint of the Cluster API cluster referenced by a SIPCluster
+// to the preferred address published in the SIPCluster status for its load balancer frontend. The referenced object is
+// only patched when its endpoint differs.
+func UpdateControlPlaneEndpoint(sip airshipv1.SIPCluster, c client.Client, logger logr.Logger) error {
+	ref := sip.Spec.ControlPlaneEndpointRef
+	if ref == nil {
+		return nil
+	}
+
+	host, port, err := controlPlaneAddress(sip)
+	if err != nil {
+		return err
+	}
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = sip.GetNamespace()
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
+	ctx := context.Background()
+	if err = c.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: namespace}, obj); err != nil {
+		return err
+	}
+
+	currentHost, _, err := unstructured.NestedString(obj.Object, "spec", "controlPlaneEndpoint", "host")
+	if err != nil {
+		return err
+	}
+	currentPort, _, err := unstructured.NestedInt64(obj.Object, "spec", "controlPlaneEndpoint", "port")
+	if err != nil {
+		return err
+	}
+	if currentHost == host && currentPort == port {
+		return nil
+	}
+
+	patch := client.MergeFrom(obj.DeepCopy())
+	if err = unstructured.SetNestedField(obj.Object, host, "spec", "controlPlaneEndpoint", "host"); err != nil {
+		return err
+	}
+	if err = unstructured.SetNestedField(obj.Object, port, "spec", "controlPlaneEndpoint", "port"); err != nil {
+		return err
+	}
+
+	logger.Info("Updating control plane endpoint", "kind", ref.Kind, "name", namespace+"/"+ref.Name,
+		"host", host, "port", port)
+	return c.Patch(ctx, obj, patch)
+}
+
+// controlPlaneAddress returns the preferred address published for the load balancer frontend providing the control
+// plane endpoint of a SIPCluster.
+func controlPlaneAddress(sip airshipv1.SIPCluster) (string, int64, error) {
+	frontend := sip.Spec.ControlPlaneEndpointRef.Frontend
+	if frontend == "" {
+		frontend = defaultControlPlaneFrontend
+	}
+
+	instance := LoadBalancerServiceName + "-" + sip.GetName()
+	for _, endpoint := range sip.Status.Endpoints {
+		if endpoint.Service != instance || endpoint.Name != frontend || len(endpoint.Addresses) == 0 {
+			continue
+		}
+
+		host, portStr, err := net.SplitHostPort(endpoint.Addresses[0])
+		if err != nil {
+			return "", 0, err
+		}
+		port, err := strconv.ParseInt(portStr, 10, 32)
+		if err != nil {
+			return "", 0, err
+		}
+
+		return host, port, nil
+	}
+
+	return "", 0, ErrControlPlaneEndpointUnavailable{Frontend: frontend}
+}
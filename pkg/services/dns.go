@@ -0,0 +1,478 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+)
+
+const (
+	// DNSServiceType is the type of custom services that serve a DNS zone for the hosts of a sub-cluster,
+	// configured by a DNSConfig.
+	DNSServiceType = "dns"
+
+	// ConditionTypeDNSReady is the SIPCluster status condition type reporting the readiness of dns services.
+	ConditionTypeDNSReady = "DNSReady"
+
+	// DefaultDNSImage is the CoreDNS image of dns services when none is specified.
+	DefaultDNSImage = "coredns/coredns:1.8.0"
+
+	// DNSAPIRecord and DNSJumpHostRecord are the names, relative to the zone, resolving to the load balancer and the
+	// jump host of the sub-cluster.
+	DNSAPIRecord      = "api"
+	DNSJumpHostRecord = "jumphost"
+
+	defaultDNSTTL = 60
+
+	keyCorefile    = "Corefile"
+	keyZoneFile    = "db.zone"
+	mountPathDNS   = "/etc/coredns"
+	nameDNSVolume  = "config"
+	nameDNSPort    = "dns"
+	nameDNSTCPPort = "dns-tcp"
+	dnsPort        = 53
+	dnsHealthPort  = 8080
+	dnsReadyPort   = 8181
+)
+
+func init() {
+	RegisterServiceType(DNSServiceType, newDNS)
+}
+
+type dns struct {
+	ctx     ServiceContext
+	service airshipv1.SIPClusterService
+	config  airshipv1.DNSConfig
+}
+
+func newDNS(ctx ServiceContext, config airshipv1.CustomService) (InfraService, error) {
+	d := dns{ctx: ctx, service: config.SIPClusterService}
+	if len(config.Config.Raw) > 0 {
+		if err := json.Unmarshal(config.Config.Raw, &d.config); err != nil {
+			return nil, ErrInvalidServiceConfig{Type: config.Type, Err: err}
+		}
+	}
+
+	invalid := func(err error) (InfraService, error) {
+		return nil, ErrInvalidServiceConfig{Type: config.Type, Err: err}
+	}
+	if d.service.NodeInterface == "" {
+		return invalid(errors.New("nodeInterfaceId is required"))
+	}
+	if errs := validation.IsDNS1123Subdomain(d.zone()); len(errs) > 0 {
+		return invalid(fmt.Errorf("zone %q is invalid: %s", d.zone(), strings.Join(errs, ", ")))
+	}
+	for _, upstream := range d.config.Upstreams {
+		host := upstream
+		if h, _, err := net.SplitHostPort(upstream); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			return invalid(fmt.Errorf("upstream %q is not an IP address", upstream))
+		}
+	}
+	if d.config.TTL < 0 {
+		return invalid(fmt.Errorf("ttl %d is negative", d.config.TTL))
+	}
+
+	return d, nil
+}
+
+func (d dns) zone() string {
+	if d.config.Zone != "" {
+		return d.config.Zone
+	}
+
+	return d.ctx.SIPCluster.Spec.ClusterName + ".sip.local"
+}
+
+func (d dns) ttl() int {
+	if d.config.TTL == 0 {
+		return defaultDNSTTL
+	}
+
+	return d.config.TTL
+}
+
+// Deploy applies the zone of the sub-cluster, and the CoreDNS Deployment and Service serving it. The zone is
+// generated from the scheduled hosts on each reconciliation, and CoreDNS pods are rolled when it changes.
+func (d dns) Deploy() error {
+	instance := d.ctx.InstanceName(DNSServiceType)
+	labels := map[string]string{
+		// See https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/#labels
+		"app.kubernetes.io/part-of":   "sip",
+		"app.kubernetes.io/name":      DNSServiceType,
+		"app.kubernetes.io/component": DNSServiceType,
+		"app.kubernetes.io/instance":  instance,
+	}
+
+	configMap, err := d.generateConfigMap(instance, labels)
+	if err != nil {
+		return err
+	}
+
+	d.ctx.Logger.Info("Applying configmap", "configmap", configMap.GetNamespace()+"/"+configMap.GetName())
+	if err = d.ctx.Apply(configMap); err != nil {
+		return err
+	}
+
+	deployment := d.generateDeployment(instance, labels, configMap)
+	d.ctx.Logger.Info("Applying deployment", "deployment", deployment.GetNamespace()+"/"+deployment.GetName())
+	if err = d.ctx.Apply(deployment); err != nil {
+		return err
+	}
+
+	service := d.generateService(instance, labels)
+	d.ctx.Logger.Info("Applying service", "service", service.GetNamespace()+"/"+service.GetName())
+	return d.ctx.Apply(service)
+}
+
+func (d dns) generateConfigMap(instance string, labels map[string]string) (*corev1.ConfigMap, error) {
+	zone, err := d.generateZone()
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance,
+			Namespace: d.ctx.Namespace(),
+			Labels:    labels,
+		},
+		Data: map[string]string{
+			keyCorefile: d.generateCorefile(),
+			keyZoneFile: zone,
+		},
+	}, nil
+}
+
+// generateCorefile configures CoreDNS to serve the zone file and, when upstreams are configured, forward other
+// queries to them.
+func (d dns) generateCorefile() string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "%s:%d {\n", d.zone(), dnsPort)
+	b.WriteString("    errors\n")
+	fmt.Fprintf(&b, "    health :%d\n", dnsHealthPort)
+	fmt.Fprintf(&b, "    ready :%d\n", dnsReadyPort)
+	fmt.Fprintf(&b, "    file %s/%s %s\n", mountPathDNS, keyZoneFile, d.zone())
+	b.WriteString("}\n")
+
+	if len(d.config.Upstreams) > 0 {
+		fmt.Fprintf(&b, ".:%d {\n", dnsPort)
+		b.WriteString("    errors\n")
+		fmt.Fprintf(&b, "    forward . %s\n", strings.Join(d.config.Upstreams, " "))
+		b.WriteString("    cache 30\n")
+		b.WriteString("}\n")
+	}
+
+	return b.String()
+}
+
+// dnsRecord is an address record of the zone, named relative to the zone origin.
+type dnsRecord struct {
+	Name    string
+	Address string
+}
+
+func (r dnsRecord) String() string {
+	recordType := "A"
+	if net.ParseIP(r.Address).To4() == nil {
+		recordType = "AAAA"
+	}
+
+	return fmt.Sprintf("%s IN %s %s", r.Name, recordType, r.Address)
+}
+
+// generateRecords returns the sorted address records of the zone:
+//   - <host> resolves to each scheduled host
+//   - controlplane and worker resolve to the hosts of each role
+//   - api resolves to the load balancer virtual IPs, or to the base cluster nodes exposing its node ports
+//   - jumphost resolves to the base cluster nodes exposing the jump host node port
+func (d dns) generateRecords() ([]dnsRecord, error) {
+	records := map[dnsRecord]struct{}{}
+	if d.ctx.Machines != nil {
+		for _, machine := range d.ctx.Machines.Machines {
+			if machine.Data == nil {
+				continue
+			}
+			for _, ip := range machine.Data.IPs(d.service.NodeInterface, d.service.IPFamily) {
+				records[dnsRecord{Name: machine.BMH.GetName(), Address: ip}] = struct{}{}
+				records[dnsRecord{Name: strings.ToLower(string(machine.VMRole)), Address: ip}] = struct{}{}
+			}
+		}
+	}
+
+	services := d.ctx.SIPCluster.Spec.Services
+	if len(services.LoadBalancer) > 0 || len(services.JumpHost) > 0 {
+		nodeIPs, err := nodeInternalIPs(d.ctx.Client)
+		if err != nil {
+			return nil, err
+		}
+
+		apiIPs := []string{}
+		for _, lb := range services.LoadBalancer {
+			if lb.VirtualIP != nil {
+				apiIPs = append(apiIPs, lb.VirtualIP.Address)
+			}
+		}
+		if len(services.LoadBalancer) > 0 && len(apiIPs) == 0 {
+			apiIPs = nodeIPs
+		}
+		for _, ip := range apiIPs {
+			records[dnsRecord{Name: DNSAPIRecord, Address: ip}] = struct{}{}
+		}
+
+		if len(services.JumpHost) > 0 {
+			for _, ip := range nodeIPs {
+				records[dnsRecord{Name: DNSJumpHostRecord, Address: ip}] = struct{}{}
+			}
+		}
+	}
+
+	sorted := make([]dnsRecord, 0, len(records))
+	for record := range records {
+		sorted = append(sorted, record)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Address < sorted[j].Address
+	})
+
+	return sorted, nil
+}
+
+// generateZone generates the zone file. The SOA serial is derived from the records, so that it changes with them
+// while the zone file stays identical across reconciliations of the same hosts.
+func (d dns) generateZone() (string, error) {
+	records, err := d.generateRecords()
+	if err != nil {
+		return "", err
+	}
+
+	body := strings.Builder{}
+	for _, record := range records {
+		body.WriteString(record.String())
+		body.WriteByte('\n')
+	}
+
+	serial := fnv.New32a()
+	serial.Write([]byte(body.String())) //nolint:errcheck
+
+	origin := d.zone() + "."
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "$ORIGIN %s\n", origin)
+	fmt.Fprintf(&b, "$TTL %d\n", d.ttl())
+	fmt.Fprintf(&b, "@ IN SOA ns.%s hostmaster.%s %d 7200 3600 1209600 %d\n", origin, origin, serial.Sum32(), d.ttl())
+	b.WriteString(body.String())
+
+	return b.String(), nil
+}
+
+func (d dns) generateDeployment(instance string, labels map[string]string,
+	configMap *corev1.ConfigMap) *appsv1.Deployment {
+	image := d.service.Image
+	if image == "" {
+		image = DefaultDNSImage
+	}
+
+	data := map[string][]byte{}
+	for key, value := range configMap.Data {
+		data[key] = []byte(value)
+	}
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance,
+			Namespace: d.ctx.Namespace(),
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					Annotations: map[string]string{
+						ConfigChecksumAnnotation: configChecksum(data),
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  DNSServiceType,
+							Image: image,
+							Args:  []string{"-conf", mountPathDNS + "/" + keyCorefile},
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          nameDNSPort,
+									ContainerPort: dnsPort,
+									Protocol:      corev1.ProtocolUDP,
+								},
+								{
+									Name:          nameDNSTCPPort,
+									ContainerPort: dnsPort,
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							LivenessProbe: &corev1.Probe{
+								Handler: corev1.Handler{
+									HTTPGet: &corev1.HTTPGetAction{
+										Path: "/health",
+										Port: intstr.FromInt(dnsHealthPort),
+									},
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								Handler: corev1.Handler{
+									HTTPGet: &corev1.HTTPGetAction{
+										Path: "/ready",
+										Port: intstr.FromInt(dnsReadyPort),
+									},
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      nameDNSVolume,
+									MountPath: mountPathDNS,
+									ReadOnly:  true,
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: nameDNSVolume,
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: configMap.GetName(),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// generateService exposes the zone on the node port of the service when one is specified, and on a cluster IP
+// otherwise.
+func (d dns) generateService(instance string, labels map[string]string) *corev1.Service {
+	serviceType := corev1.ServiceTypeClusterIP
+	if d.service.NodePort != 0 {
+		serviceType = corev1.ServiceTypeNodePort
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance,
+			Namespace: d.ctx.Namespace(),
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       nameDNSPort,
+					Port:       dnsPort,
+					Protocol:   corev1.ProtocolUDP,
+					TargetPort: intstr.FromString(nameDNSPort),
+					NodePort:   int32(d.service.NodePort),
+				},
+				{
+					Name:       nameDNSTCPPort,
+					Port:       dnsPort,
+					Protocol:   corev1.ProtocolTCP,
+					TargetPort: intstr.FromString(nameDNSTCPPort),
+					NodePort:   int32(d.service.NodePort),
+				},
+			},
+			Selector: labels,
+			Type:     serviceType,
+		},
+	}
+	if d.service.ClusterIP != nil {
+		service.Spec.ClusterIP = *d.service.ClusterIP
+	}
+
+	return service
+}
+
+// Finalize deletes the CoreDNS Deployment, Service and zone.
+func (d dns) Finalize() error {
+	meta := metav1.ObjectMeta{Name: d.ctx.InstanceName(DNSServiceType), Namespace: d.ctx.Namespace()}
+	objs := []client.Object{
+		&appsv1.Deployment{ObjectMeta: meta},
+		&corev1.Service{ObjectMeta: meta},
+		&corev1.ConfigMap{ObjectMeta: meta},
+	}
+	for _, obj := range objs {
+		if err := d.ctx.Client.Delete(context.Background(), obj); err != nil && !apierror.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ready verifies that the CoreDNS Deployment is available and reachable through its Service.
+func (d dns) Ready() error {
+	key := client.ObjectKey{Name: d.ctx.InstanceName(DNSServiceType), Namespace: d.ctx.Namespace()}
+	if err := deploymentReady(DNSServiceType, key, d.ctx.Client); err != nil {
+		return err
+	}
+
+	return endpointsReady(DNSServiceType, key, d.ctx.Client)
+}
+
+// ReportStatus reports the endpoints on which the zone is served.
+func (d dns) ReportStatus(status *airshipv1.SIPClusterStatus) error {
+	instance := d.ctx.InstanceName(DNSServiceType)
+	endpoints, err := serviceEndpoints(client.ObjectKey{Name: instance, Namespace: d.ctx.Namespace()},
+		d.ctx.Client, nil)
+	if err != nil {
+		return err
+	}
+
+	setEndpoints(status, instance, endpoints)
+	return nil
+}
+
+// ConditionType returns the SIPCluster status condition type reporting the readiness of dns services.
+func (d dns) ConditionType() string {
+	return ConditionTypeDNSReady
+}
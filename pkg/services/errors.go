@@ -17,6 +17,8 @@ package services
 import (
 	"fmt"
 
+	"k8s.io/apimachinery/pkg/runtime"
+
 	airshipv1 "sipcluster/pkg/api/v1"
 )
 
@@ -29,6 +31,15 @@ func (e ErrInfraServiceNotSupported) Error() string {
 	return fmt.Sprintf("invalid Infrastructure Service: %v", e.Service)
 }
 
+// ErrUnsupportedObject occurs when an infrastructure service object cannot be applied.
+type ErrUnsupportedObject struct {
+	Object runtime.Object
+}
+
+func (e ErrUnsupportedObject) Error() string {
+	return fmt.Sprintf("unable to apply object of type %T", e.Object)
+}
+
 // ErrMalformedRedfishAddress occurs when a Redfish address does not meet the expected format.
 type ErrMalformedRedfishAddress struct {
 	Address string
@@ -37,3 +48,219 @@ type ErrMalformedRedfishAddress struct {
 func (e ErrMalformedRedfishAddress) Error() string {
 	return fmt.Sprintf("invalid Redfish BMC address %s", e.Address)
 }
+
+// ErrMalformedLibvirtTLSSecret occurs when a libvirt TLS Secret does not contain a required certificate or key.
+type ErrMalformedLibvirtTLSSecret struct {
+	SecretName string
+	Key        string
+}
+
+func (e ErrMalformedLibvirtTLSSecret) Error() string {
+	return fmt.Sprintf("libvirt TLS secret %s is missing required key '%s'", e.SecretName, e.Key)
+}
+
+// ErrInvalidHypervisorAddress occurs when the hypervisor address mapped to a BMH is not a valid host name or IP.
+type ErrInvalidHypervisorAddress struct {
+	Host    string
+	Address string
+}
+
+func (e ErrInvalidHypervisorAddress) Error() string {
+	return fmt.Sprintf("invalid hypervisor address '%s' for host %s", e.Address, e.Host)
+}
+
+// ErrHostNotInSIPCluster occurs when an operation is requested for a host that is not scheduled to a SIPCluster.
+type ErrHostNotInSIPCluster struct {
+	Host       string
+	SIPCluster string
+}
+
+func (e ErrHostNotInSIPCluster) Error() string {
+	return fmt.Sprintf("host %s is not part of SIPCluster %s", e.Host, e.SIPCluster)
+}
+
+// ErrInvalidLoadBalancerFrontend occurs when a load balancer frontend is misconfigured.
+type ErrInvalidLoadBalancerFrontend struct {
+	Name   string
+	Reason string
+}
+
+func (e ErrInvalidLoadBalancerFrontend) Error() string {
+	return fmt.Sprintf("invalid load balancer frontend '%s': %s", e.Name, e.Reason)
+}
+
+// ErrInvalidLoadBalancerTemplate occurs when a user-supplied load balancer template is missing or cannot be rendered.
+type ErrInvalidLoadBalancerTemplate struct {
+	ConfigMapName string
+	Key           string
+	Err           error
+}
+
+func (e ErrInvalidLoadBalancerTemplate) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("load balancer template ConfigMap %s is missing key '%s'", e.ConfigMapName, e.Key)
+	}
+
+	return fmt.Sprintf("invalid load balancer template in ConfigMap %s key '%s': %v", e.ConfigMapName, e.Key, e.Err)
+}
+
+func (e ErrInvalidLoadBalancerTemplate) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidVirtualIP occurs when the virtual IP of a load balancer is not a valid IP address.
+type ErrInvalidVirtualIP struct {
+	Address string
+}
+
+func (e ErrInvalidVirtualIP) Error() string {
+	return fmt.Sprintf("invalid load balancer virtual IP '%s'", e.Address)
+}
+
+// ErrLoadBalancerStatsUnavailable occurs when the statistics of a load balancer cannot be retrieved.
+type ErrLoadBalancerStatsUnavailable struct {
+	URL        string
+	StatusCode int
+}
+
+func (e ErrLoadBalancerStatsUnavailable) Error() string {
+	return fmt.Sprintf("unable to retrieve load balancer statistics from %s: status code %d", e.URL, e.StatusCode)
+}
+
+// ErrServiceNotReady occurs when a deployed infrastructure service is not yet ready.
+type ErrServiceNotReady struct {
+	Service string
+	Reason  string
+}
+
+func (e ErrServiceNotReady) Error() string {
+	return fmt.Sprintf("%s service is not ready: %s", e.Service, e.Reason)
+}
+
+// ErrControlPlaneEndpointUnavailable occurs when no address is published for the load balancer frontend providing
+// the control plane endpoint of a Cluster API cluster.
+type ErrControlPlaneEndpointUnavailable struct {
+	Frontend string
+}
+
+func (e ErrControlPlaneEndpointUnavailable) Error() string {
+	return fmt.Sprintf("no address is published for load balancer frontend %s", e.Frontend)
+}
+
+// ErrUnknownServiceType occurs when a custom infrastructure service has a type that is not registered.
+type ErrUnknownServiceType struct {
+	Type       string
+	Registered []string
+}
+
+func (e ErrUnknownServiceType) Error() string {
+	return fmt.Sprintf("unknown infrastructure service type %q, registered types are %v", e.Type, e.Registered)
+}
+
+// ErrDuplicateCustomService occurs when custom infrastructure services of the same type have the same name, so that
+// they would deploy the same objects.
+type ErrDuplicateCustomService struct {
+	Type string
+	Name string
+}
+
+func (e ErrDuplicateCustomService) Error() string {
+	return fmt.Sprintf("custom infrastructure services of type %q must have unique names, %q is used more than once",
+		e.Type, e.Name)
+}
+
+// ErrInvalidServiceConfig occurs when the configuration of a custom infrastructure service is invalid for its type.
+type ErrInvalidServiceConfig struct {
+	Type string
+	Err  error
+}
+
+func (e ErrInvalidServiceConfig) Error() string {
+	return fmt.Sprintf("invalid configuration of %s infrastructure service: %v", e.Type, e.Err)
+}
+
+func (e ErrInvalidServiceConfig) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidManifestTemplate occurs when a manifest template cannot be rendered into Kubernetes objects.
+type ErrInvalidManifestTemplate struct {
+	ConfigMapName string
+	Key           string
+	Err           error
+}
+
+func (e ErrInvalidManifestTemplate) Error() string {
+	return fmt.Sprintf("invalid manifest template in ConfigMap %s key '%s': %v", e.ConfigMapName, e.Key, e.Err)
+}
+
+func (e ErrInvalidManifestTemplate) Unwrap() error {
+	return e.Err
+}
+
+// ErrMalformedRegistryTLSSecret occurs when a registry mirror TLS Secret does not contain a required certificate or
+// key.
+type ErrMalformedRegistryTLSSecret struct {
+	SecretName string
+	Key        string
+}
+
+func (e ErrMalformedRegistryTLSSecret) Error() string {
+	return fmt.Sprintf("registry mirror TLS secret %s is missing required key '%s'", e.SecretName, e.Key)
+}
+
+// ErrIPAddressInUse occurs when an address of an infrastructure service is already reserved by another
+// infrastructure service.
+type ErrIPAddressInUse struct {
+	Address string
+	Service string
+	// SIPCluster and OtherService identify the infrastructure service reserving the address.
+	SIPCluster   string
+	OtherService string
+}
+
+func (e ErrIPAddressInUse) Error() string {
+	return fmt.Sprintf("address %s of infrastructure service %s is already in use by infrastructure service %s of "+
+		"SIPCluster %s", e.Address, e.Service, e.OtherService, e.SIPCluster)
+}
+
+// ErrIPPoolExhausted occurs when an IP pool has no free address to allocate to an infrastructure service.
+type ErrIPPoolExhausted struct {
+	Pool    string
+	Service string
+}
+
+func (e ErrIPPoolExhausted) Error() string {
+	return fmt.Sprintf("IP pool %s has no free address for infrastructure service %s", e.Pool, e.Service)
+}
+
+// ErrInvalidIPPool occurs when an IP pool ConfigMap does not list valid CIDRs.
+type ErrInvalidIPPool struct {
+	Pool string
+	// CIDR is the invalid CIDR, if any. Pools without CIDRs are invalid too.
+	CIDR string
+}
+
+func (e ErrInvalidIPPool) Error() string {
+	if e.CIDR == "" {
+		return fmt.Sprintf("IP pool %s does not list any CIDR in key '%s'", e.Pool, IPPoolCIDRsKey)
+	}
+	return fmt.Sprintf("IP pool %s lists invalid CIDR '%s'", e.Pool, e.CIDR)
+}
+
+// ErrInsecurePowerProxyURL occurs when the power proxy URL of a jump host does not use HTTPS. The jump host token is
+// sent with every power action, so it must not be sent in the clear.
+type ErrInsecurePowerProxyURL struct {
+	URL string
+}
+
+func (e ErrInsecurePowerProxyURL) Error() string {
+	return fmt.Sprintf("power proxy URL %s must use https", e.URL)
+}
+
+// ErrPowerProxyCertificateRequired occurs when the power proxy is started without a serving certificate.
+type ErrPowerProxyCertificateRequired struct{}
+
+func (e ErrPowerProxyCertificateRequired) Error() string {
+	return "power proxy requires a serving certificate directory"
+}
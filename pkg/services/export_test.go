@@ -0,0 +1,33 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import "sigs.k8s.io/controller-runtime/pkg/client"
+
+// SetStatsURL overrides the URL of load balancer statistics for testing purposes. The returned function restores
+// the previous URL.
+func SetStatsURL(f func(service client.ObjectKey, port int) string) func() {
+	previous := statsURL
+	statsURL = f
+	return func() { statsURL = previous }
+}
+
+// SetProbeBackend overrides load balancer backend probes for testing purposes. The returned function restores the
+// previous probes.
+func SetProbeBackend(f func(address string) error) func() {
+	previous := probeBackend
+	probeBackend = f
+	return func() { probeBackend = previous }
+}
@@ -0,0 +1,298 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+)
+
+// IPPoolCIDRsKey is the key of the IP pool ConfigMaps listing the CIDRs of the pool.
+const IPPoolCIDRsKey = "cidrs"
+
+// ipRequest is an address used by an infrastructure service, either specified or to be allocated from a pool.
+type ipRequest struct {
+	service   string
+	allocType airshipv1.IPAllocationType
+	pool      *airshipv1.IPPoolReference
+	// address is the field of the SIPCluster spec holding the address.
+	address *string
+}
+
+// AllocateIPs reserves the cluster IPs and virtual IPs of the infrastructure services of a SIPCluster, and records
+// them in its status. Addresses not specified in the spec are allocated from the IP pools of the services and set in
+// the spec, so that the infrastructure services are deployed with them; the spec is not persisted. An address
+// previously allocated to a service is kept while it remains in the pool. Addresses reserved by other SIPClusters,
+// or by another service of the SIPCluster, are rejected. Allocations of services that no longer use an address are
+// released.
+//
+// The reservations of other SIPClusters are read from their status, so c should read from the API server rather than
+// from a cache, and the status should be persisted before the infrastructure services are deployed.
+func AllocateIPs(sip *airshipv1.SIPCluster, c client.Reader) error {
+	ctx := context.Background()
+	sipList := &airshipv1.SIPClusterList{}
+	if err := c.List(ctx, sipList); err != nil {
+		return err
+	}
+
+	// reserved maps each reserved address to the SIPCluster, as <namespace>/<name>, and service reserving it.
+	type reservation struct{ sip, service string }
+	reserved := map[string]reservation{}
+	self := sip.GetNamespace() + "/" + sip.GetName()
+	for _, other := range sipList.Items {
+		name := other.GetNamespace() + "/" + other.GetName()
+		if name == self {
+			continue
+		}
+		for _, allocation := range other.Status.IPAllocations {
+			reserved[normalizeIP(allocation.Address)] = reservation{sip: name, service: allocation.Service}
+		}
+	}
+
+	var allocations []airshipv1.IPAllocation
+	reserve := func(req ipRequest, address, pool string) error {
+		address = normalizeIP(address)
+		if r, exists := reserved[address]; exists {
+			return ErrIPAddressInUse{Address: address, Service: req.service, SIPCluster: r.sip, OtherService: r.service}
+		}
+		reserved[address] = reservation{sip: self, service: req.service}
+		allocations = append(allocations, airshipv1.IPAllocation{
+			Service: req.service,
+			Type:    req.allocType,
+			Address: address,
+			Pool:    pool,
+		})
+		return nil
+	}
+
+	// Specified addresses are reserved first, so that they are not allocated to another service from a pool.
+	requests := ipRequests(sip)
+	for _, req := range requests {
+		if *req.address == "" || net.ParseIP(*req.address) == nil {
+			continue
+		}
+		if err := reserve(req, *req.address, ""); err != nil {
+			return err
+		}
+	}
+
+	for _, req := range requests {
+		if *req.address != "" || req.pool == nil {
+			continue
+		}
+
+		pool, err := getIPPool(*req.pool, sip.GetNamespace(), c)
+		if err != nil {
+			return err
+		}
+
+		address := ""
+		for _, allocation := range sip.Status.IPAllocations {
+			if allocation.Service == req.service && allocation.Type == req.allocType &&
+				allocation.Pool == pool.name && pool.contains(allocation.Address) {
+				if _, exists := reserved[normalizeIP(allocation.Address)]; !exists {
+					address = allocation.Address
+				}
+				break
+			}
+		}
+		if address == "" {
+			address = pool.next(func(ip string) bool {
+				_, exists := reserved[ip]
+				return !exists
+			})
+			if address == "" {
+				return ErrIPPoolExhausted{Pool: pool.name, Service: req.service}
+			}
+		}
+
+		if err = reserve(req, address, pool.name); err != nil {
+			return err
+		}
+		*req.address = normalizeIP(address)
+	}
+
+	sip.Status.IPAllocations = allocations
+	return nil
+}
+
+// ipRequests returns the addresses used by the infrastructure services of a SIPCluster. Cluster IPs allocated from a
+// pool are set through the returned requests. Services are identified by their instance name rather than by their
+// position in the SIPCluster services, so that reordering services does not move their addresses.
+func ipRequests(sip *airshipv1.SIPCluster) []ipRequest {
+	var requests []ipRequest
+	clusterIP := func(service string, svc *airshipv1.SIPClusterService) {
+		if svc.ClusterIP == nil {
+			if svc.ClusterIPPool == nil {
+				return
+			}
+			svc.ClusterIP = new(string)
+		}
+		requests = append(requests, ipRequest{
+			service:   service,
+			allocType: airshipv1.IPAllocationClusterIP,
+			pool:      svc.ClusterIPPool,
+			address:   svc.ClusterIP,
+		})
+	}
+
+	services := &sip.Spec.Services
+	for i := range services.LoadBalancer {
+		lb := &services.LoadBalancer[i]
+		service := LoadBalancerServiceName + "-" + sip.GetName()
+		clusterIP(service, &lb.SIPClusterService)
+		if lb.VirtualIP != nil {
+			requests = append(requests, ipRequest{
+				service:   service,
+				allocType: airshipv1.IPAllocationVirtualIP,
+				pool:      lb.VirtualIP.AddressPool,
+				address:   &lb.VirtualIP.Address,
+			})
+		}
+	}
+	for i := range services.JumpHost {
+		clusterIP(JumpHostServiceName+"-"+sip.GetName(), &services.JumpHost[i].SIPClusterService)
+	}
+	for i := range services.Custom {
+		custom := &services.Custom[i]
+		ctx := ServiceContext{SIPCluster: *sip, name: custom.Name}
+		clusterIP(ctx.InstanceName(custom.Type), &custom.SIPClusterService)
+	}
+
+	return requests
+}
+
+// ipPool is an IP pool read from its ConfigMap.
+type ipPool struct {
+	// name is the pool as <namespace>/<name>.
+	name  string
+	cidrs []*net.IPNet
+}
+
+func getIPPool(ref airshipv1.IPPoolReference, namespace string, c client.Reader) (*ipPool, error) {
+	if ref.Namespace != "" {
+		namespace = ref.Namespace
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: ref.Name},
+		configMap); err != nil {
+		return nil, err
+	}
+
+	pool := &ipPool{name: namespace + "/" + ref.Name}
+	for _, cidr := range strings.Fields(configMap.Data[IPPoolCIDRsKey]) {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, ErrInvalidIPPool{Pool: pool.name, CIDR: cidr}
+		}
+		pool.cidrs = append(pool.cidrs, ipNet)
+	}
+	if len(pool.cidrs) == 0 {
+		return nil, ErrInvalidIPPool{Pool: pool.name}
+	}
+
+	return pool, nil
+}
+
+// contains reports whether an address is allocatable from the pool.
+func (p *ipPool) contains(address string) bool {
+	ip := net.ParseIP(address)
+	for _, cidr := range p.cidrs {
+		if cidr.Contains(ip) && !isReservedIPv4(cidr, ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// next returns the first allocatable address of the pool that is free, or an empty string when there is none.
+func (p *ipPool) next(free func(ip string) bool) string {
+	for _, cidr := range p.cidrs {
+		for ip := cloneIP(cidr.IP); cidr.Contains(ip); ip = nextIP(ip) {
+			if !isReservedIPv4(cidr, ip) && free(ip.String()) {
+				return ip.String()
+			}
+			if isLastIP(ip) {
+				break
+			}
+		}
+	}
+
+	return ""
+}
+
+// isReservedIPv4 reports whether an address is the network or broadcast address of an IPv4 CIDR with more than two
+// addresses.
+func isReservedIPv4(cidr *net.IPNet, ip net.IP) bool {
+	ones, bits := cidr.Mask.Size()
+	if bits != 8*net.IPv4len || ones >= 31 {
+		return false
+	}
+
+	ip = ip.To4()
+	if ip == nil {
+		return false
+	}
+	network, broadcast := true, true
+	for i := range ip {
+		network = network && ip[i] == cidr.IP.To4()[i]
+		broadcast = broadcast && ip[i] == cidr.IP.To4()[i]|^cidr.Mask[i]
+	}
+
+	return network || broadcast
+}
+
+func cloneIP(ip net.IP) net.IP {
+	return append(net.IP{}, ip...)
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := cloneIP(ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+
+	return next
+}
+
+func isLastIP(ip net.IP) bool {
+	for _, b := range ip {
+		if b != 0xff {
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalizeIP returns the canonical form of an address, so that equal addresses are compared equal.
+func normalizeIP(address string) string {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+
+	return address
+}
@@ -15,13 +15,24 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
 
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -33,13 +44,47 @@ import (
 const (
 	JumpHostServiceName = "jumphost"
 
-	mountPathData    = "/etc/opt/sip"
-	mountPathScripts = "/opt/sip/bin"
+	mountPathData       = "/etc/opt/sip"
+	mountPathScripts    = "/opt/sip/bin"
+	mountPathLibvirtTLS = "/etc/pki/sip"
+	mountPathAudit      = "/var/log/sip"
+	mountPathProfile    = "/etc/profile.d/sip-audit.sh"
+	// mountPathServiceAccount is where Kubernetes mounts the service account token of a pod.
+	mountPathServiceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// defaultServiceAccountName is the service account of jump hosts that do not record power action Events. It is
+	// set explicitly, since Kubernetes restores a service account removed from a pod template from its deprecated
+	// serviceAccount field.
+	defaultServiceAccountName = "default"
 
-	nameHostsVolume  = "hosts"
-	nameRebootVolume = "vm"
+	nameHostsVolume        = "hosts"
+	nameRebootVolume       = "vm"
+	nameConsoleScript      = "console"
+	nameLibvirtTLSVolume   = "libvirt-tls"
+	nameTokenFile          = "token"
+	namePowerProxyCAFile   = "power-proxy-ca.crt"
+	nameAuditVolume        = "audit"
+	nameAuditScript        = "audit"
+	nameAuditProfile       = "audit-profile"
+	nameAuditPipe          = "audit.pipe"
+	nameAuditContainer     = "audit"
+	nameAuditWriterScript  = "audit-writer"
+	nameServiceAccountMask = "service-account-mask"
+
+	// DefaultConsoleLogPool is the libvirt storage pool used to retrieve VM console logs when none is specified.
+	DefaultConsoleLogPool = "console-logs"
+)
+
+// Keys used to retrieve libvirt client certificates from the libvirt TLS secret. These file names are expected by
+// libvirt when a pkipath is provided in the connection URI.
+const (
+	keyLibvirtCACert     = "cacert.pem"
+	keyLibvirtClientCert = "clientcert.pem"
+	keyLibvirtClientKey  = "clientkey.pem"
 )
 
+// hypervisorAddress matches host names, IPv4 addresses, and bracketed IPv6 addresses with an optional port.
+var hypervisorAddress = regexp.MustCompile(`^([A-Za-z0-9.-]+|\[[0-9A-Fa-f:.]+\])(:[0-9]+)?$`)
+
 // JumpHost is an InfrastructureService that provides SSH and power-management capabilities for sub-clusters.
 type jumpHost struct {
 	client   client.Client
@@ -47,24 +92,34 @@ type jumpHost struct {
 	logger   logr.Logger
 	config   airshipv1.JumpHostService
 	machines *airshipvms.MachineList
+
+	// sipNamespace is the namespace of the SIPCluster, which holds Secrets referenced by the service configuration.
+	sipNamespace string
+	owner        owner
 }
 
-func newJumpHost(name, namespace string, logger logr.Logger, config airshipv1.JumpHostService,
-	machines *airshipvms.MachineList, client client.Client) InfraService {
+func newJumpHost(name, sipNamespace, namespace string, logger logr.Logger, config airshipv1.JumpHostService,
+	machines *airshipvms.MachineList, client client.Client, owner owner) InfraService {
 	return jumpHost{
 		sipName: types.NamespacedName{
 			Name:      name,
 			Namespace: namespace,
 		},
-		logger:   logger,
-		config:   config,
-		machines: machines,
-		client:   client,
+		sipNamespace: sipNamespace,
+		logger:       logger,
+		config:       config,
+		machines:     machines,
+		client:       client,
+		owner:        owner,
 	}
 }
 
 // Deploy creates a JumpHost service in the base cluster.
 func (jh jumpHost) Deploy() error {
+	if err := jh.validatePowerProxyURL(); err != nil {
+		return err
+	}
+
 	instance := JumpHostServiceName + "-" + jh.sipName.Name
 	labels := map[string]string{
 		// See https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/#labels
@@ -77,8 +132,7 @@ func (jh jumpHost) Deploy() error {
 	// TODO: Validate Deployment becomes ready.
 	deployment := jh.generateDeployment(instance, labels)
 	jh.logger.Info("Applying deployment", "deployment", deployment.GetNamespace()+"/"+deployment.GetName())
-	err := applyRuntimeObject(client.ObjectKey{Name: deployment.GetName(), Namespace: deployment.GetNamespace()},
-		deployment, jh.client)
+	err := applyRuntimeObject(deployment, jh.client, jh.owner)
 	if err != nil {
 		return err
 	}
@@ -86,8 +140,7 @@ func (jh jumpHost) Deploy() error {
 	// TODO: Validate Service becomes ready.
 	service := jh.generateService(instance, labels)
 	jh.logger.Info("Applying service", "service", service.GetNamespace()+"/"+service.GetName())
-	err = applyRuntimeObject(client.ObjectKey{Name: service.GetName(), Namespace: service.GetNamespace()},
-		service, jh.client)
+	err = applyRuntimeObject(service, jh.client, jh.owner)
 	if err != nil {
 		return err
 	}
@@ -99,21 +152,130 @@ func (jh jumpHost) Deploy() error {
 	}
 
 	jh.logger.Info("Applying secret", "secret", secret.GetNamespace()+"/"+secret.GetName())
-	err = applyRuntimeObject(client.ObjectKey{Name: secret.GetName(), Namespace: secret.GetNamespace()},
-		secret, jh.client)
+	err = applyRuntimeObject(secret, jh.client, jh.owner)
 	if err != nil {
 		return err
 	}
 
+	if jh.config.Libvirt != nil {
+		var tlsSecret *corev1.Secret
+		tlsSecret, err = jh.generateLibvirtTLSSecret(instance, labels)
+		if err != nil {
+			return err
+		}
+
+		jh.logger.Info("Applying libvirt TLS secret", "secret", tlsSecret.GetNamespace()+"/"+tlsSecret.GetName())
+		err = applyRuntimeObject(tlsSecret, jh.client, jh.owner)
+		if err != nil {
+			return err
+		}
+	}
+
 	// TODO: Validate ConfigMap becomes ready.
-	configMap := jh.generateConfigMap(instance, labels)
+	configMap, err := jh.generateConfigMap(instance, labels)
+	if err != nil {
+		return err
+	}
+
 	jh.logger.Info("Applying configmap", "configmap", configMap.GetNamespace()+"/"+configMap.GetName())
-	err = applyRuntimeObject(client.ObjectKey{Name: configMap.GetName(), Namespace: configMap.GetNamespace()},
-		secret, jh.client)
+	err = applyRuntimeObject(configMap, jh.client, jh.owner)
 	if err != nil {
 		return err
 	}
 
+	if !jh.recordsPowerEvents() {
+		return jh.deletePowerEventsRBAC(instance)
+	}
+
+	for _, obj := range jh.generatePowerEventsRBAC(instance, labels) {
+		jh.logger.Info("Applying power action events access", "kind", fmt.Sprintf("%T", obj),
+			"object", obj.GetNamespace()+"/"+obj.GetName())
+		if err = applyRuntimeObject(obj, jh.client, jh.owner); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordsPowerEvents reports whether the jump host records power actions as Events of the SIPCluster. Power actions
+// sent to the power proxy are recorded by the power proxy instead.
+func (jh jumpHost) recordsPowerEvents() bool {
+	return jh.config.SessionLogging && jh.powerProxyURL() == ""
+}
+
+// generatePowerEventsRBAC returns the service account of the jump host audit container, and the Role and RoleBinding
+// allowing it to create Events in the namespace of the SIPCluster.
+func (jh jumpHost) generatePowerEventsRBAC(instance string, labels map[string]string) []client.Object {
+	return []client.Object{
+		&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      instance,
+				Namespace: jh.sipName.Namespace,
+				Labels:    labels,
+			},
+		},
+		&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      instance,
+				Namespace: jh.sipNamespace,
+				Labels:    labels,
+			},
+			Rules: []rbacv1.PolicyRule{
+				{
+					APIGroups: []string{corev1.GroupName},
+					Resources: []string{"events"},
+					Verbs:     []string{"create"},
+				},
+			},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      instance,
+				Namespace: jh.sipNamespace,
+				Labels:    labels,
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "Role",
+				Name:     instance,
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind:      rbacv1.ServiceAccountKind,
+					Name:      instance,
+					Namespace: jh.sipName.Namespace,
+				},
+			},
+		},
+	}
+}
+
+// deletePowerEventsRBAC deletes the service account, Role and RoleBinding used to record power action Events. The
+// Role and RoleBinding are in the namespace of the SIPCluster, so they are not deleted with the namespace of the
+// sub-cluster. Objects of the same name that were not applied by SIP for the SIPCluster are left in place.
+func (jh jumpHost) deletePowerEventsRBAC(instance string) error {
+	ctx := context.Background()
+	for _, obj := range jh.generatePowerEventsRBAC(instance, nil) {
+		err := jh.client.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		if apierror.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		labels := obj.GetLabels()
+		if labels[SIPClusterNameLabel] != jh.owner.sip.GetName() ||
+			labels[SIPClusterNamespaceLabel] != jh.owner.sip.GetNamespace() {
+			continue
+		}
+
+		if err = jh.client.Delete(ctx, obj); err != nil && !apierror.IsNotFound(err) {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -127,6 +289,7 @@ func (jh jumpHost) generateDeployment(instance string, labels map[string]string)
 			{
 				Name:          "ssh",
 				ContainerPort: 22,
+				Protocol:      corev1.ProtocolTCP,
 			},
 		},
 		VolumeMounts: []corev1.VolumeMount{
@@ -161,6 +324,103 @@ func (jh jumpHost) generateDeployment(instance string, labels map[string]string)
 		}
 	}
 
+	volumes := []corev1.Volume{
+		{
+			Name: nameHostsVolume,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: instance,
+				},
+			},
+		},
+		{
+			Name: nameRebootVolume,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: instance,
+					},
+					DefaultMode: int32Ptr(0777),
+				},
+			},
+		},
+	}
+
+	// Mount libvirt client certificates when console access is enabled.
+	if jh.config.Libvirt != nil {
+		jhContainer.VolumeMounts = append(jhContainer.VolumeMounts, corev1.VolumeMount{
+			Name:      nameLibvirtTLSVolume,
+			MountPath: mountPathLibvirtTLS,
+			ReadOnly:  true,
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: nameLibvirtTLSVolume,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  instance + "-" + nameLibvirtTLSVolume,
+					DefaultMode: int32Ptr(0400),
+				},
+			},
+		})
+	}
+
+	// Audit records are written by jump host users to a pipe read by the audit container, which forwards them to its
+	// output, where they are picked up by log collection. Records that were forwarded cannot be rewritten from the jump
+	// host, and unprivileged users can only write to the pipe. Root in the jump host container is not restricted by
+	// the permissions of the pipe, and can read or replace it.
+	containers := []corev1.Container{jhContainer}
+	serviceAccountName := defaultServiceAccountName
+	if jh.config.SessionLogging {
+		containers[0].VolumeMounts = append(containers[0].VolumeMounts,
+			corev1.VolumeMount{
+				Name:      nameAuditVolume,
+				MountPath: mountPathAudit,
+			},
+			corev1.VolumeMount{
+				Name:      nameRebootVolume,
+				MountPath: mountPathProfile,
+				SubPath:   nameAuditProfile,
+				ReadOnly:  true,
+			})
+		containers = append(containers, corev1.Container{
+			Name:    nameAuditContainer,
+			Image:   jh.config.Image,
+			Command: []string{"/bin/sh", mountPathScripts + "/" + nameAuditWriterScript},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      nameAuditVolume,
+					MountPath: mountPathAudit,
+				},
+				{
+					Name:      nameRebootVolume,
+					MountPath: mountPathScripts,
+				},
+			},
+		})
+		volumes = append(volumes, corev1.Volume{
+			Name: nameAuditVolume,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+
+		// Power actions performed directly with redfishtool are recorded as Events by the audit container, with a
+		// service account whose token is hidden from jump host users.
+		if jh.recordsPowerEvents() {
+			serviceAccountName = instance
+			containers[0].VolumeMounts = append(containers[0].VolumeMounts, corev1.VolumeMount{
+				Name:      nameServiceAccountMask,
+				MountPath: mountPathServiceAccount,
+			})
+			volumes = append(volumes, corev1.Volume{
+				Name: nameServiceAccountMask,
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{},
+				},
+			})
+		}
+	}
+
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      instance,
@@ -177,38 +437,47 @@ func (jh jumpHost) generateDeployment(instance string, labels map[string]string)
 					Labels: labels,
 				},
 				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						jhContainer,
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: nameHostsVolume,
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{
-									SecretName: instance,
-								},
-							},
-						},
-						{
-							Name: nameRebootVolume,
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: &corev1.ConfigMapVolumeSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: instance,
-									},
-									DefaultMode: int32Ptr(0777),
-								},
-							},
-						},
-					},
-					HostAliases: jh.generateHostAliases(),
+					Containers:         containers,
+					Volumes:            volumes,
+					HostAliases:        jh.generateHostAliases(),
+					ServiceAccountName: serviceAccountName,
 				},
 			},
 		},
 	}
 }
 
-func (jh jumpHost) generateConfigMap(instance string, labels map[string]string) *corev1.ConfigMap {
+func (jh jumpHost) generateConfigMap(instance string, labels map[string]string) (*corev1.ConfigMap, error) {
+	auditPath := mountPathScripts + "/" + nameAuditScript
+	data := map[string]string{
+		nameRebootVolume: fmt.Sprintf(rebootScript, mountPathData, nameHostsVolume, auditPath),
+	}
+
+	// Power actions are sent to the SIP power proxy when it is configured, so the jump host never needs BMC
+	// credentials.
+	if proxyURL := jh.powerProxyURL(); proxyURL != "" {
+		data[nameRebootVolume] = fmt.Sprintf(powerProxyScript, mountPathData, nameHostsVolume, mountPathData,
+			nameTokenFile, mountPathData, namePowerProxyCAFile, proxyURL, auditPath)
+	}
+
+	if jh.config.SessionLogging {
+		data[nameAuditScript] = fmt.Sprintf(auditScript, mountPathAudit+"/"+nameAuditPipe)
+		jumpHost := jh.sipName.Namespace + "/" + JumpHostServiceName + "-" + jh.sipName.Name
+		data[nameAuditWriterScript] = fmt.Sprintf(auditWriterScript, mountPathAudit+"/"+nameAuditPipe,
+			jh.recordsPowerEvents(), airshipv1.GroupVersion.String(), jh.sipNamespace, jh.owner.sip.GetName(),
+			jh.owner.sip.GetUID(), jumpHost, mountPathServiceAccount)
+		data[nameAuditProfile] = fmt.Sprintf(auditProfile, auditPath, auditPath)
+	}
+
+	if jh.config.Libvirt != nil {
+		script, err := jh.generateConsoleScript()
+		if err != nil {
+			return nil, err
+		}
+
+		data[nameConsoleScript] = script
+	}
+
 	return &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: corev1.SchemeGroupVersion.String(),
@@ -219,18 +488,120 @@ func (jh jumpHost) generateConfigMap(instance string, labels map[string]string)
 			Namespace: jh.sipName.Namespace,
 			Labels:    labels,
 		},
-		Data: map[string]string{
-			nameRebootVolume: fmt.Sprintf(rebootScript, mountPathData, nameHostsVolume),
+		Data: data,
+	}, nil
+}
+
+// generateLibvirtTLSSecret copies the libvirt client certificates referenced by the jump host configuration into
+// the jump host namespace so they can be mounted by the jump host pod.
+func (jh jumpHost) generateLibvirtTLSSecret(instance string, labels map[string]string) (*corev1.Secret, error) {
+	ref := jh.config.Libvirt.TLSSecretRef
+	source := &corev1.Secret{}
+	err := jh.client.Get(context.Background(), client.ObjectKey{Name: ref.Name, Namespace: jh.sipNamespace}, source)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{}
+	for _, key := range []string{keyLibvirtCACert, keyLibvirtClientCert, keyLibvirtClientKey} {
+		value, exists := source.Data[key]
+		if !exists {
+			return nil, ErrMalformedLibvirtTLSSecret{SecretName: ref.Name, Key: key}
+		}
+		data[key] = value
+	}
+
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
 		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance + "-" + nameLibvirtTLSVolume,
+			Namespace: jh.sipName.Namespace,
+			Labels:    labels,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}, nil
+}
+
+type consoleHost struct {
+	Name string
+	URI  string
+}
+
+// generateConsoleScript renders a script with console log and console attach commands for each sub-cluster VM that
+// has a known hypervisor. Hosts that are not scheduled to the SIPCluster are never included.
+func (jh jumpHost) generateConsoleScript() (string, error) {
+	hosts := []consoleHost{}
+	for name := range jh.machines.Machines {
+		hypervisor, exists := jh.config.Libvirt.Hypervisors[name]
+		if !exists {
+			jh.logger.Info("Machine does not have a hypervisor mapping, skipping console access", "machine", name)
+			continue
+		}
+
+		if !hypervisorAddress.MatchString(hypervisor) {
+			return "", ErrInvalidHypervisorAddress{Host: name, Address: hypervisor}
+		}
+
+		hosts = append(hosts, consoleHost{
+			Name: name,
+			URI:  fmt.Sprintf("qemu+tls://%s/system?pkipath=%s", hypervisor, mountPathLibvirtTLS),
+		})
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+
+	pool := jh.config.Libvirt.ConsoleLogPool
+	if pool == "" {
+		pool = DefaultConsoleLogPool
+	}
+
+	tmpl, err := template.New(nameConsoleScript).Parse(consoleScript)
+	if err != nil {
+		return "", err
 	}
+
+	w := bytes.NewBuffer([]byte{})
+	err = tmpl.Execute(w, struct {
+		Pool  string
+		Hosts []consoleHost
+	}{
+		Pool:  pool,
+		Hosts: hosts,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return w.String(), nil
 }
 
 func (jh jumpHost) generateSecret(instance string, labels map[string]string) (*corev1.Secret, error) {
-	hostData, err := generateHostList(*jh.machines)
+	proxyURL := jh.powerProxyURL()
+	hostData, err := generateHostList(*jh.machines, proxyURL == "")
 	if err != nil {
 		return nil, err
 	}
 
+	data := map[string][]byte{
+		nameHostsVolume: hostData,
+	}
+
+	if proxyURL != "" {
+		var token []byte
+		token, err = jh.powerProxyToken(instance)
+		if err != nil {
+			return nil, err
+		}
+
+		data[nameTokenFile] = token
+		if ca := jh.config.BMC.PowerProxyCABundle; ca != "" {
+			data[namePowerProxyCAFile] = []byte(ca)
+		}
+	}
+
 	return &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: corev1.SchemeGroupVersion.String(),
@@ -241,19 +612,65 @@ func (jh jumpHost) generateSecret(instance string, labels map[string]string) (*c
 			Namespace: jh.sipName.Namespace,
 			Labels:    labels,
 		},
-		Data: map[string][]byte{
-			nameHostsVolume: hostData,
-		},
+		Data: data,
 	}, nil
 }
 
+// powerProxyURL returns the base URL of the SIP power proxy endpoints for this SIPCluster, or an empty string when
+// the power proxy is not configured.
+func (jh jumpHost) powerProxyURL() string {
+	if jh.config.BMC == nil || jh.config.BMC.PowerProxyURL == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/v1/sipclusters/%s/%s", strings.TrimSuffix(jh.config.BMC.PowerProxyURL, "/"),
+		jh.sipNamespace, jh.sipName.Name)
+}
+
+// validatePowerProxyURL verifies that the power proxy URL, when configured, uses HTTPS.
+func (jh jumpHost) validatePowerProxyURL() error {
+	if jh.config.BMC == nil || jh.config.BMC.PowerProxyURL == "" {
+		return nil
+	}
+
+	proxyURL, err := url.Parse(jh.config.BMC.PowerProxyURL)
+	if err != nil || proxyURL.Scheme != "https" || proxyURL.Host == "" {
+		return ErrInsecurePowerProxyURL{URL: jh.config.BMC.PowerProxyURL}
+	}
+
+	return nil
+}
+
+// powerProxyToken returns the token used by the jump host to authenticate with the SIP power proxy. An existing token
+// is reused so that redeploying the jump host does not invalidate it.
+func (jh jumpHost) powerProxyToken(instance string) ([]byte, error) {
+	existing := &corev1.Secret{}
+	err := jh.client.Get(context.Background(), client.ObjectKey{Name: instance, Namespace: jh.sipName.Namespace},
+		existing)
+	switch {
+	case err == nil:
+		if token, exists := existing.Data[nameTokenFile]; exists && len(token) > 0 {
+			return token, nil
+		}
+	case !apierror.IsNotFound(err):
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return nil, err
+	}
+
+	return []byte(hex.EncodeToString(raw)), nil
+}
+
 func (jh jumpHost) generateHostAliases() []corev1.HostAlias {
 	hostAliases := []corev1.HostAlias{}
 	for _, machine := range jh.machines.Machines {
 		namespace := machine.BMH.Namespace
 		name := machine.BMH.Name
-		ip, exists := machine.Data.IPOnInterface[jh.config.NodeInterface]
-		if !exists {
+		ips := machine.Data.IPs(jh.config.NodeInterface, jh.config.IPFamily)
+		if len(ips) == 0 {
 			jh.logger.Info("Machine does not have ip to be aliased",
 				"interface", jh.config.NodeInterface,
 				"machine", namespace+"/"+name,
@@ -261,13 +678,15 @@ func (jh jumpHost) generateHostAliases() []corev1.HostAlias {
 			continue
 		}
 		hostname := machine.BMH.Name
-		hostAliases = append(hostAliases, corev1.HostAlias{IP: ip, Hostnames: []string{hostname}})
+		for _, ip := range ips {
+			hostAliases = append(hostAliases, corev1.HostAlias{IP: ip, Hostnames: []string{hostname}})
+		}
 	}
 	return hostAliases
 }
 
 func (jh jumpHost) generateService(instance string, labels map[string]string) *corev1.Service {
-	return &corev1.Service{
+	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      instance,
 			Namespace: jh.sipName.Namespace,
@@ -277,6 +696,7 @@ func (jh jumpHost) generateService(instance string, labels map[string]string) *c
 				{
 					Name:     "ssh",
 					Port:     22,
+					Protocol: corev1.ProtocolTCP,
 					NodePort: int32(jh.config.NodePort),
 				},
 			},
@@ -284,17 +704,50 @@ func (jh jumpHost) generateService(instance string, labels map[string]string) *c
 			Type:     corev1.ServiceTypeNodePort,
 		},
 	}
+	if jh.config.ClusterIP != nil {
+		service.Spec.ClusterIP = *jh.config.ClusterIP
+	}
+
+	return service
+}
+
+// Ready verifies that the jump host Deployment is available and reachable through its Service.
+func (jh jumpHost) Ready() error {
+	key := client.ObjectKey{Name: JumpHostServiceName + "-" + jh.sipName.Name, Namespace: jh.sipName.Namespace}
+	if err := deploymentReady(JumpHostServiceName, key, jh.client); err != nil {
+		return err
+	}
+
+	return endpointsReady(JumpHostServiceName, key, jh.client)
+}
+
+// ReportStatus reports the SSH endpoint of the jump host.
+func (jh jumpHost) ReportStatus(status *airshipv1.SIPClusterStatus) error {
+	instance := JumpHostServiceName + "-" + jh.sipName.Name
+	endpoints, err := serviceEndpoints(client.ObjectKey{Name: instance, Namespace: jh.sipName.Namespace}, jh.client,
+		nil)
+	if err != nil {
+		return err
+	}
+
+	setEndpoints(status, instance, endpoints)
+	return nil
+}
+
+// ConditionType returns the SIPCluster status condition type reporting the readiness of the jump host.
+func (jh jumpHost) ConditionType() string {
+	return airshipv1.ConditionTypeJumpHostReady
 }
 
 // Finalize removes a deployed JumpHost service.
 func (jh jumpHost) Finalize() error {
 	// TODO(drewwalters96): Add logic to cleanup SIPCluster JumpHost pod.
-	return nil
+	return jh.deletePowerEventsRBAC(JumpHostServiceName + "-" + jh.sipName.Name)
 }
 
 type host struct {
 	Name string `json:"name"`
-	BMC  bmc    `json:"bmc"`
+	BMC  *bmc   `json:"bmc,omitempty"`
 }
 
 type bmc struct {
@@ -304,26 +757,30 @@ type bmc struct {
 }
 
 // generateHostList creates a list of hosts in JSON format to be mounted as a config map to the jump host pod and used
-// to power cycle sub-cluster nodes.
-func generateHostList(machineList airshipvms.MachineList) ([]byte, error) {
-	hosts := make([]host, len(machineList.Machines))
+// to power cycle sub-cluster nodes. BMC information is only included when includeBMC is set.
+func generateHostList(machineList airshipvms.MachineList, includeBMC bool) ([]byte, error) {
+	hosts := make([]host, 0, len(machineList.Machines))
 	for name, machine := range machineList.Machines {
-		managementIP, err := getManagementIP(machine.BMH.Spec.BMC.Address)
-		if err != nil {
-			return nil, err
-		}
-
 		h := host{
 			Name: name,
-			BMC: bmc{
+		}
+
+		if includeBMC {
+			managementIP, err := getManagementIP(machine.BMH.Spec.BMC.Address)
+			if err != nil {
+				return nil, err
+			}
+
+			h.BMC = &bmc{
 				IP:       managementIP,
 				Username: machine.Data.BMCUsername,
 				Password: machine.Data.BMCPassword,
-			},
+			}
 		}
 
 		hosts = append(hosts, h)
 	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
 
 	out, err := json.Marshal(hosts)
 	if err != nil {
@@ -350,6 +807,7 @@ var rebootScript = `#!/bin/sh
 # DO NOT MODIFY: generated by SIP
 
 HOSTS_FILE="%s/%s"
+AUDIT_COMMAND="%s"
 
 LIST_COMMAND="list"
 REBOOT_COMMAND="reboot"
@@ -373,6 +831,16 @@ dep_check() {
   fi
 }
 
+audit() {
+  if [ -x "${AUDIT_COMMAND}" ]; then
+    if [ "$3" = "0" ]; then
+      "${AUDIT_COMMAND}" power "$1" "$2" succeeded
+    else
+      "${AUDIT_COMMAND}" power "$1" "$2" failed
+    fi
+  fi
+}
+
 get_bmc_info() {
   for host in $(jq -r -c '.[]' ${HOSTS_FILE}); do
     if [ "$(echo "$host" | jq -r '.name')" = "$1" ]; then
@@ -393,7 +861,9 @@ reboot() {
   echo "Rebooting host '$1'"
   redfishtool -r "${addr}" -u "${user}" -p "${pass}" \
     Systems reset GracefulRestart -vvvvv
-  exit 0
+  result=$?
+  audit "$1" reboot "${result}"
+  exit ${result}
 }
 
 case $1 in
@@ -416,6 +886,266 @@ case $1 in
 esac
 `
 
+var powerProxyScript = `#!/bin/sh
+
+# Support Infrastructure Provider (SIP) VM Utility
+# DO NOT MODIFY: generated by SIP
+
+HOSTS_FILE="%s/%s"
+TOKEN_FILE="%s/%s"
+CA_FILE="%s/%s"
+POWER_PROXY_URL="%s"
+AUDIT_COMMAND="%s"
+
+LIST_COMMAND="list"
+REBOOT_COMMAND="reboot"
+
+help() {
+  echo "Support Infrastructure Provider (SIP) VM Utility"
+  echo ""
+  echo "Usage: ${LIST_COMMAND}                      list hosts"
+  echo "       ${REBOOT_COMMAND} [host name]        reboot host"
+}
+
+dep_check() {
+  if [ "$(which jq)" = "" ]; then
+    echo "Missing package 'jq'. Update your JumpHost image to include 'jq' and 'curl'."
+    exit 1
+  fi
+
+  if [ "$(which curl)" = "" ]; then
+    echo "Missing package 'curl'. Update your JumpHost image to include 'jq' and 'curl'."
+    exit 1
+  fi
+}
+
+audit() {
+  if [ -x "${AUDIT_COMMAND}" ]; then
+    if [ "$3" = "0" ]; then
+      "${AUDIT_COMMAND}" power "$1" "$2" succeeded
+    else
+      "${AUDIT_COMMAND}" power "$1" "$2" failed
+    fi
+  fi
+}
+
+reboot() {
+  if [ "$(jq -r --arg name "$1" '.[] | select(.name == $name) | .name' ${HOSTS_FILE})" = "" ]; then
+    echo "Invalid host '$1'. Use the '${LIST_COMMAND}' command to view hosts."
+    exit 1
+  fi
+
+  echo "Rebooting host '$1'"
+  ca_opts=""
+  if [ -f "${CA_FILE}" ]; then
+    ca_opts="--cacert ${CA_FILE}"
+  fi
+  curl --silent --show-error --fail -X POST ${ca_opts} \
+    -H "Authorization: Bearer $(cat ${TOKEN_FILE})" \
+    "${POWER_PROXY_URL}/hosts/$1/reboot"
+  result=$?
+  audit "$1" reboot "${result}"
+  exit ${result}
+}
+
+case $1 in
+  "${LIST_COMMAND}")
+    dep_check
+    jq -r '.[].name' ${HOSTS_FILE}
+    ;;
+  "${REBOOT_COMMAND}")
+    if [ "$2" = "" ]; then
+      printf "Host name required.\n\n"
+      help
+      exit 1
+    fi
+    dep_check
+    reboot "$2"
+    ;;
+  *)
+    help
+    ;;
+esac
+`
+
+// auditWriterScript is run by the audit container. It creates the audit pipe, forwards the records written to it to
+// the container output, and records power actions as Events of the SIPCluster when enabled.
+var auditWriterScript = `#!/bin/sh
+
+# Support Infrastructure Provider (SIP) Audit Writer
+# DO NOT MODIFY: generated by SIP
+
+AUDIT_PIPE="%s"
+RECORD_EVENTS="%t"
+SIP_API_VERSION="%s"
+SIP_NAMESPACE="%s"
+SIP_NAME="%s"
+SIP_UID="%s"
+JUMP_HOST="%s"
+SERVICE_ACCOUNT="%s"
+
+record_event() {
+  event=$(echo "$1" | jq -c \
+    --arg apiVersion "${SIP_API_VERSION}" \
+    --arg namespace "${SIP_NAMESPACE}" \
+    --arg name "${SIP_NAME}" \
+    --arg uid "${SIP_UID}" \
+    --arg jumpHost "${JUMP_HOST}" \
+    'select(.event == "power") | {
+      apiVersion: "v1",
+      kind: "Event",
+      metadata: {generateName: ($name + "."), namespace: $namespace},
+      involvedObject: {apiVersion: $apiVersion, kind: "SIPCluster", namespace: $namespace, name: $name, uid: $uid},
+      type: (if .result == "succeeded" then "Normal" else "Warning" end),
+      reason: (if .result == "succeeded" then "PowerAction" else "PowerActionFailed" end),
+      message: "\(.action) of host \(.host) requested by \(.user) on jump host \($jumpHost) \(.result)",
+      firstTimestamp: .time,
+      lastTimestamp: .time,
+      count: 1,
+      source: {component: "sip-jump-host"}
+    }')
+  if [ -z "${event}" ]; then
+    return
+  fi
+
+  curl --silent --show-error --fail -o /dev/null -X POST \
+    --cacert "${SERVICE_ACCOUNT}/ca.crt" \
+    -H "Authorization: Bearer $(cat "${SERVICE_ACCOUNT}/token")" \
+    -H "Content-Type: application/json" \
+    -d "${event}" \
+    "https://kubernetes.default.svc/api/v1/namespaces/${SIP_NAMESPACE}/events" ||
+    echo "Unable to record power action event" >&2
+}
+
+# Unprivileged jump host users may write to the pipe, but may neither read it nor replace it. Root is not
+# restricted by these permissions.
+chmod 0755 "$(dirname "${AUDIT_PIPE}")"
+rm -f "${AUDIT_PIPE}"
+mkfifo -m 0622 "${AUDIT_PIPE}"
+
+# The pipe is opened for reading and writing, so that it is not closed when writers close it.
+exec 3<> "${AUDIT_PIPE}"
+while IFS= read -r record <&3; do
+  echo "${record}"
+  if [ "${RECORD_EVENTS}" = "true" ]; then
+    record_event "${record}"
+  fi
+done
+`
+
+var auditScript = `#!/bin/sh
+
+# Support Infrastructure Provider (SIP) Audit Utility
+# DO NOT MODIFY: generated by SIP
+#
+# Usage: audit [event] [host] [action] [result]
+
+AUDIT_LOG="%s"
+
+jq -n -c \
+  --arg time "$(date -u +%%Y-%%m-%%dT%%H:%%M:%%SZ)" \
+  --arg event "$1" \
+  --arg user "$(id -un)" \
+  --arg remote "$(echo "${SSH_CLIENT}" | cut -d ' ' -f 1)" \
+  --arg host "$2" \
+  --arg action "$3" \
+  --arg result "$4" \
+  '{time: $time, event: $event, user: $user, remote: $remote, host: $host, action: $action, result: $result}
+    | with_entries(select(.value != ""))' >> "${AUDIT_LOG}"
+`
+
+var auditProfile = `# Support Infrastructure Provider (SIP) Session Audit
+# DO NOT MODIFY: generated by SIP
+
+if [ -n "${SSH_CONNECTION}" ] && [ -z "${SIP_AUDIT_SESSION}" ]; then
+  export SIP_AUDIT_SESSION=1
+  %s login
+  trap '%s logout' EXIT
+fi
+`
+
+var consoleScript = `#!/bin/sh
+
+# Support Infrastructure Provider (SIP) VM Console Utility
+# DO NOT MODIFY: generated by SIP
+
+LOG_POOL="{{ .Pool }}"
+
+LIST_COMMAND="list"
+LOG_COMMAND="log"
+ATTACH_COMMAND="attach"
+
+help() {
+  echo "Support Infrastructure Provider (SIP) VM Console Utility"
+  echo ""
+  echo "Usage: ${LIST_COMMAND}                      list hosts"
+  echo "       ${LOG_COMMAND} [host name]           print host console log"
+  echo "       ${ATTACH_COMMAND} [host name]        attach to host console"
+}
+
+dep_check() {
+  if [ "$(which virsh)" = "" ]; then
+    echo "Missing package 'virsh'. Update your JumpHost image to include 'libvirt-clients'."
+    exit 1
+  fi
+}
+
+get_uri() {
+  case "$1" in
+{{- range .Hosts }}
+    "{{ .Name }}")
+      uri="{{ .URI }}"
+      ;;
+{{- end }}
+    *)
+      echo "Invalid host '$1'. Use the '${LIST_COMMAND}' command to view hosts."
+      exit 1
+      ;;
+  esac
+}
+
+list() {
+{{- range .Hosts }}
+  echo "{{ .Name }}"
+{{- end }}
+  exit 0
+}
+
+log() {
+  get_uri "$1"
+  virsh -c "${uri}" vol-download --pool "${LOG_POOL}" "$1.log" /dev/stdout
+  exit $?
+}
+
+attach() {
+  get_uri "$1"
+  echo "Attaching to console of host '$1'. Press Ctrl+] to detach."
+  virsh -c "${uri}" console "$1"
+  exit $?
+}
+
+case $1 in
+  "${LIST_COMMAND}")
+    list
+    ;;
+  "${LOG_COMMAND}"|"${ATTACH_COMMAND}")
+    if [ "$2" = "" ]; then
+      printf "Host name required.\n\n"
+      help
+      exit 1
+    fi
+    dep_check
+    if [ "$1" = "${LOG_COMMAND}" ]; then
+      log "$2"
+    fi
+    attach "$2"
+    ;;
+  *)
+    help
+    ;;
+esac
+`
+
 /*
 
 The SIP Cluster operator will manufacture a jump host pod specifically for this
@@ -16,16 +16,28 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
-	"html/template"
 	airshipv1 "sipcluster/pkg/api/v1"
 	airshipvms "sipcluster/pkg/vbmh"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -37,6 +49,33 @@ const (
 	// DefaultBalancerImage is the image that will be used as load balancer
 	DefaultBalancerImage    = "haproxy:2.3.2"
 	LoadBalancerServiceName = "loadbalancer"
+
+	// APIServerFrontendName is the name of the default load balancer frontend, which fronts the Kubernetes API
+	// server of the control plane VMs.
+	APIServerFrontendName = "apiserver"
+
+	// statsFrontendName is the name of the HAProxy frontend serving statistics and metrics.
+	statsFrontendName = "stats"
+	// APIServerPort is the port of the Kubernetes API server.
+	APIServerPort = 6443
+
+	// DefaultKeepalivedImage is the image of the keepalived sidecar that manages the load balancer virtual IP.
+	DefaultKeepalivedImage = "osixia/keepalived:2.0.20"
+	// DefaultVirtualRouterID is the VRRP virtual router ID used when none is specified.
+	DefaultVirtualRouterID = 51
+
+	// ConfigChecksumAnnotation is the pod template annotation holding the checksum of the configuration of a service,
+	// such as the load balancer. Configuration changes update the checksum, which rolls the service pods.
+	ConfigChecksumAnnotation = "sip.airshipit.org/config-checksum"
+
+	backendProbeTimeout = 2 * time.Second
+
+	// preStopDelay keeps a terminating load balancer pod serving while it is removed from Service endpoints.
+	preStopDelay = "5"
+
+	nameKeepalivedContainer = "keepalived"
+	keyKeepalivedConfig     = "keepalived.conf"
+	mountPathKeepalived     = "/etc/keepalived"
 )
 
 func (lb loadBalancer) Deploy() error {
@@ -59,15 +98,14 @@ func (lb loadBalancer) Deploy() error {
 	}
 
 	lb.logger.Info("Applying loadbalancer secret", "secret", secret.GetNamespace()+"/"+secret.GetName())
-	err = applyRuntimeObject(client.ObjectKey{Name: secret.GetName(), Namespace: secret.GetNamespace()}, secret, lb.client)
+	err = applyRuntimeObject(secret, lb.client, lb.owner)
 	if err != nil {
 		return err
 	}
 
 	// TODO: Validate Deployment becomes ready.
 	lb.logger.Info("Applying loadbalancer deployment", "deployment", deployment.GetNamespace()+"/"+deployment.GetName())
-	err = applyRuntimeObject(client.ObjectKey{Name: deployment.GetName(), Namespace: deployment.GetNamespace()},
-		deployment, lb.client)
+	err = applyRuntimeObject(deployment, lb.client, lb.owner)
 	if err != nil {
 		return err
 	}
@@ -75,14 +113,62 @@ func (lb loadBalancer) Deploy() error {
 	// TODO: Validate Service becomes ready.
 	lbService := lb.generateService(instance, labels)
 	lb.logger.Info("Applying loadbalancer service", "service", lbService.GetNamespace()+"/"+lbService.GetName())
-	err = applyRuntimeObject(client.ObjectKey{Name: lbService.GetName(), Namespace: lbService.GetNamespace()},
-		lbService, lb.client)
+	err = applyRuntimeObject(lbService, lb.client, lb.owner)
 	if err != nil {
 		return err
 	}
+
+	if err = lb.applyPodDisruptionBudget(instance, labels); err != nil {
+		return err
+	}
+
+	if lb.config.Metrics != nil {
+		return lb.applyMetrics(instance, labels)
+	}
+
 	return nil
 }
 
+// applyPodDisruptionBudget ensures that voluntary disruptions evict at most one load balancer replica at a time. A
+// single replica is not protected, since the budget would block node drains.
+func (lb loadBalancer) applyPodDisruptionBudget(instance string, labels map[string]string) error {
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance,
+			Namespace: lb.sipName.Namespace,
+			Labels:    labels,
+		},
+	}
+
+	if lb.replicas() < 2 {
+		err := lb.client.Delete(context.Background(), pdb)
+		if apierror.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	maxUnavailable := intstr.FromInt(1)
+	pdb.Spec = policyv1beta1.PodDisruptionBudgetSpec{
+		MaxUnavailable: &maxUnavailable,
+		Selector: &metav1.LabelSelector{
+			MatchLabels: labels,
+		},
+	}
+
+	lb.logger.Info("Applying loadbalancer pod disruption budget", "podDisruptionBudget",
+		pdb.GetNamespace()+"/"+pdb.GetName())
+	return applyRuntimeObject(pdb, lb.client, lb.owner)
+}
+
+func (lb loadBalancer) replicas() int32 {
+	if lb.config.Replicas == nil {
+		return 1
+	}
+
+	return *lb.config.Replicas
+}
+
 func (lb loadBalancer) generateDeploymentAndSecret(instance string, labels map[string]string) (*appsv1.Deployment,
 	*corev1.Secret, error) {
 	secret, err := lb.generateSecret(instance)
@@ -90,6 +176,83 @@ func (lb loadBalancer) generateDeploymentAndSecret(instance string, labels map[s
 		return nil, nil, err
 	}
 
+	podSpec := corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name:  LoadBalancerServiceName,
+				Image: lb.config.Image,
+				Ports: lb.generateContainerPorts(),
+				VolumeMounts: []corev1.VolumeMount{
+					{
+						Name:      ConfigSecretName,
+						MountPath: "/usr/local/etc/haproxy",
+					},
+				},
+				Lifecycle: &corev1.Lifecycle{
+					PreStop: &corev1.Handler{
+						Exec: &corev1.ExecAction{
+							Command: []string{"/bin/sh", "-c", "sleep " + preStopDelay},
+						},
+					},
+				},
+			},
+		},
+		Volumes: []corev1.Volume{
+			{
+				Name: ConfigSecretName,
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: secret.GetName(),
+					},
+				},
+			},
+		},
+		Affinity: lb.generateAffinity(labels),
+	}
+
+	// The keepalived sidecar assigns the virtual IP to the node interface, so the load balancer shares the host
+	// network, where its container ports are also host ports. Load balancers using the same ports are therefore not
+	// scheduled on the same node, although each only binds its own virtual IP. The process namespace is shared so
+	// that keepalived can track the HAProxy process, and HAProxy needs NET_ADMIN to bind the virtual IP transparently
+	// on nodes that do not hold it.
+	if vip := lb.config.VirtualIP; vip != nil {
+		podSpec.Containers[0].SecurityContext = &corev1.SecurityContext{
+			Capabilities: &corev1.Capabilities{
+				Add: []corev1.Capability{"NET_ADMIN"},
+			},
+		}
+		image := vip.Image
+		if image == "" {
+			image = DefaultKeepalivedImage
+		}
+
+		podSpec.HostNetwork = true
+		podSpec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+		podSpec.ShareProcessNamespace = boolPtr(true)
+		podSpec.Containers = append(podSpec.Containers, corev1.Container{
+			Name:    nameKeepalivedContainer,
+			Image:   image,
+			Command: []string{"keepalived"},
+			Args: []string{
+				"--dont-fork",
+				"--log-console",
+				"--vrrp",
+				"--use-file", mountPathKeepalived + "/" + keyKeepalivedConfig,
+			},
+			SecurityContext: &corev1.SecurityContext{
+				Capabilities: &corev1.Capabilities{
+					Add: []corev1.Capability{"NET_ADMIN", "NET_BROADCAST", "NET_RAW"},
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      ConfigSecretName,
+					MountPath: mountPathKeepalived,
+				},
+			},
+		})
+	}
+
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      instance,
@@ -97,44 +260,19 @@ func (lb loadBalancer) generateDeploymentAndSecret(instance string, labels map[s
 			Labels:    labels,
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: int32Ptr(1),
+			Replicas: int32Ptr(lb.replicas()),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
+			Strategy: lb.generateStrategy(),
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:  LoadBalancerServiceName,
-							Image: lb.config.Image,
-							Ports: []corev1.ContainerPort{
-								{
-									Name:          "http",
-									ContainerPort: 6443,
-								},
-							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      ConfigSecretName,
-									MountPath: "/usr/local/etc/haproxy",
-								},
-							},
-						},
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: ConfigSecretName,
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{
-									SecretName: secret.GetName(),
-								},
-							},
-						},
+					Annotations: map[string]string{
+						ConfigChecksumAnnotation: configChecksum(secret.Data),
 					},
 				},
+				Spec: podSpec,
 			},
 		},
 	}
@@ -142,105 +280,508 @@ func (lb loadBalancer) generateDeploymentAndSecret(instance string, labels map[s
 	return deployment, secret, nil
 }
 
+// generateStrategy rolls load balancer pods without reducing the number of available replicas. Replicas that use the
+// host network cannot be surged onto a node that already runs one, so they are replaced one at a time while the
+// virtual IP moves to another replica.
+func (lb loadBalancer) generateStrategy() appsv1.DeploymentStrategy {
+	maxSurge := intstr.FromInt(1)
+	maxUnavailable := intstr.FromInt(0)
+	if lb.config.VirtualIP != nil {
+		maxSurge = intstr.FromInt(0)
+		maxUnavailable = intstr.FromInt(1)
+	}
+
+	return appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       &maxSurge,
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+}
+
+// configChecksum returns the SHA-256 checksum of configuration data.
+func configChecksum(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.Buffer{}
+	for _, key := range keys {
+		buf.WriteString(key)
+		buf.WriteByte(0)
+		buf.Write(data[key])
+		buf.WriteByte(0)
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAffinity spreads load balancer replicas across base cluster nodes. Spreading is required when the load
+// balancer uses the host network, since replicas on the same node would bind the same ports.
+func (lb loadBalancer) generateAffinity(labels map[string]string) *corev1.Affinity {
+	if lb.replicas() < 2 {
+		return nil
+	}
+
+	term := corev1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{
+			MatchLabels: labels,
+		},
+		TopologyKey: corev1.LabelHostname,
+	}
+
+	if lb.config.VirtualIP != nil {
+		return &corev1.Affinity{
+			PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term},
+			},
+		}
+	}
+
+	return &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+				{
+					Weight:          100,
+					PodAffinityTerm: term,
+				},
+			},
+		},
+	}
+}
+
 func (lb loadBalancer) generateSecret(instance string) (*corev1.Secret, error) {
+	frontends, err := lb.frontends()
+	if err != nil {
+		return nil, err
+	}
+
 	p := proxy{
-		FrontPort: 6443,
-		Backends:  make([]backend, 0),
+		Cluster: cluster{
+			Name:        lb.sipName.Name,
+			Namespace:   lb.sipNamespace,
+			ClusterName: lb.sipName.Namespace,
+		},
+		Frontends: make([]frontend, 0, len(frontends)),
 	}
-	for _, machine := range lb.machines.Machines {
-		if machine.VMRole == airshipv1.VMControlPlane {
-			name := machine.BMH.Name
-			namespace := machine.BMH.Namespace
-			ip, exists := machine.Data.IPOnInterface[lb.config.NodeInterface]
-			if !exists {
-				lb.logger.Info("Machine does not have backend interface to be forwarded to",
-					"interface", lb.config.NodeInterface,
-					"machine", namespace+"/"+name,
-				)
-				continue
-			}
-			p.Backends = append(p.Backends, backend{IP: ip, Name: machine.BMH.Name, Port: 6443})
-		}
+	if lb.config.Metrics != nil {
+		p.Metrics = &metrics{Port: lb.metricsPort(), Bind: lb.bind(lb.metricsPort())}
+	}
+	for _, fe := range frontends {
+		p.Frontends = append(p.Frontends, frontend{
+			Name:        fe.Name,
+			FrontPort:   fe.FrontendPort,
+			Bind:        lb.bind(fe.FrontendPort),
+			Mode:        fe.Mode,
+			HealthCheck: fe.HealthCheck,
+			Backends:    lb.generateBackends(fe),
+		})
+	}
+
+	tmpl, err := lb.template()
+	if err != nil {
+		return nil, err
 	}
-	secretData, err := generateTemplate(p)
+
+	secretData, err := generateTemplate(tmpl, p)
 	if err != nil {
+		if lb.config.Template != nil {
+			return nil, ErrInvalidLoadBalancerTemplate{
+				ConfigMapName: lb.config.Template.Name,
+				Key:           lb.config.Template.Key,
+				Err:           err,
+			}
+		}
 		return nil, err
 	}
+	data := map[string][]byte{
+		"haproxy.cfg": secretData,
+	}
+
+	if lb.config.VirtualIP != nil {
+		data[keyKeepalivedConfig], err = lb.generateKeepalivedConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      instance,
 			Namespace: lb.sipName.Namespace,
 		},
 		Type: corev1.SecretTypeOpaque,
-		Data: map[string][]byte{
-			"haproxy.cfg": secretData,
-		},
+		Data: data,
 	}, nil
 }
 
+// bind returns the HAProxy bind address and options of a frontend port, including the statistics frontend. Load
+// balancers that use the host network bind only the virtual IP, so that their frontends do not collide with the base
+// cluster services or with the load balancers of other SIPClusters on the same node. The transparent option allows
+// replicas that do not hold the virtual IP to bind it, so they are ready to serve when keepalived moves the address
+// to their node. Other load balancers bind all addresses, and those that select IPv6 host addresses bind the IPv6
+// wildcard address, accepting IPv4 connections on it as well.
+func (lb loadBalancer) bind(port int) string {
+	if vip := lb.config.VirtualIP; vip != nil {
+		return net.JoinHostPort(vip.Address, strconv.Itoa(port)) + " transparent"
+	}
+
+	switch lb.config.IPFamily {
+	case airshipv1.IPFamilyIPv6, airshipv1.IPFamilyDualStack:
+		return ":::" + strconv.Itoa(port) + " v4v6"
+	default:
+		return "*:" + strconv.Itoa(port)
+	}
+}
+
+// generateKeepalivedConfig renders the keepalived configuration of the load balancer virtual IP.
+func (lb loadBalancer) generateKeepalivedConfig() ([]byte, error) {
+	vip := *lb.config.VirtualIP
+	if net.ParseIP(vip.Address) == nil {
+		return nil, ErrInvalidVirtualIP{Address: vip.Address}
+	}
+	if vip.VirtualRouterID == 0 {
+		vip.VirtualRouterID = DefaultVirtualRouterID
+	}
+
+	tmpl, err := template.New("keepalived-config").Parse(keepalivedTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bytes.NewBuffer([]byte{})
+	if err = tmpl.Execute(w, vip); err != nil {
+		return nil, err
+	}
+
+	return w.Bytes(), nil
+}
+
+// template returns the HAProxy configuration template, read from the ConfigMap referenced by the load balancer
+// configuration when one is specified.
+func (lb loadBalancer) template() (string, error) {
+	ref := lb.config.Template
+	if ref == nil {
+		return defaultTemplate, nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err := lb.client.Get(context.Background(), client.ObjectKey{Name: ref.Name, Namespace: lb.sipNamespace},
+		configMap)
+	if apierror.IsNotFound(err) {
+		return "", ErrInvalidLoadBalancerTemplate{ConfigMapName: ref.Name, Key: ref.Key, Err: err}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, exists := configMap.Data[ref.Key]
+	if !exists {
+		return "", ErrInvalidLoadBalancerTemplate{ConfigMapName: ref.Name, Key: ref.Key}
+	}
+
+	return tmpl, nil
+}
+
+// generateBackends returns the backends of a frontend, sorted by name so that the generated configuration is stable.
+func (lb loadBalancer) generateBackends(fe airshipv1.LoadBalancerFrontend) []backend {
+	backends := make([]backend, 0)
+	for _, machine := range lb.machines.Machines {
+		if machine.VMRole != fe.TargetRole {
+			continue
+		}
+
+		name := machine.BMH.Name
+		namespace := machine.BMH.Namespace
+		ips := machine.Data.IPs(lb.config.NodeInterface, lb.config.IPFamily)
+		if len(ips) == 0 {
+			lb.logger.Info("Machine does not have backend interface to be forwarded to",
+				"interface", lb.config.NodeInterface,
+				"machine", namespace+"/"+name,
+			)
+			continue
+		}
+		// Hosts with several addresses, e.g. in dual-stack networks, are a backend server on each of them.
+		for i, ip := range ips {
+			serverName := name
+			if len(ips) > 1 {
+				serverName = name + "-" + strconv.Itoa(i)
+			}
+			backends = append(backends, backend{
+				IP:      ip,
+				Name:    serverName,
+				Port:    fe.BackendPort,
+				Address: net.JoinHostPort(ip, strconv.Itoa(fe.BackendPort)),
+			})
+		}
+	}
+
+	sort.Slice(backends, func(i, j int) bool { return backends[i].Name < backends[j].Name })
+	return backends
+}
+
+// frontends returns the validated frontends of the load balancer, defaulting to the Kubernetes API server frontend.
+func (lb loadBalancer) frontends() ([]airshipv1.LoadBalancerFrontend, error) {
+	if len(lb.config.Frontends) == 0 {
+		frontends := []airshipv1.LoadBalancerFrontend{
+			{
+				Name:         APIServerFrontendName,
+				FrontendPort: APIServerPort,
+				BackendPort:  APIServerPort,
+				Mode:         airshipv1.LoadBalancerModeTCP,
+				HealthCheck: &airshipv1.LoadBalancerHealthCheck{
+					HTTPPath: "/readyz",
+					SSL:      true,
+				},
+				TargetRole: airshipv1.VMControlPlane,
+				NodePort:   lb.config.NodePort,
+			},
+		}
+		return frontends, lb.validateMetricsPort(frontends[0])
+	}
+
+	// The node port of the default frontend is not applied to frontends, which define their own node ports.
+	if lb.config.NodePort != 0 {
+		return nil, ErrInvalidLoadBalancerFrontend{
+			Name:   lb.config.Frontends[0].Name,
+			Reason: "nodePort of the load balancer cannot be combined with frontends, set the nodePort of each frontend",
+		}
+	}
+
+	names := map[string]bool{}
+	ports := map[int]bool{}
+	frontends := make([]airshipv1.LoadBalancerFrontend, 0, len(lb.config.Frontends))
+	for _, fe := range lb.config.Frontends {
+		switch {
+		case len(validation.IsValidPortName(fe.Name)) > 0:
+			return nil, ErrInvalidLoadBalancerFrontend{Name: fe.Name, Reason: "invalid frontend name: " +
+				strings.Join(validation.IsValidPortName(fe.Name), ", ")}
+		case fe.Name == statsFrontendName || fe.Name == nameMetricsPort:
+			return nil, ErrInvalidLoadBalancerFrontend{Name: fe.Name, Reason: "reserved frontend name"}
+		case names[fe.Name]:
+			return nil, ErrInvalidLoadBalancerFrontend{Name: fe.Name, Reason: "duplicate frontend name"}
+		case ports[fe.FrontendPort]:
+			return nil, ErrInvalidLoadBalancerFrontend{Name: fe.Name, Reason: "duplicate frontend port"}
+		case len(validation.IsValidPortNum(fe.FrontendPort)) > 0 || len(validation.IsValidPortNum(fe.BackendPort)) > 0:
+			return nil, ErrInvalidLoadBalancerFrontend{Name: fe.Name,
+				Reason: "frontend and backend ports must be between 1 and 65535"}
+		}
+		if err := lb.validateMetricsPort(fe); err != nil {
+			return nil, err
+		}
+		names[fe.Name] = true
+		ports[fe.FrontendPort] = true
+
+		if fe.Mode == "" {
+			fe.Mode = airshipv1.LoadBalancerModeTCP
+		}
+		frontends = append(frontends, fe)
+	}
+
+	return frontends, nil
+}
+
+// validateMetricsPort verifies that a frontend does not listen on the metrics port of the load balancer.
+func (lb loadBalancer) validateMetricsPort(fe airshipv1.LoadBalancerFrontend) error {
+	if lb.config.Metrics != nil && fe.FrontendPort == lb.metricsPort() {
+		return ErrInvalidLoadBalancerFrontend{Name: fe.Name, Reason: "frontend port is the metrics port"}
+	}
+
+	return nil
+}
+
+func (lb loadBalancer) generateContainerPorts() []corev1.ContainerPort {
+	// Frontends are validated when the configuration Secret is generated.
+	frontends, _ := lb.frontends() //nolint:errcheck
+	ports := make([]corev1.ContainerPort, 0, len(frontends))
+	for _, fe := range frontends {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          fe.Name,
+			ContainerPort: int32(fe.FrontendPort),
+			Protocol:      corev1.ProtocolTCP,
+		})
+	}
+
+	if lb.config.Metrics != nil {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          nameMetricsPort,
+			ContainerPort: int32(lb.metricsPort()),
+			Protocol:      corev1.ProtocolTCP,
+		})
+	}
+
+	return ports
+}
+
 func (lb loadBalancer) generateService(instance string, labels map[string]string) *corev1.Service {
-	return &corev1.Service{
+	// Frontends are validated when the configuration Secret is generated.
+	frontends, _ := lb.frontends() //nolint:errcheck
+	ports := make([]corev1.ServicePort, 0, len(frontends))
+	for _, fe := range frontends {
+		ports = append(ports, corev1.ServicePort{
+			Name:       fe.Name,
+			Port:       int32(fe.FrontendPort),
+			Protocol:   corev1.ProtocolTCP,
+			TargetPort: intstr.FromString(fe.Name),
+			NodePort:   int32(fe.NodePort),
+		})
+	}
+
+	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      instance,
 			Namespace: lb.sipName.Namespace,
 		},
 		Spec: corev1.ServiceSpec{
-			Ports: []corev1.ServicePort{
-				{
-					Name:     "http",
-					Port:     6443,
-					NodePort: int32(lb.config.NodePort),
-				},
-			},
+			Ports:    ports,
 			Selector: labels,
 			Type:     corev1.ServiceTypeNodePort,
 		},
 	}
+	if lb.config.ClusterIP != nil {
+		service.Spec.ClusterIP = *lb.config.ClusterIP
+	}
+
+	return service
 }
 
 type proxy struct {
+	Cluster   cluster
+	Frontends []frontend
+	Metrics   *metrics
+}
+
+// metrics holds the configuration of the statistics and Prometheus exporter frontend.
+type metrics struct {
+	Port int
+	// Bind is the HAProxy bind address and options of the statistics frontend.
+	Bind string
+}
+
+// cluster holds the SIPCluster metadata available to load balancer templates.
+type cluster struct {
+	// Name and Namespace of the SIPCluster.
+	Name      string
+	Namespace string
+	// ClusterName is the name of the sub-cluster, which is also the namespace of the infrastructure services.
+	ClusterName string
+}
+
+type frontend struct {
+	Name      string
 	FrontPort int
-	Backends  []backend
+	// Bind is the HAProxy bind address and options of the frontend.
+	Bind        string
+	Mode        airshipv1.LoadBalancerMode
+	HealthCheck *airshipv1.LoadBalancerHealthCheck
+	Backends    []backend
 }
 
 type backend struct {
 	IP   string
 	Name string
 	Port int
+	// Address is the IP and port of the backend, with IPv6 addresses enclosed in brackets.
+	Address string
 }
 
 type loadBalancer struct {
 	client   client.Client
 	sipName  types.NamespacedName
 	logger   logr.Logger
-	config   airshipv1.SIPClusterService
+	config   airshipv1.LoadBalancerService
 	machines *airshipvms.MachineList
+
+	// sipNamespace is the namespace of the SIPCluster, which holds the ConfigMap referenced by the configuration.
+	sipNamespace string
+	owner        owner
 }
 
-func newLB(name, namespace string,
+func newLB(name, sipNamespace, namespace string,
 	logger logr.Logger,
-	config airshipv1.SIPClusterService,
+	config airshipv1.LoadBalancerService,
 	machines *airshipvms.MachineList,
-	client client.Client) loadBalancer {
+	client client.Client,
+	owner owner) loadBalancer {
 	return loadBalancer{
 		sipName: types.NamespacedName{
 			Name:      name,
 			Namespace: namespace,
 		},
-		logger:   logger,
-		config:   config,
-		machines: machines,
-		client:   client,
+		sipNamespace: sipNamespace,
+		logger:       logger,
+		config:       config,
+		machines:     machines,
+		client:       client,
+		owner:        owner,
 	}
 }
 
+// Ready verifies that the load balancer Deployment is available, reachable through its Service, and that at least
+// one backend accepts connections.
+func (lb loadBalancer) Ready() error {
+	key := client.ObjectKey{Name: LoadBalancerServiceName + "-" + lb.sipName.Name, Namespace: lb.sipName.Namespace}
+	if err := deploymentReady(LoadBalancerServiceName, key, lb.client); err != nil {
+		return err
+	}
+
+	if err := endpointsReady(LoadBalancerServiceName, key, lb.client); err != nil {
+		return err
+	}
+
+	frontends, err := lb.frontends()
+	if err != nil {
+		return err
+	}
+
+	var probeErrs []string
+	for _, fe := range frontends {
+		for _, be := range lb.generateBackends(fe) {
+			address := net.JoinHostPort(be.IP, strconv.Itoa(be.Port))
+			probeErr := probeBackend(address)
+			if probeErr == nil {
+				return nil
+			}
+			probeErrs = append(probeErrs, probeErr.Error())
+		}
+	}
+
+	if len(probeErrs) == 0 {
+		return ErrServiceNotReady{Service: LoadBalancerServiceName, Reason: "no backends are available"}
+	}
+
+	return ErrServiceNotReady{
+		Service: LoadBalancerServiceName,
+		Reason:  "no backend accepts connections: " + strings.Join(probeErrs, "; "),
+	}
+}
+
+// ConditionType returns the SIPCluster status condition type reporting the readiness of the load balancer.
+func (lb loadBalancer) ConditionType() string {
+	return airshipv1.ConditionTypeLoadBalancerReady
+}
+
+// probeBackend verifies that a load balancer backend accepts TCP connections.
+var probeBackend = func(address string) error {
+	conn, err := net.DialTimeout("tcp", address, backendProbeTimeout)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
 func (lb loadBalancer) Finalize() error {
 	// implete to delete loadbalancer
 	return nil
 }
 
-func generateTemplate(p proxy) ([]byte, error) {
-	tmpl, err := template.New("haproxy-config").Parse(defaultTemplate)
+func generateTemplate(text string, p proxy) ([]byte, error) {
+	tmpl, err := template.New("haproxy-config").Option("missingkey=error").Parse(text)
 	if err != nil {
 		return nil, err
 	}
@@ -278,29 +819,78 @@ defaults
   # be long enough to cover inactivity due to the lack of new logs.
   timeout server          600s
 
+{{- range .Frontends }}
+
 #---------------------------------------------------------------------
-# apiserver frontend which proxys to the masters
+# {{ .Name }} frontend
 #---------------------------------------------------------------------
-frontend apiserver
-  bind *:{{ .FrontPort }}
-  mode tcp
-  option tcplog
-  default_backend kube-apiservers
+frontend {{ .Name }}
+  bind {{ .Bind }}
+  mode {{ .Mode }}
+  option {{ .Mode }}log
+  default_backend {{ .Name }}-backends
 
 #---------------------------------------------------------------------
-# round robin balancing for apiserver
+# round robin balancing for {{ .Name }}
 #---------------------------------------------------------------------
-backend kube-apiservers
-  mode tcp
+backend {{ .Name }}-backends
+  mode {{ .Mode }}
   balance     roundrobin
-  option httpchk GET /readyz
+  {{- if and .HealthCheck .HealthCheck.HTTPPath }}
+  option httpchk GET {{ .HealthCheck.HTTPPath }}
   http-check expect status 200
+  {{- end }}
   option log-health-checks
   # Observed apiserver returns 500 for around 10s when 2nd cp node joins.
   # downinter 2s makes it check more frequently to recover from that state sooner.
   # Also changing fall to 4 so that it takes longer (4 failures) for it to take down a backend.
-  default-server check check-ssl verify none inter 5s downinter 2s fall 4 on-marked-down shutdown-sessions
-    {{- range .Backends }}
-    {{- $backEnd := . }}
-    server {{ $backEnd.Name }} {{ $backEnd.IP }}:{{ $backEnd.Port }}
-    {{ end -}}`
+  default-server check
+  {{- if and .HealthCheck .HealthCheck.SSL }} check-ssl verify none{{ end }}
+  {{- " inter 5s downinter 2s fall 4 on-marked-down shutdown-sessions" }}
+  {{- range .Backends }}
+  server {{ .Name }} {{ .Address }}
+  {{- end }}
+{{- end }}
+{{- if .Metrics }}
+
+#---------------------------------------------------------------------
+# statistics and prometheus exporter frontend
+#---------------------------------------------------------------------
+frontend stats
+  bind {{ .Metrics.Bind }}
+  mode http
+  no log
+  http-request use-service prometheus-exporter if { path /metrics }
+  stats enable
+  stats uri /stats
+  stats refresh 10s
+{{- end }}
+`
+
+var keepalivedTemplate = `global_defs {
+  enable_script_security
+  script_user root
+}
+
+# The virtual IP is only held by a node with a running HAProxy.
+vrrp_script haproxy {
+  script "/bin/sh -c 'pidof haproxy'"
+  interval 2
+  fall 2
+  rise 2
+}
+
+vrrp_instance haproxy {
+  state BACKUP
+  interface {{ .Interface }}
+  virtual_router_id {{ .VirtualRouterID }}
+  priority 100
+  advert_int 1
+  virtual_ipaddress {
+    {{ .Address }}
+  }
+  track_script {
+    haproxy
+  }
+}
+`
@@ -0,0 +1,284 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+	airshipvms "sipcluster/pkg/vbmh"
+)
+
+const (
+	// DefaultMetricsPort is the port of the load balancer statistics and metrics frontend when none is specified.
+	DefaultMetricsPort = 8405
+
+	nameMetricsPort = "metrics"
+	statsTimeout    = 5 * time.Second
+)
+
+// Column indexes of the HAProxy CSV statistics. See
+// https://cbonte.github.io/haproxy-dconv/2.3/management.html#9.1
+const (
+	statsColumnProxy  = 0
+	statsColumnServer = 1
+	statsColumnStatus = 17
+)
+
+// statsURL returns the URL of the HAProxy CSV statistics of a load balancer metrics Service.
+var statsURL = func(service client.ObjectKey, port int) string {
+	return fmt.Sprintf("http://%s.%s.svc:%d/stats;csv", service.Name, service.Namespace, port)
+}
+
+func (lb loadBalancer) metricsPort() int {
+	if lb.config.Metrics == nil || lb.config.Metrics.Port == 0 {
+		return DefaultMetricsPort
+	}
+
+	return lb.config.Metrics.Port
+}
+
+// applyMetrics applies the metrics Service of the load balancer and, when the Prometheus operator is installed, a
+// ServiceMonitor scraping it. Load balancers with a virtual IP serve metrics only on the virtual IP, so their metrics
+// Service has no selector and its Endpoints are the virtual IP, held by a single replica.
+func (lb loadBalancer) applyMetrics(instance string, labels map[string]string) error {
+	metricsLabels := map[string]string{
+		airshipvms.SipClusterLabel: lb.sipName.Namespace,
+	}
+	for key, value := range labels {
+		metricsLabels[key] = value
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance + "-" + nameMetricsPort,
+			Namespace: lb.sipName.Namespace,
+			Labels:    metricsLabels,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       nameMetricsPort,
+					Port:       int32(lb.metricsPort()),
+					Protocol:   corev1.ProtocolTCP,
+					TargetPort: intstr.FromString(nameMetricsPort),
+				},
+			},
+			Selector: labels,
+			Type:     corev1.ServiceTypeClusterIP,
+		},
+	}
+
+	vip := lb.config.VirtualIP
+	if vip != nil {
+		service.Spec.Selector = nil
+	}
+
+	lb.logger.Info("Applying loadbalancer metrics service", "service", service.GetNamespace()+"/"+service.GetName())
+	err := applyRuntimeObject(service, lb.client, lb.owner)
+	if err != nil {
+		return err
+	}
+
+	if vip != nil {
+		endpoints := &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      service.GetName(),
+				Namespace: service.GetNamespace(),
+				Labels:    metricsLabels,
+			},
+			Subsets: []corev1.EndpointSubset{
+				{
+					Addresses: []corev1.EndpointAddress{{IP: vip.Address}},
+					Ports: []corev1.EndpointPort{
+						{
+							Name:     nameMetricsPort,
+							Port:     int32(lb.metricsPort()),
+							Protocol: corev1.ProtocolTCP,
+						},
+					},
+				},
+			},
+		}
+
+		lb.logger.Info("Applying loadbalancer metrics endpoints", "endpoints",
+			endpoints.GetNamespace()+"/"+endpoints.GetName())
+		if err = applyRuntimeObject(endpoints, lb.client, lb.owner); err != nil {
+			return err
+		}
+	}
+
+	serviceMonitor := lb.generateServiceMonitor(service.GetName(), metricsLabels)
+	lb.logger.Info("Applying loadbalancer service monitor", "serviceMonitor",
+		serviceMonitor.GetNamespace()+"/"+serviceMonitor.GetName())
+	err = applyRuntimeObject(serviceMonitor, lb.client, lb.owner)
+	if apimeta.IsNoMatchError(err) {
+		lb.logger.Info("ServiceMonitor kind is not installed, skipping loadbalancer service monitor")
+		return nil
+	}
+
+	return err
+}
+
+func (lb loadBalancer) generateServiceMonitor(name string, labels map[string]string) *unstructured.Unstructured {
+	monitorLabels := map[string]interface{}{}
+	for key, value := range labels {
+		monitorLabels[key] = value
+	}
+	for key, value := range lb.config.Metrics.ServiceMonitorLabels {
+		monitorLabels[key] = value
+	}
+
+	selector := map[string]interface{}{}
+	for key, value := range labels {
+		selector[key] = value
+	}
+
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "monitoring.coreos.com/v1",
+			"kind":       "ServiceMonitor",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": lb.sipName.Namespace,
+				"labels":    monitorLabels,
+			},
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": selector,
+				},
+				"endpoints": []interface{}{
+					map[string]interface{}{
+						"port": nameMetricsPort,
+						"path": "/metrics",
+					},
+				},
+			},
+		},
+	}
+}
+
+// ReportStatus reports the endpoints of the load balancer frontends and, when metrics are enabled, the state of the
+// load balancer backend servers as retrieved from the HAProxy statistics. The statistics are served by whichever
+// replica the metrics Service routes the request to, so with several replicas they reflect the health checks of a
+// single replica.
+func (lb loadBalancer) ReportStatus(status *airshipv1.SIPClusterStatus) error {
+	instance := LoadBalancerServiceName + "-" + lb.sipName.Name
+	preferred := map[string][]string{}
+	if vip := lb.config.VirtualIP; vip != nil {
+		frontends, err := lb.frontends()
+		if err != nil {
+			return err
+		}
+
+		for _, fe := range frontends {
+			preferred[fe.Name] = []string{net.JoinHostPort(vip.Address, strconv.Itoa(fe.FrontendPort))}
+		}
+	}
+
+	endpoints, err := serviceEndpoints(client.ObjectKey{Name: instance, Namespace: lb.sipName.Namespace},
+		lb.client, preferred)
+	if err != nil {
+		return err
+	}
+	setEndpoints(status, instance, endpoints)
+
+	if lb.config.Metrics == nil {
+		return nil
+	}
+
+	backends, err := getBackendStatus(statsURL(client.ObjectKey{
+		Name:      instance + "-" + nameMetricsPort,
+		Namespace: lb.sipName.Namespace,
+	}, lb.metricsPort()))
+	if err != nil {
+		return err
+	}
+
+	status.LoadBalancers = append(status.LoadBalancers, airshipv1.LoadBalancerStatus{
+		Name:           instance,
+		Backends:       backends,
+		LastUpdateTime: metav1.Now(),
+	})
+
+	return nil
+}
+
+// getBackendStatus retrieves the state of the backend servers from HAProxy CSV statistics.
+func getBackendStatus(url string) ([]airshipv1.LoadBalancerBackendStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrLoadBalancerStatsUnavailable{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	reader := csv.NewReader(resp.Body)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+
+	backends := []airshipv1.LoadBalancerBackendStatus{}
+	for {
+		record, readErr := reader.Read()
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+		if len(record) <= statsColumnStatus {
+			continue
+		}
+
+		server := record[statsColumnServer]
+		if server == "FRONTEND" || server == "BACKEND" || record[statsColumnProxy] == "stats" {
+			continue
+		}
+
+		backends = append(backends, airshipv1.LoadBalancerBackendStatus{
+			Backend: record[statsColumnProxy],
+			Server:  server,
+			State:   strings.TrimSpace(record[statsColumnStatus]),
+		})
+	}
+
+	return backends, nil
+}
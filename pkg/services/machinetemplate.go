@@ -0,0 +1,132 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+	airshipvms "sipcluster/pkg/vbmh"
+)
+
+const (
+	// defaultMachineTemplateAPIVersion is the API version of Metal3MachineTemplates when none is specified.
+	defaultMachineTemplateAPIVersion = "infrastructure.cluster.x-k8s.io/v1alpha4"
+	machineTemplateKind              = "Metal3MachineTemplate"
+)
+
+// UpdateMachineTemplates sets the hostSelector of the Metal3MachineTemplate referenced by each node set of a
+// SIPCluster to match the BMHs scheduled for its VM role. Metal3MachineTemplates that do not exist are created when
+// an image is specified.
+func UpdateMachineTemplates(sip airshipv1.SIPCluster, c client.Client, logger logr.Logger) error {
+	roles := make([]string, 0, len(sip.Spec.Nodes))
+	for role := range sip.Spec.Nodes {
+		roles = append(roles, string(role))
+	}
+	sort.Strings(roles)
+
+	for _, role := range roles {
+		opts := sip.Spec.Nodes[airshipv1.VMRole(role)].MachineTemplate
+		if opts == nil {
+			continue
+		}
+
+		if err := updateMachineTemplate(sip, airshipv1.VMRole(role), *opts, c, logger); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func updateMachineTemplate(sip airshipv1.SIPCluster, role airshipv1.VMRole, opts airshipv1.MachineTemplateOpts,
+	c client.Client, logger logr.Logger) error {
+	apiVersion := opts.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultMachineTemplateAPIVersion
+	}
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = sip.GetNamespace()
+	}
+
+	// The host selector replaces any user-provided selector, including matchExpressions, so that it matches exactly
+	// the hosts scheduled by SIP.
+	hostSelector := map[string]interface{}{
+		"matchLabels": map[string]interface{}{
+			airshipvms.SipScheduleLabel: "true",
+			airshipvms.SipClusterLabel:  sip.Spec.ClusterName,
+			airshipvms.SipNodeTypeLabel: string(role),
+		},
+	}
+	hostSelectorPath := []string{"spec", "template", "spec", "hostSelector"}
+
+	template := &unstructured.Unstructured{}
+	template.SetGroupVersionKind(schema.FromAPIVersionAndKind(apiVersion, machineTemplateKind))
+	ctx := context.Background()
+	err := c.Get(ctx, client.ObjectKey{Name: opts.Name, Namespace: namespace}, template)
+	switch {
+	case apierrors.IsNotFound(err) && opts.Image != nil:
+		template.SetName(opts.Name)
+		template.SetNamespace(namespace)
+		image := map[string]interface{}{
+			"url":      opts.Image.URL,
+			"checksum": opts.Image.Checksum,
+		}
+		if opts.Image.ChecksumType != "" {
+			image["checksumType"] = opts.Image.ChecksumType
+		}
+		if opts.Image.DiskFormat != "" {
+			image["format"] = opts.Image.DiskFormat
+		}
+		if err = unstructured.SetNestedMap(template.Object, image, "spec", "template", "spec", "image"); err != nil {
+			return err
+		}
+		if err = unstructured.SetNestedMap(template.Object, hostSelector, hostSelectorPath...); err != nil {
+			return err
+		}
+
+		logger.Info("Creating machine template", "kind", machineTemplateKind, "name", namespace+"/"+opts.Name,
+			"role", role)
+		return c.Create(ctx, template)
+	case err != nil:
+		return err
+	}
+
+	current, _, err := unstructured.NestedMap(template.Object, hostSelectorPath...)
+	if err != nil {
+		return err
+	}
+	if equality.Semantic.DeepEqual(current, hostSelector) {
+		return nil
+	}
+
+	patch := client.MergeFrom(template.DeepCopy())
+	if err = unstructured.SetNestedMap(template.Object, hostSelector, hostSelectorPath...); err != nil {
+		return err
+	}
+
+	logger.Info("Updating machine template host selector", "kind", machineTemplateKind,
+		"name", namespace+"/"+opts.Name, "role", role)
+	return c.Patch(ctx, template, patch)
+}
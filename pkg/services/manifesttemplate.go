@@ -0,0 +1,363 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"text/template"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+	airshipvms "sipcluster/pkg/vbmh"
+)
+
+const (
+	// ManifestTemplateServiceType is the type of custom services that render and apply Go-templated Kubernetes
+	// manifests, configured by a ManifestTemplateConfig.
+	ManifestTemplateServiceType = "manifest-template"
+
+	// ConditionTypeManifestTemplateReady is the SIPCluster status condition type reporting the readiness of
+	// manifest-template services.
+	ConditionTypeManifestTemplateReady = "ManifestTemplateReady"
+
+	// manifestInventoryKey is the key of the inventory ConfigMap of a manifest-template service listing the objects
+	// it applied.
+	manifestInventoryKey = "objects"
+)
+
+func init() {
+	RegisterServiceType(ManifestTemplateServiceType, newManifestTemplate)
+}
+
+type manifestTemplate struct {
+	ctx    ServiceContext
+	config airshipv1.ManifestTemplateConfig
+}
+
+func newManifestTemplate(ctx ServiceContext, config airshipv1.CustomService) (InfraService, error) {
+	mt := manifestTemplate{ctx: ctx}
+	if err := json.Unmarshal(config.Config.Raw, &mt.config); err != nil {
+		return nil, ErrInvalidServiceConfig{Type: config.Type, Err: err}
+	}
+	if mt.config.ConfigMap.Name == "" {
+		return nil, ErrInvalidServiceConfig{Type: config.Type, Err: errors.New("configMap.name is required")}
+	}
+
+	return mt, nil
+}
+
+// manifestData is the data available to manifest templates.
+type manifestData struct {
+	Cluster cluster
+	// Namespace is the namespace in which the manifests are applied.
+	Namespace string
+	// InstanceName is the name of the manifest-template service instance, which can prefix object names.
+	InstanceName string
+	// Hosts are the hosts scheduled for the SIPCluster, sorted by name.
+	Hosts []manifestHost
+}
+
+// manifestHost holds the data of a host scheduled for the SIPCluster.
+type manifestHost struct {
+	Name string
+	Role airshipv1.VMRole
+	// IPOnInterface maps the node interface network IDs of the SIPCluster services to the IP address of the host.
+	IPOnInterface map[string]string
+	// Addresses maps the IDs of the networks of the host to all of its addresses on them.
+	Addresses map[string][]airshipvms.Address
+	// BMCAddress is the address of the BMC of the host.
+	BMCAddress string
+}
+
+// Deploy renders the manifest templates and applies the resulting objects in the namespace of the sub-cluster.
+// Objects applied previously that are no longer rendered are deleted.
+func (mt manifestTemplate) Deploy() error {
+	objs, err := mt.render()
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		mt.ctx.Logger.Info("Applying manifest", "kind", obj.GetKind(), "name", obj.GetNamespace()+"/"+obj.GetName())
+		if err = mt.ctx.Apply(obj); err != nil {
+			return err
+		}
+	}
+
+	previous, _, err := mt.inventory()
+	if err != nil {
+		return err
+	}
+	rendered := map[manifestObjectRef]bool{}
+	refs := []manifestObjectRef{}
+	for _, obj := range objs {
+		ref := manifestObjectRef{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Name: obj.GetName()}
+		rendered[ref] = true
+		refs = append(refs, ref)
+	}
+
+	// The objects to prune stay in the inventory until they are deleted, so that they are deleted on finalization
+	// should pruning fail.
+	stale := []manifestObjectRef{}
+	for _, ref := range previous {
+		if !rendered[ref] {
+			stale = append(stale, ref)
+		}
+	}
+	if len(stale) > 0 {
+		if err = mt.saveInventory(append(refs, stale...)); err != nil {
+			return err
+		}
+		if err = mt.delete(stale); err != nil {
+			return err
+		}
+	}
+
+	return mt.saveInventory(refs)
+}
+
+// Finalize deletes the objects applied from the manifest templates, as recorded in the inventory of the service, so
+// that neither changes to the manifest templates nor the hosts of the SIPCluster prevent their deletion. Objects
+// applied before the inventory was recorded are deleted on a best-effort basis by rendering the templates.
+func (mt manifestTemplate) Finalize() error {
+	refs, found, err := mt.inventory()
+	if err != nil {
+		return err
+	}
+	if !found {
+		objs, renderErr := mt.render()
+		if renderErr != nil {
+			mt.ctx.Logger.Info("Unable to render manifests to delete", "error", renderErr.Error())
+		}
+		for _, obj := range objs {
+			refs = append(refs, manifestObjectRef{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(),
+				Name: obj.GetName()})
+		}
+	}
+
+	if err = mt.delete(refs); err != nil {
+		return err
+	}
+
+	inventory := &corev1.ConfigMap{}
+	inventory.SetName(mt.inventoryName())
+	inventory.SetNamespace(mt.ctx.Namespace())
+	if err = mt.ctx.Client.Delete(context.Background(), inventory); err != nil && !apierror.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// manifestObjectRef identifies an object applied by a manifest-template service in the namespace of the
+// sub-cluster.
+type manifestObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+// inventoryName is the name of the ConfigMap recording the objects applied by the service.
+func (mt manifestTemplate) inventoryName() string {
+	return mt.ctx.InstanceName(ManifestTemplateServiceType) + "-inventory"
+}
+
+// inventory returns the objects applied by the service, and whether they were recorded.
+func (mt manifestTemplate) inventory() ([]manifestObjectRef, bool, error) {
+	configMap := &corev1.ConfigMap{}
+	err := mt.ctx.Client.Get(context.Background(), client.ObjectKey{
+		Name:      mt.inventoryName(),
+		Namespace: mt.ctx.Namespace(),
+	}, configMap)
+	if apierror.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	refs := []manifestObjectRef{}
+	if err = json.Unmarshal([]byte(configMap.Data[manifestInventoryKey]), &refs); err != nil {
+		return nil, false, err
+	}
+
+	return refs, true, nil
+}
+
+func (mt manifestTemplate) saveInventory(refs []manifestObjectRef) error {
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+
+	return mt.ctx.Apply(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: mt.inventoryName(), Namespace: mt.ctx.Namespace()},
+		Data:       map[string]string{manifestInventoryKey: string(data)},
+	})
+}
+
+// delete deletes objects applied by the service. Objects of kinds that are no longer served are already deleted.
+func (mt manifestTemplate) delete(refs []manifestObjectRef) error {
+	for _, ref := range refs {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(ref.APIVersion)
+		obj.SetKind(ref.Kind)
+		obj.SetName(ref.Name)
+		obj.SetNamespace(mt.ctx.Namespace())
+		err := mt.ctx.Client.Delete(context.Background(), obj)
+		if err != nil && !apierror.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ready verifies that the Deployments rendered from the manifest templates are available.
+func (mt manifestTemplate) Ready() error {
+	objs, err := mt.render()
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		if obj.GroupVersionKind().GroupKind() != appsv1.SchemeGroupVersion.WithKind("Deployment").GroupKind() {
+			continue
+		}
+
+		err = deploymentReady(ManifestTemplateServiceType, client.ObjectKey{
+			Name:      obj.GetName(),
+			Namespace: obj.GetNamespace(),
+		}, mt.ctx.Client)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ConditionType returns the SIPCluster status condition type reporting the readiness of manifest-template services.
+func (mt manifestTemplate) ConditionType() string {
+	return ConditionTypeManifestTemplateReady
+}
+
+// render renders each key of the manifest templates ConfigMap, in key order, into the objects it defines.
+func (mt manifestTemplate) render() ([]*unstructured.Unstructured, error) {
+	configMap := &corev1.ConfigMap{}
+	err := mt.ctx.Client.Get(context.Background(), client.ObjectKey{
+		Name:      mt.config.ConfigMap.Name,
+		Namespace: mt.ctx.SIPCluster.GetNamespace(),
+	}, configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data := mt.data()
+	objs := []*unstructured.Unstructured{}
+	for _, key := range keys {
+		invalid := func(err error) error {
+			return ErrInvalidManifestTemplate{ConfigMapName: configMap.Name, Key: key, Err: err}
+		}
+
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(configMap.Data[key])
+		if err != nil {
+			return nil, invalid(err)
+		}
+		w := bytes.NewBuffer([]byte{})
+		if err = tmpl.Execute(w, data); err != nil {
+			return nil, invalid(err)
+		}
+
+		decoder := yaml.NewYAMLOrJSONDecoder(w, 4096)
+		for {
+			raw := runtime.RawExtension{}
+			err = decoder.Decode(&raw)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, invalid(err)
+			}
+			// Empty documents, e.g. following a trailing document separator, are skipped.
+			if len(raw.Raw) == 0 || string(raw.Raw) == "null" {
+				continue
+			}
+
+			obj := &unstructured.Unstructured{}
+			if err = obj.UnmarshalJSON(raw.Raw); err != nil {
+				return nil, invalid(err)
+			}
+			if obj.GetName() == "" {
+				return nil, invalid(errors.New("manifest must define metadata.name"))
+			}
+
+			obj.SetNamespace(mt.ctx.Namespace())
+			objs = append(objs, obj)
+		}
+	}
+
+	return objs, nil
+}
+
+func (mt manifestTemplate) data() manifestData {
+	hosts := []manifestHost{}
+	if mt.ctx.Machines != nil {
+		for _, machine := range mt.ctx.Machines.Machines {
+			host := manifestHost{
+				Name:       machine.BMH.GetName(),
+				Role:       machine.VMRole,
+				BMCAddress: machine.BMH.Spec.BMC.Address,
+			}
+			if machine.Data != nil {
+				host.IPOnInterface = machine.Data.IPOnInterface
+				host.Addresses = machine.Data.Addresses
+			}
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+
+	return manifestData{
+		Cluster: cluster{
+			Name:        mt.ctx.SIPCluster.GetName(),
+			Namespace:   mt.ctx.SIPCluster.GetNamespace(),
+			ClusterName: mt.ctx.SIPCluster.Spec.ClusterName,
+		},
+		Namespace:    mt.ctx.Namespace(),
+		InstanceName: mt.ctx.InstanceName(ManifestTemplateServiceType),
+		Hosts:        hosts,
+	}
+}
@@ -0,0 +1,299 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+)
+
+const (
+	// NTPServiceType is the type of custom services that serve time to the hosts of a sub-cluster with chrony,
+	// configured by an NTPConfig.
+	NTPServiceType = "ntp"
+
+	// ConditionTypeNTPReady is the SIPCluster status condition type reporting the readiness of ntp services.
+	ConditionTypeNTPReady = "NTPReady"
+
+	// DefaultNTPImage is the chrony image of ntp services when none is specified.
+	DefaultNTPImage = "cturra/ntp:4.1"
+
+	keyChronyConfig = "chrony.conf"
+	mountPathNTP    = "/etc/chrony-sip"
+	nameNTPVolume   = "config"
+	nameNTPPort     = "ntp"
+	ntpPort         = 123
+	// ntpLocalStratum is the stratum at which time is served when no upstream is reachable. It is high enough for
+	// clients to prefer any other server that is reachable.
+	ntpLocalStratum = 10
+)
+
+func init() {
+	RegisterServiceType(NTPServiceType, newNTP)
+}
+
+type ntp struct {
+	ctx     ServiceContext
+	service airshipv1.SIPClusterService
+	config  airshipv1.NTPConfig
+}
+
+func newNTP(ctx ServiceContext, config airshipv1.CustomService) (InfraService, error) {
+	n := ntp{ctx: ctx, service: config.SIPClusterService}
+	if len(config.Config.Raw) > 0 {
+		if err := json.Unmarshal(config.Config.Raw, &n.config); err != nil {
+			return nil, ErrInvalidServiceConfig{Type: config.Type, Err: err}
+		}
+	}
+
+	for _, upstream := range n.config.Upstreams {
+		if net.ParseIP(upstream) == nil && len(validation.IsDNS1123Subdomain(upstream)) > 0 {
+			return nil, ErrInvalidServiceConfig{
+				Type: config.Type,
+				Err:  fmt.Errorf("upstream %q is neither a hostname nor an IP address", upstream),
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Deploy applies the chrony configuration, and the Deployment and Service of the chrony server.
+func (n ntp) Deploy() error {
+	instance := n.ctx.InstanceName(NTPServiceType)
+	labels := map[string]string{
+		// See https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/#labels
+		"app.kubernetes.io/part-of":   "sip",
+		"app.kubernetes.io/name":      NTPServiceType,
+		"app.kubernetes.io/component": NTPServiceType,
+		"app.kubernetes.io/instance":  instance,
+	}
+
+	configMap := n.generateConfigMap(instance, labels)
+	n.ctx.Logger.Info("Applying configmap", "configmap", configMap.GetNamespace()+"/"+configMap.GetName())
+	if err := n.ctx.Apply(configMap); err != nil {
+		return err
+	}
+
+	deployment := n.generateDeployment(instance, labels, configMap)
+	n.ctx.Logger.Info("Applying deployment", "deployment", deployment.GetNamespace()+"/"+deployment.GetName())
+	if err := n.ctx.Apply(deployment); err != nil {
+		return err
+	}
+
+	service := n.generateService(instance, labels)
+	n.ctx.Logger.Info("Applying service", "service", service.GetNamespace()+"/"+service.GetName())
+	return n.ctx.Apply(service)
+}
+
+func (n ntp) generateConfigMap(instance string, labels map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance,
+			Namespace: n.ctx.Namespace(),
+			Labels:    labels,
+		},
+		Data: map[string]string{
+			keyChronyConfig: n.generateChronyConfig(),
+		},
+	}
+}
+
+// generateChronyConfig configures chrony to synchronize with the upstreams, and to serve time to any client, falling
+// back to the local clock when the upstreams are unreachable. Clients are not restricted to the addresses of the hosts
+// on the node interface network, since the node port may translate their source addresses.
+func (n ntp) generateChronyConfig() string {
+	b := strings.Builder{}
+	for _, upstream := range n.config.Upstreams {
+		fmt.Fprintf(&b, "server %s iburst\n", upstream)
+	}
+	fmt.Fprintf(&b, "local stratum %d\n", ntpLocalStratum)
+	b.WriteString("allow\n")
+
+	return b.String()
+}
+
+func (n ntp) generateDeployment(instance string, labels map[string]string,
+	configMap *corev1.ConfigMap) *appsv1.Deployment {
+	image := n.service.Image
+	if image == "" {
+		image = DefaultNTPImage
+	}
+
+	data := map[string][]byte{}
+	for key, value := range configMap.Data {
+		data[key] = []byte(value)
+	}
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance,
+			Namespace: n.ctx.Namespace(),
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					Annotations: map[string]string{
+						ConfigChecksumAnnotation: configChecksum(data),
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  NTPServiceType,
+							Image: image,
+							// chrony runs in the foreground and does not adjust the clock of the base cluster
+							// node, which it has no privileges to do.
+							Command: []string{"chronyd"},
+							Args:    []string{"-d", "-x", "-f", mountPathNTP + "/" + keyChronyConfig},
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          nameNTPPort,
+									ContainerPort: ntpPort,
+									Protocol:      corev1.ProtocolUDP,
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								Handler: corev1.Handler{
+									Exec: &corev1.ExecAction{
+										Command: []string{"chronyc", "tracking"},
+									},
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      nameNTPVolume,
+									MountPath: mountPathNTP,
+									ReadOnly:  true,
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: nameNTPVolume,
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: configMap.GetName(),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// generateService exposes chrony on the node port of the service when one is specified, and on a cluster IP
+// otherwise.
+func (n ntp) generateService(instance string, labels map[string]string) *corev1.Service {
+	serviceType := corev1.ServiceTypeClusterIP
+	if n.service.NodePort != 0 {
+		serviceType = corev1.ServiceTypeNodePort
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance,
+			Namespace: n.ctx.Namespace(),
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       nameNTPPort,
+					Port:       ntpPort,
+					Protocol:   corev1.ProtocolUDP,
+					TargetPort: intstr.FromString(nameNTPPort),
+					NodePort:   int32(n.service.NodePort),
+				},
+			},
+			Selector: labels,
+			Type:     serviceType,
+		},
+	}
+	if n.service.ClusterIP != nil {
+		service.Spec.ClusterIP = *n.service.ClusterIP
+	}
+
+	return service
+}
+
+// Finalize deletes the chrony Deployment, Service and configuration.
+func (n ntp) Finalize() error {
+	meta := metav1.ObjectMeta{Name: n.ctx.InstanceName(NTPServiceType), Namespace: n.ctx.Namespace()}
+	objs := []client.Object{
+		&appsv1.Deployment{ObjectMeta: meta},
+		&corev1.Service{ObjectMeta: meta},
+		&corev1.ConfigMap{ObjectMeta: meta},
+	}
+	for _, obj := range objs {
+		if err := n.ctx.Client.Delete(context.Background(), obj); err != nil && !apierror.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ready verifies that the chrony Deployment is available and reachable through its Service.
+func (n ntp) Ready() error {
+	key := client.ObjectKey{Name: n.ctx.InstanceName(NTPServiceType), Namespace: n.ctx.Namespace()}
+	if err := deploymentReady(NTPServiceType, key, n.ctx.Client); err != nil {
+		return err
+	}
+
+	return endpointsReady(NTPServiceType, key, n.ctx.Client)
+}
+
+// ReportStatus reports the endpoints on which time is served, with which tenant nodes can be provisioned.
+func (n ntp) ReportStatus(status *airshipv1.SIPClusterStatus) error {
+	instance := n.ctx.InstanceName(NTPServiceType)
+	endpoints, err := serviceEndpoints(client.ObjectKey{Name: instance, Namespace: n.ctx.Namespace()},
+		n.ctx.Client, nil)
+	if err != nil {
+		return err
+	}
+
+	setEndpoints(status, instance, endpoints)
+	return nil
+}
+
+// ConditionType returns the SIPCluster status condition type reporting the readiness of ntp services.
+func (n ntp) ConditionType() string {
+	return ConditionTypeNTPReady
+}
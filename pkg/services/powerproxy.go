@@ -0,0 +1,242 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	metal3 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+	bmcpower "sipcluster/pkg/bmc"
+	airshipvms "sipcluster/pkg/vbmh"
+)
+
+const (
+	// PowerProxyCertName and PowerProxyKeyName are the names of the serving certificate and key files in the power
+	// proxy certificate directory.
+	PowerProxyCertName = "tls.crt"
+	PowerProxyKeyName  = "tls.key"
+
+	// Reasons of the Events recorded on a SIPCluster for power actions.
+	ReasonPowerAction       = "PowerAction"
+	ReasonPowerActionFailed = "PowerActionFailed"
+
+	powerProxyShutdownTimeout = 10 * time.Second
+)
+
+// PowerProxy performs BMC power actions on behalf of SIPCluster jump hosts. Jump hosts authenticate with the token
+// stored in their Secret and never hold BMC credentials; the proxy reads them from the BMC credentials Secret of each
+// BMH instead. Every power action request is recorded in the audit log, and power actions performed on a host are
+// recorded as Events of the SIPCluster. Requests are attributed to the jump host whose token authenticated them; the
+// jump host users performing power actions are recorded in the jump host audit log.
+//
+// The power proxy is served over TLS only, with the certificate and key found in CertDir. Only Redfish BMCs are
+// supported: power actions on hosts with other BMCs, such as IPMI, are rejected as not implemented.
+//
+// Power actions are requested with:
+//
+//	POST /v1/sipclusters/<namespace>/<name>/hosts/<host>/<action>
+type PowerProxy struct {
+	Client   client.Client
+	Recorder record.EventRecorder
+	Log      logr.Logger
+	Addr     string
+	// CertDir is the directory holding the serving certificate and key of the power proxy.
+	CertDir string
+}
+
+// Start serves the power proxy until the context is cancelled.
+func (p *PowerProxy) Start(ctx context.Context) error {
+	if p.CertDir == "" {
+		return ErrPowerProxyCertificateRequired{}
+	}
+
+	server := &http.Server{
+		Addr:              p.Addr,
+		Handler:           p,
+		ReadHeaderTimeout: powerProxyShutdownTimeout,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		p.Log.Info("Starting power proxy", "addr", p.Addr, "certDir", p.CertDir)
+		errs <- server.ListenAndServeTLS(filepath.Join(p.CertDir, PowerProxyCertName),
+			filepath.Join(p.CertDir, PowerProxyKeyName))
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), powerProxyShutdownTimeout)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	case err := <-errs:
+		return err
+	}
+}
+
+// ServeHTTP handles power action requests from jump hosts.
+func (p *PowerProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Expected path: v1/sipclusters/<namespace>/<name>/hosts/<host>/<action>
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 7 || parts[0] != "v1" || parts[1] != "sipclusters" || parts[4] != "hosts" {
+		http.NotFound(w, r)
+		return
+	}
+
+	sipName := types.NamespacedName{Namespace: parts[2], Name: parts[3]}
+	hostName := parts[5]
+	action := bmcpower.PowerAction(parts[6])
+	audit := p.Log.WithName("audit").WithValues(
+		"sipcluster", sipName.String(),
+		"host", hostName,
+		"action", action,
+		"remote", r.RemoteAddr,
+	)
+
+	ctx := r.Context()
+	sip := airshipv1.SIPCluster{}
+	if err := p.Client.Get(ctx, sipName, &sip); err != nil {
+		audit.Info("Rejected power action", "reason", "unknown SIPCluster")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	requester, authorized := p.authorize(ctx, sip, r.Header.Get("Authorization"))
+	if !authorized {
+		audit.Info("Rejected power action", "reason", "invalid token")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	audit = audit.WithValues("requester", requester)
+
+	bmh, err := p.getHost(ctx, sip, hostName)
+	if err != nil {
+		audit.Info("Rejected power action", "reason", err.Error())
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	username, password, err := airshipvms.GetBMCCredentials(*bmh, p.Client)
+	if err != nil {
+		audit.Error(err, "Failed power action")
+		http.Error(w, "unable to retrieve BMC credentials", http.StatusInternalServerError)
+		return
+	}
+
+	err = bmcpower.Power(ctx, bmh.Spec.BMC.Address, bmcpower.Credentials{Username: username, Password: password},
+		bmh.Spec.BMC.DisableCertificateVerification, action)
+	switch {
+	case errors.As(err, &bmcpower.ErrUnsupportedPowerAction{}):
+		audit.Info("Rejected power action", "reason", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.As(err, &bmcpower.ErrUnsupportedBMCAddress{}):
+		audit.Info("Rejected power action", "reason", err.Error())
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	case err != nil:
+		audit.Error(err, "Failed power action")
+		p.recordEvent(&sip, corev1.EventTypeWarning, ReasonPowerActionFailed, "%s of host %s requested by %s failed: %v",
+			action, hostName, requester, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	audit.Info("Performed power action")
+	p.recordEvent(&sip, corev1.EventTypeNormal, ReasonPowerAction, "%s of host %s requested by %s succeeded",
+		action, hostName, requester)
+	fmt.Fprintf(w, "%s of host %s succeeded\n", action, hostName)
+}
+
+// recordEvent records an Event on the SIPCluster when an event recorder is configured.
+func (p *PowerProxy) recordEvent(sip *airshipv1.SIPCluster, eventType, reason, messageFmt string,
+	args ...interface{}) {
+	if p.Recorder == nil {
+		return
+	}
+
+	p.Recorder.Eventf(sip, eventType, reason, messageFmt, args...)
+}
+
+// authorize reports whether the Authorization header carries the power proxy token of the SIPCluster jump host, and
+// returns the requester the request is attributed to, which is the jump host holding the token.
+func (p *PowerProxy) authorize(ctx context.Context, sip airshipv1.SIPCluster, header string) (string, bool) {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return "", false
+	}
+
+	jumpHost := client.ObjectKey{
+		Namespace: sip.Spec.ClusterName,
+		Name:      JumpHostServiceName + "-" + sip.GetName(),
+	}
+	secret := &corev1.Secret{}
+	if err := p.Client.Get(ctx, jumpHost, secret); err != nil {
+		return "", false
+	}
+
+	token := secret.Data[nameTokenFile]
+	if len(token) == 0 || subtle.ConstantTimeCompare(token, []byte(strings.TrimPrefix(header, prefix))) != 1 {
+		return "", false
+	}
+
+	return "jump host " + jumpHost.String(), true
+}
+
+// getHost returns the BMH with the given name if it is scheduled to the SIPCluster.
+func (p *PowerProxy) getHost(ctx context.Context, sip airshipv1.SIPCluster, name string) (*metal3.BareMetalHost,
+	error) {
+	bmhList := &metal3.BareMetalHostList{}
+	err := p.Client.List(ctx, bmhList, client.MatchingLabels{
+		airshipvms.SipScheduleLabel: "true",
+		airshipvms.SipClusterLabel:  sip.Spec.ClusterName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range bmhList.Items {
+		if bmhList.Items[i].GetName() == name {
+			return &bmhList.Items[i], nil
+		}
+	}
+
+	return nil, ErrHostNotInSIPCluster{Host: name, SIPCluster: sip.GetName()}
+}
+
+// NeedLeaderElection allows every manager replica to serve power actions.
+func (p *PowerProxy) NeedLeaderElection() bool {
+	return false
+}
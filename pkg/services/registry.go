@@ -0,0 +1,111 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+	airshipvms "sipcluster/pkg/vbmh"
+)
+
+// ServiceFactory creates an infrastructure service of a registered type from its configuration in a SIPCluster.
+type ServiceFactory func(ctx ServiceContext, config airshipv1.CustomService) (InfraService, error)
+
+// ServiceContext provides the infrastructure services created by a ServiceFactory with the SIPCluster they are
+// deployed for, and the means to deploy their objects.
+type ServiceContext struct {
+	SIPCluster airshipv1.SIPCluster
+	Machines   *airshipvms.MachineList
+	Client     client.Client
+	Logger     logr.Logger
+
+	// name distinguishes the custom service from the other custom services of its type.
+	name  string
+	owner owner
+}
+
+// Namespace returns the namespace in which the objects of infrastructure services are deployed.
+func (sc ServiceContext) Namespace() string {
+	return sc.SIPCluster.Spec.ClusterName
+}
+
+// InstanceName returns the name of the instance of an infrastructure service type deployed for the SIPCluster. The
+// name of the custom service, if any, distinguishes it from the other instances of its type.
+func (sc ServiceContext) InstanceName(serviceType string) string {
+	if sc.name != "" {
+		return serviceType + "-" + sc.name + "-" + sc.SIPCluster.GetName()
+	}
+	return serviceType + "-" + sc.SIPCluster.GetName()
+}
+
+// Apply applies the desired state of an infrastructure service object, with the same field ownership and drift
+// correction as the objects of built-in infrastructure services.
+func (sc ServiceContext) Apply(obj client.Object) error {
+	return applyRuntimeObject(obj, sc.Client, sc.owner)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]ServiceFactory{}
+)
+
+// RegisterServiceType makes an infrastructure service type available to the custom services of SIPClusters. It is
+// intended to be called from the init function of the package implementing the service type, and panics if the
+// type is registered twice or the factory is nil.
+func RegisterServiceType(serviceType string, factory ServiceFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic(fmt.Sprintf("services: nil factory registered for service type %s", serviceType))
+	}
+	if _, exists := registry[serviceType]; exists {
+		panic(fmt.Sprintf("services: service type %s registered twice", serviceType))
+	}
+
+	registry[serviceType] = factory
+}
+
+// ServiceTypes returns the sorted list of registered infrastructure service types.
+func ServiceTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for serviceType := range registry {
+		types = append(types, serviceType)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// newCustomService creates a custom infrastructure service with the factory registered for its type.
+func newCustomService(ctx ServiceContext, config airshipv1.CustomService) (InfraService, error) {
+	registryMu.RLock()
+	factory, exists := registry[config.Type]
+	registryMu.RUnlock()
+	if !exists {
+		return nil, ErrUnknownServiceType{Type: config.Type, Registered: ServiceTypes()}
+	}
+
+	return factory(ctx, config)
+}
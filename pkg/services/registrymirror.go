@@ -0,0 +1,431 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+)
+
+const (
+	// RegistryMirrorServiceType is the type of custom services that run pull-through mirrors of container registries,
+	// configured by a RegistryMirrorConfig.
+	RegistryMirrorServiceType = "registry-mirror"
+
+	// ConditionTypeRegistryMirrorReady is the SIPCluster status condition type reporting the readiness of
+	// registry-mirror services.
+	ConditionTypeRegistryMirrorReady = "RegistryMirrorReady"
+
+	// DefaultRegistryMirrorImage is the registry image of registry-mirror services when none is specified.
+	DefaultRegistryMirrorImage = "registry:2"
+
+	// DefaultRegistryMirrorStorageSize is the size of the storage of registry-mirror services when none is specified.
+	DefaultRegistryMirrorStorageSize = "10Gi"
+
+	// registryBasePort is the port of the mirror of the first upstream. Mirrors of the following upstreams use the
+	// following ports.
+	registryBasePort       = 5000
+	mountPathRegistryData  = "/var/lib/registry"
+	mountPathRegistryTLS   = "/certs"
+	nameRegistryDataVolume = "data"
+	nameRegistryTLSVolume  = "tls"
+	keyRegistryCertificate = corev1.TLSCertKey
+	keyRegistryPrivateKey  = corev1.TLSPrivateKeyKey
+)
+
+func init() {
+	RegisterServiceType(RegistryMirrorServiceType, newRegistryMirror)
+}
+
+type registryMirror struct {
+	ctx     ServiceContext
+	service airshipv1.SIPClusterService
+	config  airshipv1.RegistryMirrorConfig
+}
+
+func newRegistryMirror(ctx ServiceContext, config airshipv1.CustomService) (InfraService, error) {
+	rm := registryMirror{ctx: ctx, service: config.SIPClusterService}
+	if err := json.Unmarshal(config.Config.Raw, &rm.config); err != nil {
+		return nil, ErrInvalidServiceConfig{Type: config.Type, Err: err}
+	}
+
+	if err := rm.validate(); err != nil {
+		return nil, ErrInvalidServiceConfig{Type: config.Type, Err: err}
+	}
+
+	return rm, nil
+}
+
+func (rm registryMirror) validate() error {
+	if len(rm.config.Upstreams) == 0 {
+		return errors.New("at least one upstream is required")
+	}
+
+	names := map[string]bool{}
+	for _, upstream := range rm.config.Upstreams {
+		// Upstream names are the names of the container and Service port of their mirror.
+		if errs := validation.IsValidPortName(upstream.Name); len(errs) > 0 {
+			return fmt.Errorf("upstream name %q is invalid: %s", upstream.Name, strings.Join(errs, ", "))
+		}
+		if names[upstream.Name] {
+			return fmt.Errorf("upstream name %q is not unique", upstream.Name)
+		}
+		names[upstream.Name] = true
+
+		u, err := url.Parse(upstream.URL)
+		if err != nil {
+			return err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("upstream %s URL %q is not an http or https URL", upstream.Name, upstream.URL)
+		}
+	}
+
+	return nil
+}
+
+// Deploy applies the storage, TLS Secret, Deployment and Service of the registry mirrors.
+func (rm registryMirror) Deploy() error {
+	instance := rm.ctx.InstanceName(RegistryMirrorServiceType)
+	labels := map[string]string{
+		// See https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/#labels
+		"app.kubernetes.io/part-of":   "sip",
+		"app.kubernetes.io/name":      RegistryMirrorServiceType,
+		"app.kubernetes.io/component": RegistryMirrorServiceType,
+		"app.kubernetes.io/instance":  instance,
+	}
+
+	claim, err := rm.generatePersistentVolumeClaim(instance, labels)
+	if err != nil {
+		return err
+	}
+
+	rm.ctx.Logger.Info("Applying persistent volume claim", "claim", claim.GetNamespace()+"/"+claim.GetName())
+	if err = rm.ctx.Apply(claim); err != nil {
+		return err
+	}
+
+	var tlsSecret *corev1.Secret
+	if rm.config.TLSSecretRef != nil {
+		tlsSecret, err = rm.generateTLSSecret(instance, labels)
+		if err != nil {
+			return err
+		}
+
+		rm.ctx.Logger.Info("Applying registry mirror TLS secret", "secret",
+			tlsSecret.GetNamespace()+"/"+tlsSecret.GetName())
+		if err = rm.ctx.Apply(tlsSecret); err != nil {
+			return err
+		}
+	}
+
+	deployment := rm.generateDeployment(instance, labels, tlsSecret)
+	rm.ctx.Logger.Info("Applying deployment", "deployment", deployment.GetNamespace()+"/"+deployment.GetName())
+	if err = rm.ctx.Apply(deployment); err != nil {
+		return err
+	}
+
+	service := rm.generateService(instance, labels)
+	rm.ctx.Logger.Info("Applying service", "service", service.GetNamespace()+"/"+service.GetName())
+	return rm.ctx.Apply(service)
+}
+
+func (rm registryMirror) generatePersistentVolumeClaim(instance string,
+	labels map[string]string) (*corev1.PersistentVolumeClaim, error) {
+	size := rm.config.Storage.Size
+	if size == nil {
+		defaultSize, err := resource.ParseQuantity(DefaultRegistryMirrorStorageSize)
+		if err != nil {
+			return nil, err
+		}
+		size = &defaultSize
+	}
+
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance,
+			Namespace: rm.ctx.Namespace(),
+			Labels:    labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: *size,
+				},
+			},
+			StorageClassName: rm.config.Storage.StorageClassName,
+		},
+	}, nil
+}
+
+// generateTLSSecret copies the serving certificate of the mirrors from the SIPCluster namespace to the namespace of
+// the mirrors.
+func (rm registryMirror) generateTLSSecret(instance string, labels map[string]string) (*corev1.Secret, error) {
+	ref := rm.config.TLSSecretRef
+	source := &corev1.Secret{}
+	err := rm.ctx.Client.Get(context.Background(), client.ObjectKey{
+		Name:      ref.Name,
+		Namespace: rm.ctx.SIPCluster.GetNamespace(),
+	}, source)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{}
+	for _, key := range []string{keyRegistryCertificate, keyRegistryPrivateKey} {
+		value, exists := source.Data[key]
+		if !exists {
+			return nil, ErrMalformedRegistryTLSSecret{SecretName: ref.Name, Key: key}
+		}
+		data[key] = value
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance + "-" + nameRegistryTLSVolume,
+			Namespace: rm.ctx.Namespace(),
+			Labels:    labels,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}, nil
+}
+
+// generateDeployment runs a registry container for each upstream, each caching the images of its upstream in its
+// own directory of the shared storage. Pods are recreated rather than rolled, since the storage can only be mounted
+// by one node at a time. They are also recreated whenever the serving certificate changes.
+func (rm registryMirror) generateDeployment(instance string, labels map[string]string,
+	tlsSecret *corev1.Secret) *appsv1.Deployment {
+	image := rm.service.Image
+	if image == "" {
+		image = DefaultRegistryMirrorImage
+	}
+
+	scheme := corev1.URISchemeHTTP
+	if tlsSecret != nil {
+		scheme = corev1.URISchemeHTTPS
+	}
+
+	containers := make([]corev1.Container, 0, len(rm.config.Upstreams))
+	for i, upstream := range rm.config.Upstreams {
+		container := corev1.Container{
+			Name:  upstream.Name,
+			Image: image,
+			Env: []corev1.EnvVar{
+				{Name: "REGISTRY_HTTP_ADDR", Value: ":" + strconv.Itoa(registryBasePort+i)},
+				{Name: "REGISTRY_PROXY_REMOTEURL", Value: upstream.URL},
+				{Name: "REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY", Value: mountPathRegistryData},
+			},
+			Ports: []corev1.ContainerPort{
+				{
+					Name:          upstream.Name,
+					ContainerPort: int32(registryBasePort + i),
+					Protocol:      corev1.ProtocolTCP,
+				},
+			},
+			ReadinessProbe: &corev1.Probe{
+				Handler: corev1.Handler{
+					HTTPGet: &corev1.HTTPGetAction{
+						Path:   "/",
+						Port:   intstr.FromString(upstream.Name),
+						Scheme: scheme,
+					},
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      nameRegistryDataVolume,
+					MountPath: mountPathRegistryData,
+					SubPath:   upstream.Name,
+				},
+			},
+		}
+
+		if tlsSecret != nil {
+			container.Env = append(container.Env,
+				corev1.EnvVar{
+					Name:  "REGISTRY_HTTP_TLS_CERTIFICATE",
+					Value: mountPathRegistryTLS + "/" + keyRegistryCertificate,
+				},
+				corev1.EnvVar{
+					Name:  "REGISTRY_HTTP_TLS_KEY",
+					Value: mountPathRegistryTLS + "/" + keyRegistryPrivateKey,
+				})
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      nameRegistryTLSVolume,
+				MountPath: mountPathRegistryTLS,
+				ReadOnly:  true,
+			})
+		}
+
+		containers = append(containers, container)
+	}
+
+	volumes := []corev1.Volume{
+		{
+			Name: nameRegistryDataVolume,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: instance,
+				},
+			},
+		},
+	}
+	annotations := map[string]string{}
+	if tlsSecret != nil {
+		volumes = append(volumes, corev1.Volume{
+			Name: nameRegistryTLSVolume,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  tlsSecret.GetName(),
+					DefaultMode: int32Ptr(0400),
+				},
+			},
+		})
+		annotations[ConfigChecksumAnnotation] = configChecksum(tlsSecret.Data)
+	}
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance,
+			Namespace: rm.ctx.Namespace(),
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      labels,
+					Annotations: annotations,
+				},
+				Spec: corev1.PodSpec{
+					Containers: containers,
+					Volumes:    volumes,
+				},
+			},
+		},
+	}
+}
+
+// generateService exposes the mirror of each upstream on its node port when any upstream specifies one, and on a
+// cluster IP otherwise.
+func (rm registryMirror) generateService(instance string, labels map[string]string) *corev1.Service {
+	serviceType := corev1.ServiceTypeClusterIP
+	ports := make([]corev1.ServicePort, 0, len(rm.config.Upstreams))
+	for i, upstream := range rm.config.Upstreams {
+		if upstream.NodePort != 0 {
+			serviceType = corev1.ServiceTypeNodePort
+		}
+
+		ports = append(ports, corev1.ServicePort{
+			Name:       upstream.Name,
+			Port:       int32(registryBasePort + i),
+			Protocol:   corev1.ProtocolTCP,
+			TargetPort: intstr.FromString(upstream.Name),
+			NodePort:   int32(upstream.NodePort),
+		})
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance,
+			Namespace: rm.ctx.Namespace(),
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports:    ports,
+			Selector: labels,
+			Type:     serviceType,
+		},
+	}
+	if rm.service.ClusterIP != nil {
+		service.Spec.ClusterIP = *rm.service.ClusterIP
+	}
+
+	return service
+}
+
+// Finalize deletes the registry mirrors, including their storage and the images they cached.
+func (rm registryMirror) Finalize() error {
+	instance := rm.ctx.InstanceName(RegistryMirrorServiceType)
+	meta := metav1.ObjectMeta{Name: instance, Namespace: rm.ctx.Namespace()}
+	objs := []client.Object{
+		&appsv1.Deployment{ObjectMeta: meta},
+		&corev1.Service{ObjectMeta: meta},
+		&corev1.PersistentVolumeClaim{ObjectMeta: meta},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      instance + "-" + nameRegistryTLSVolume,
+			Namespace: rm.ctx.Namespace(),
+		}},
+	}
+	for _, obj := range objs {
+		if err := rm.ctx.Client.Delete(context.Background(), obj); err != nil && !apierror.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ready verifies that the registry mirror Deployment is available and reachable through its Service.
+func (rm registryMirror) Ready() error {
+	key := client.ObjectKey{Name: rm.ctx.InstanceName(RegistryMirrorServiceType), Namespace: rm.ctx.Namespace()}
+	if err := deploymentReady(RegistryMirrorServiceType, key, rm.ctx.Client); err != nil {
+		return err
+	}
+
+	return endpointsReady(RegistryMirrorServiceType, key, rm.ctx.Client)
+}
+
+// ReportStatus reports the endpoints of the mirror of each upstream, named after the upstream.
+func (rm registryMirror) ReportStatus(status *airshipv1.SIPClusterStatus) error {
+	instance := rm.ctx.InstanceName(RegistryMirrorServiceType)
+	endpoints, err := serviceEndpoints(client.ObjectKey{Name: instance, Namespace: rm.ctx.Namespace()},
+		rm.ctx.Client, nil)
+	if err != nil {
+		return err
+	}
+
+	setEndpoints(status, instance, endpoints)
+	return nil
+}
+
+// ConditionType returns the SIPCluster status condition type reporting the readiness of registry-mirror services.
+func (rm registryMirror) ConditionType() string {
+	return ConditionTypeRegistryMirrorReady
+}
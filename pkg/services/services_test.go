@@ -3,6 +3,11 @@ package services_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 
 	airshipv1 "sipcluster/pkg/api/v1"
 
@@ -11,7 +16,18 @@ import (
 	. "github.com/onsi/gomega"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"sipcluster/pkg/services"
 	"sipcluster/pkg/vbmh"
@@ -24,6 +40,7 @@ const (
 )
 
 var bmh1 *metal3.BareMetalHost
+var eventRecorder = record.NewFakeRecorder(100)
 var bmh2 *metal3.BareMetalHost
 
 // Re-declared from services package for testing purposes
@@ -81,7 +98,7 @@ var _ = Describe("Service Set", func() {
 				},
 			}
 
-			set := services.NewServiceSet(logger, *sip, machineList, k8sClient)
+			set := services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
 
 			serviceList, err := set.ServiceList()
 			Expect(serviceList).To(HaveLen(2))
@@ -95,9 +112,1758 @@ var _ = Describe("Service Set", func() {
 				return testDeployment(sip, *machineList)
 			}, 5, 1).Should(Succeed())
 		})
+
+		It("Deploys libvirt console access on the jump host", func() {
+			By("Copying libvirt TLS certificates and generating console commands for scheduled hosts")
+
+			bmh1, _ = testutil.CreateBMH(1, "default", "control-plane", 1)
+			bmh2, _ = testutil.CreateBMH(2, "default", "control-plane", 2)
+
+			machineList := &vbmh.MachineList{
+				Machines: map[string]*vbmh.Machine{
+					bmh1.GetName(): {BMH: *bmh1, Data: &vbmh.MachineData{IPOnInterface: map[string]string{"eno3": ip1}}},
+					bmh2.GetName(): {BMH: *bmh2, Data: &vbmh.MachineData{IPOnInterface: map[string]string{"eno3": ip2}}},
+				},
+			}
+
+			tlsSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "libvirt-tls",
+					Namespace: "default",
+				},
+				Data: map[string][]byte{
+					"cacert.pem":     []byte("ca"),
+					"clientcert.pem": []byte("cert"),
+					"clientkey.pem":  []byte("key"),
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), tlsSecret)).Should(Succeed())
+
+			sip := testutil.CreateSIPCluster("console", "default", 1, 1)
+			sip.Spec.Services.LoadBalancer = nil
+			sip.Spec.Services.JumpHost[0].NodePort = 30011
+			sip.Spec.Services.JumpHost[0].Libvirt = &airshipv1.LibvirtOpts{
+				TLSSecretRef: corev1.LocalObjectReference{Name: tlsSecret.GetName()},
+				Hypervisors: map[string]string{
+					bmh1.GetName(): "10.0.0.1",
+					"node09":       "10.0.0.9",
+				},
+			}
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			for _, svc := range serviceList {
+				Expect(svc.Deploy()).To(Succeed())
+			}
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.JumpHostServiceName + "-" + sip.GetName(),
+			}
+
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(context.Background(), instance, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKey("console"))
+			Expect(configMap.Data["console"]).To(ContainSubstring(
+				"\"" + bmh1.GetName() + "\")\n      uri=\"qemu+tls://10.0.0.1/system?pkipath="))
+			Expect(configMap.Data["console"]).ToNot(ContainSubstring(bmh2.GetName()))
+			Expect(configMap.Data["console"]).ToNot(ContainSubstring("node09"))
+
+			copied := &corev1.Secret{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: instance.Namespace,
+				Name:      instance.Name + "-libvirt-tls",
+			}, copied)).To(Succeed())
+			Expect(copied.Data).To(Equal(tlsSecret.Data))
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(context.Background(), instance, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Volumes).To(ContainElement(corev1.Volume{
+				Name: "libvirt-tls",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName:  copied.GetName(),
+						DefaultMode: int32Ptr(0400),
+					},
+				},
+			}))
+		})
+
+		It("Performs power actions through the power proxy", func() {
+			By("Deploying a jump host that authenticates with a token instead of BMC credentials")
+
+			var resetType, authUser string
+			redfish := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/redfish/v1/Systems/1/Actions/ComputerSystem.Reset"))
+				body := map[string]string{}
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				resetType = body["ResetType"]
+				authUser, _, _ = r.BasicAuth()
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer redfish.Close()
+
+			sip := testutil.CreateSIPCluster("power-proxy", "default", 1, 1)
+			sip.Spec.Services.LoadBalancer = nil
+			sip.Spec.Services.JumpHost[0].NodePort = 30012
+			sip.Spec.Services.JumpHost[0].BMC = &airshipv1.BMCOpts{
+				Proxy:              true,
+				PowerProxyURL:      "https://sipcluster-power-proxy.sipcluster-system:8082",
+				PowerProxyCABundle: "ca-bundle",
+			}
+
+			bmcSecret := testutil.CreateBMCAuthSecret("node05", "default", "root", "password")
+			scheduled, _ := testutil.CreateBMH(5, "default", "control-plane", 1)
+			scheduled.Labels[vbmh.SipScheduleLabel] = "true"
+			scheduled.Labels[vbmh.SipClusterLabel] = sip.Spec.ClusterName
+			scheduled.Spec.BMC.Address = "redfish+" + redfish.URL + "/redfish/v1/Systems/1"
+			scheduled.Spec.BMC.CredentialsName = bmcSecret.GetName()
+			unscheduled, _ := testutil.CreateBMH(6, "default", "control-plane", 1)
+			ipmi, _ := testutil.CreateBMH(7, "default", "control-plane", 1)
+			ipmi.Labels[vbmh.SipScheduleLabel] = "true"
+			ipmi.Labels[vbmh.SipClusterLabel] = sip.Spec.ClusterName
+			ipmi.Spec.BMC.Address = "ipmi://192.168.111.7"
+			ipmi.Spec.BMC.CredentialsName = bmcSecret.GetName()
+
+			machineList := &vbmh.MachineList{
+				Machines: map[string]*vbmh.Machine{
+					scheduled.GetName(): {
+						BMH: *scheduled,
+						Data: &vbmh.MachineData{
+							IPOnInterface: map[string]string{"eno3": ip1},
+							BMCUsername:   "root",
+							BMCPassword:   "password",
+						},
+					},
+				},
+			}
+
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+			set := services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			for _, svc := range serviceList {
+				Expect(svc.Deploy()).To(Succeed())
+			}
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.JumpHostServiceName + "-" + sip.GetName(),
+			}
+
+			jumpHostSecret := &corev1.Secret{}
+			Expect(k8sClient.Get(context.Background(), instance, jumpHostSecret)).To(Succeed())
+			Expect(jumpHostSecret.Data).To(HaveKey("token"))
+			Expect(jumpHostSecret.Data).To(HaveKeyWithValue("power-proxy-ca.crt", []byte("ca-bundle")))
+			Expect(string(jumpHostSecret.Data["hosts"])).ToNot(ContainSubstring("password"))
+			token := string(jumpHostSecret.Data["token"])
+
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(context.Background(), instance, configMap)).To(Succeed())
+			Expect(configMap.Data["vm"]).To(ContainSubstring(
+				"https://sipcluster-power-proxy.sipcluster-system:8082/v1/sipclusters/default/power-proxy"))
+			Expect(configMap.Data["vm"]).To(ContainSubstring(`ca_opts="--cacert ${CA_FILE}"`))
+			Expect(configMap.Data["vm"]).NotTo(ContainSubstring("X-SIP-User"))
+
+			By("Rebooting a scheduled host with the jump host token")
+			recorder := record.NewFakeRecorder(10)
+			proxy := &services.PowerProxy{
+				Client: fake.NewFakeClientWithScheme(scheme.Scheme, sip, scheduled, unscheduled, ipmi, bmcSecret,
+					jumpHostSecret),
+				Recorder: recorder,
+				Log:      logger,
+			}
+
+			powerAction := func(host, token string) int {
+				req := httptest.NewRequest(http.MethodPost,
+					"/v1/sipclusters/default/power-proxy/hosts/"+host+"/reboot", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				req.Header.Set("X-SIP-User", "spoofed")
+				rec := httptest.NewRecorder()
+				proxy.ServeHTTP(rec, req)
+				return rec.Code
+			}
+
+			Expect(powerAction(scheduled.GetName(), "invalid")).To(Equal(http.StatusUnauthorized))
+			Expect(resetType).To(BeEmpty())
+			Expect(powerAction(unscheduled.GetName(), token)).To(Equal(http.StatusNotFound))
+			Expect(powerAction(scheduled.GetName(), token)).To(Equal(http.StatusOK))
+			Expect(resetType).To(Equal("GracefulRestart"))
+			Expect(authUser).To(Equal("root"))
+			Expect(recorder.Events).To(Receive(Equal(
+				"Normal PowerAction reboot of host node05 requested by jump host power-proxy/jumphost-power-proxy " +
+					"succeeded")))
+
+			By("Rejecting power actions on hosts without a Redfish BMC")
+			Expect(powerAction(ipmi.GetName(), token)).To(Equal(http.StatusNotImplemented))
+			Expect(recorder.Events).NotTo(Receive())
+
+			By("Serving the power proxy over TLS only")
+			Expect(proxy.Start(context.Background())).To(MatchError(services.ErrPowerProxyCertificateRequired{}))
+
+			By("Rejecting power proxy URLs that do not use HTTPS")
+			sip.Spec.Services.JumpHost[0].BMC.PowerProxyURL = "http://sipcluster-power-proxy.sipcluster-system:8082"
+			set = services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
+			serviceList, err = set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(MatchError(services.ErrInsecurePowerProxyURL{
+				URL: "http://sipcluster-power-proxy.sipcluster-system:8082",
+			}))
+		})
+
+		It("Deploys the jump host audit log", func() {
+			By("Forwarding session and power action records to the jump host output")
+
+			bmh1, _ = testutil.CreateBMH(1, "default", "control-plane", 1)
+			machineList := &vbmh.MachineList{
+				Machines: map[string]*vbmh.Machine{
+					bmh1.GetName(): {BMH: *bmh1, Data: &vbmh.MachineData{IPOnInterface: map[string]string{"eno3": ip1}}},
+				},
+			}
+
+			sip := testutil.CreateSIPCluster("audit", "default", 1, 1)
+			sip.Spec.Services.LoadBalancer = nil
+			sip.Spec.Services.JumpHost[0].NodePort = 30013
+			sip.Spec.Services.JumpHost[0].SessionLogging = true
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			for _, svc := range serviceList {
+				Expect(svc.Deploy()).To(Succeed())
+			}
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.JumpHostServiceName + "-" + sip.GetName(),
+			}
+
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(context.Background(), instance, configMap)).To(Succeed())
+			Expect(configMap.Data["audit"]).To(ContainSubstring(`AUDIT_LOG="/var/log/sip/audit.pipe"`))
+			Expect(configMap.Data["audit-profile"]).To(ContainSubstring("/opt/sip/bin/audit login"))
+			Expect(configMap.Data["vm"]).To(ContainSubstring(`audit "$1" reboot "${result}"`))
+			Expect(configMap.Data["audit-writer"]).To(ContainSubstring(`mkfifo -m 0622 "${AUDIT_PIPE}"`))
+			Expect(configMap.Data["audit-writer"]).To(ContainSubstring(`RECORD_EVENTS="true"`))
+			Expect(configMap.Data["audit-writer"]).To(ContainSubstring(`JUMP_HOST="audit/jumphost-audit"`))
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(context.Background(), instance, deployment)).To(Succeed())
+			podSpec := deployment.Spec.Template.Spec
+			Expect(podSpec.ServiceAccountName).To(Equal(instance.Name))
+			Expect(podSpec.Containers).To(HaveLen(2))
+			container := podSpec.Containers[0]
+			Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{
+				Name:      "vm",
+				MountPath: "/etc/profile.d/sip-audit.sh",
+				SubPath:   "audit-profile",
+				ReadOnly:  true,
+			}))
+			Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{
+				Name:      "service-account-mask",
+				MountPath: "/var/run/secrets/kubernetes.io/serviceaccount",
+			}))
+			Expect(podSpec.Containers[1].Name).To(Equal("audit"))
+			Expect(podSpec.Containers[1].Command).To(Equal([]string{"/bin/sh", "/opt/sip/bin/audit-writer"}))
+
+			By("Allowing the audit container to record power action Events of the SIPCluster")
+			Expect(k8sClient.Get(context.Background(), instance, &corev1.ServiceAccount{})).To(Succeed())
+			role := &rbacv1.Role{}
+			rbacKey := types.NamespacedName{Namespace: sip.GetNamespace(), Name: instance.Name}
+			Expect(k8sClient.Get(context.Background(), rbacKey, role)).To(Succeed())
+			Expect(role.Rules).To(Equal([]rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create"}},
+			}))
+			Expect(k8sClient.Get(context.Background(), rbacKey, &rbacv1.RoleBinding{})).To(Succeed())
+
+			By("Leaving power action Events to the power proxy")
+			sip.Spec.Services.JumpHost[0].BMC = &airshipv1.BMCOpts{
+				PowerProxyURL: "https://sipcluster-power-proxy.sipcluster-system:8082",
+			}
+			set = services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
+			serviceList, err = set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			Expect(k8sClient.Get(context.Background(), instance, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.ServiceAccountName).To(Equal("default"))
+			Expect(apierrors.IsNotFound(k8sClient.Get(context.Background(), rbacKey, role))).To(BeTrue())
+			Expect(apierrors.IsNotFound(k8sClient.Get(context.Background(), rbacKey, &rbacv1.RoleBinding{}))).To(BeTrue())
+
+			By("Leaving objects that were not created by SIP in place")
+			userRole := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: rbacKey.Name, Namespace: rbacKey.Namespace}}
+			Expect(k8sClient.Create(context.Background(), userRole)).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			Expect(serviceList[0].Finalize()).To(Succeed())
+			Expect(k8sClient.Get(context.Background(), rbacKey, role)).To(Succeed())
+		})
+
+		It("Deploys load balancer frontends", func() {
+			By("Forwarding each frontend to the VMs of its target role")
+
+			bmh1, _ = testutil.CreateBMH(1, "default", "control-plane", 1)
+			bmh2, _ = testutil.CreateBMH(2, "default", "worker", 2)
+			machineList := &vbmh.MachineList{
+				Machines: map[string]*vbmh.Machine{
+					bmh1.GetName(): {
+						BMH:    *bmh1,
+						VMRole: airshipv1.VMControlPlane,
+						Data:   &vbmh.MachineData{IPOnInterface: map[string]string{"eno3": ip1}},
+					},
+					bmh2.GetName(): {
+						BMH:    *bmh2,
+						VMRole: airshipv1.VMWorker,
+						Data:   &vbmh.MachineData{IPOnInterface: map[string]string{"eno3": ip2}},
+					},
+				},
+			}
+
+			sip := testutil.CreateSIPCluster("frontends", "default", 1, 1)
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.LoadBalancer[0].NodePort = 0
+			sip.Spec.Services.LoadBalancer[0].Frontends = []airshipv1.LoadBalancerFrontend{
+				{
+					Name:         "apiserver",
+					FrontendPort: 6443,
+					BackendPort:  6443,
+					HealthCheck:  &airshipv1.LoadBalancerHealthCheck{HTTPPath: "/readyz", SSL: true},
+					TargetRole:   airshipv1.VMControlPlane,
+					NodePort:     30014,
+				},
+				{
+					Name:         "ingress",
+					FrontendPort: 443,
+					BackendPort:  30443,
+					TargetRole:   airshipv1.VMWorker,
+					NodePort:     30015,
+				},
+			}
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			for _, svc := range serviceList {
+				Expect(svc.Deploy()).To(Succeed())
+			}
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.LoadBalancerServiceName + "-" + sip.GetName(),
+			}
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+			config := string(secret.Data["haproxy.cfg"])
+			Expect(config).To(ContainSubstring("frontend apiserver\n  bind *:6443\n  mode tcp"))
+			Expect(config).To(ContainSubstring("option httpchk GET /readyz"))
+			Expect(config).To(ContainSubstring("default-server check check-ssl verify none inter 5s downinter 2s"))
+			Expect(config).To(ContainSubstring("server node01 192.168.0.1:6443"))
+			Expect(config).To(ContainSubstring("frontend ingress\n  bind *:443\n  mode tcp"))
+			Expect(config).To(ContainSubstring("server node02 192.168.0.2:30443"))
+			Expect(config).ToNot(ContainSubstring("192.168.0.2:6443"))
+
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(context.Background(), instance, service)).To(Succeed())
+			Expect(service.Spec.Ports).To(HaveLen(2))
+			Expect(service.Spec.Ports[0].Name).To(Equal("apiserver"))
+			Expect(service.Spec.Ports[0].NodePort).To(Equal(int32(30014)))
+			Expect(service.Spec.Ports[1].Name).To(Equal("ingress"))
+			Expect(service.Spec.Ports[1].NodePort).To(Equal(int32(30015)))
+		})
+
+		It("Rejects invalid load balancer frontends", func() {
+			sip := testutil.CreateSIPCluster("duplicate-frontends", "default", 1, 1)
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.LoadBalancer[0].NodePort = 0
+			sip.Spec.Services.LoadBalancer[0].Metrics = &airshipv1.LoadBalancerMetrics{}
+			deploy := func(frontends ...airshipv1.LoadBalancerFrontend) error {
+				sip.Spec.Services.LoadBalancer[0].Frontends = frontends
+				set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+				serviceList, err := set.ServiceList()
+				Expect(err).To(Succeed())
+				Expect(serviceList).To(HaveLen(1))
+				return serviceList[0].Deploy()
+			}
+			ingress := airshipv1.LoadBalancerFrontend{
+				Name:         "ingress",
+				FrontendPort: 443,
+				BackendPort:  443,
+				TargetRole:   airshipv1.VMWorker,
+			}
+
+			By("Rejecting duplicate frontend names")
+			duplicate := ingress
+			duplicate.FrontendPort = 8443
+			Expect(deploy(ingress, duplicate)).To(MatchError(services.ErrInvalidLoadBalancerFrontend{
+				Name:   "ingress",
+				Reason: "duplicate frontend name",
+			}))
+
+			By("Rejecting names that are not valid port names")
+			invalid := ingress
+			invalid.Name = "1234"
+			Expect(deploy(invalid)).To(MatchError(ContainSubstring(
+				"invalid load balancer frontend '1234': invalid frontend name")))
+
+			By("Rejecting the names of the statistics frontend and metrics port")
+			for _, name := range []string{"stats", "metrics"} {
+				reserved := ingress
+				reserved.Name = name
+				Expect(deploy(reserved)).To(MatchError(services.ErrInvalidLoadBalancerFrontend{
+					Name:   name,
+					Reason: "reserved frontend name",
+				}))
+			}
+
+			By("Rejecting frontends on the metrics port")
+			metrics := ingress
+			metrics.FrontendPort = services.DefaultMetricsPort
+			Expect(deploy(metrics)).To(MatchError(services.ErrInvalidLoadBalancerFrontend{
+				Name:   "ingress",
+				Reason: "frontend port is the metrics port",
+			}))
+
+			By("Rejecting the node port of the load balancer combined with frontends")
+			sip.Spec.Services.LoadBalancer[0].NodePort = 30000
+			Expect(deploy(ingress)).To(MatchError(services.ErrInvalidLoadBalancerFrontend{
+				Name:   "ingress",
+				Reason: "nodePort of the load balancer cannot be combined with frontends, set the nodePort of each frontend",
+			}))
+		})
+
+		It("Renders a user-supplied load balancer template", func() {
+			By("Reading the template from a ConfigMap in the SIPCluster namespace")
+
+			templates := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "haproxy-templates",
+					Namespace: "default",
+				},
+				Data: map[string]string{
+					"valid": "# {{ .Cluster.Namespace }}/{{ .Cluster.Name }} in {{ .Cluster.ClusterName }}\n" +
+						"{{ range .Frontends }}frontend {{ .Name }}\n  bind *:{{ .FrontPort }}\n{{ end }}",
+					"invalid": "{{ .Frontends.Unknown }}",
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), templates)).Should(Succeed())
+
+			sip := testutil.CreateSIPCluster("template", "default", 1, 1)
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.LoadBalancer[0].NodePort = 30016
+			sip.Spec.Services.LoadBalancer[0].Template = &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: templates.GetName()},
+				Key:                  "valid",
+			}
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(1))
+			Expect(serviceList[0].Deploy()).To(Succeed())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.LoadBalancerServiceName + "-" + sip.GetName(),
+			}, secret)).To(Succeed())
+			Expect(string(secret.Data["haproxy.cfg"])).To(Equal(
+				"# default/template in template\nfrontend apiserver\n  bind *:6443\n"))
+
+			By("Reporting templates that cannot be rendered")
+			sip.Spec.Services.LoadBalancer[0].Template.Key = "invalid"
+			set = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err = set.ServiceList()
+			Expect(err).To(Succeed())
+			err = serviceList[0].Deploy()
+			Expect(err).To(BeAssignableToTypeOf(services.ErrInvalidLoadBalancerTemplate{}))
+			Expect(err.Error()).To(ContainSubstring("invalid load balancer template in ConfigMap haproxy-templates"))
+
+			sip.Spec.Services.LoadBalancer[0].Template.Key = "missing"
+			set = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err = set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(MatchError(services.ErrInvalidLoadBalancerTemplate{
+				ConfigMapName: "haproxy-templates",
+				Key:           "missing",
+			}))
+
+			sip.Spec.Services.LoadBalancer[0].Template.Name = "missing-templates"
+			set = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err = set.ServiceList()
+			Expect(err).To(Succeed())
+			err = serviceList[0].Deploy()
+			Expect(err).To(BeAssignableToTypeOf(services.ErrInvalidLoadBalancerTemplate{}))
+			Expect(apierrors.IsNotFound(errors.Unwrap(err))).To(BeTrue())
+		})
+
+		It("Deploys a highly available load balancer", func() {
+			By("Spreading replicas and assigning a virtual IP with keepalived")
+
+			sip := testutil.CreateSIPCluster("ha", "default", 1, 1)
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.LoadBalancer[0].NodePort = 30017
+			sip.Spec.Services.LoadBalancer[0].Replicas = int32Ptr(3)
+			sip.Spec.Services.LoadBalancer[0].VirtualIP = &airshipv1.VirtualIPOpts{
+				Address:   "10.23.25.100",
+				Interface: "bond0",
+			}
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(1))
+			Expect(serviceList[0].Deploy()).To(Succeed())
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.LoadBalancerServiceName + "-" + sip.GetName(),
+			}
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(context.Background(), instance, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+			podSpec := deployment.Spec.Template.Spec
+			Expect(podSpec.HostNetwork).To(BeTrue())
+			Expect(podSpec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution).To(HaveLen(1))
+			Expect(podSpec.Containers).To(HaveLen(2))
+			Expect(podSpec.Containers[1].Name).To(Equal("keepalived"))
+			Expect(podSpec.Containers[0].SecurityContext.Capabilities.Add).To(ConsistOf(corev1.Capability("NET_ADMIN")))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+			Expect(string(secret.Data["haproxy.cfg"])).To(ContainSubstring("bind 10.23.25.100:6443 transparent\n"))
+			Expect(string(secret.Data["haproxy.cfg"])).NotTo(ContainSubstring("bind *:6443"))
+			Expect(string(secret.Data["keepalived.conf"])).To(ContainSubstring("interface bond0"))
+			Expect(string(secret.Data["keepalived.conf"])).To(ContainSubstring("virtual_router_id 51"))
+			Expect(string(secret.Data["keepalived.conf"])).To(ContainSubstring("10.23.25.100"))
+
+			pdb := &policyv1beta1.PodDisruptionBudget{}
+			Expect(k8sClient.Get(context.Background(), instance, pdb)).To(Succeed())
+			Expect(pdb.Spec.MaxUnavailable.IntValue()).To(Equal(1))
+
+			By("Rejecting invalid virtual IPs")
+			sip.Spec.Services.LoadBalancer[0].VirtualIP.Address = "10.23.25"
+			set = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err = set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(MatchError(services.ErrInvalidVirtualIP{Address: "10.23.25"}))
+		})
+
+		It("Binds only the virtual IP of load balancers on the host network", func() {
+			By("Rendering non-conflicting binds for the load balancers of two SIPClusters")
+
+			for i, vip := range []string{"10.23.25.110", "10.23.25.111"} {
+				sip := testutil.CreateSIPCluster(fmt.Sprintf("vip-%d", i), "default", 1, 1)
+				sip.Spec.Services.JumpHost = nil
+				sip.Spec.Services.LoadBalancer[0].NodePort = 30032 + i
+				sip.Spec.Services.LoadBalancer[0].VirtualIP = &airshipv1.VirtualIPOpts{
+					Address:   vip,
+					Interface: "bond0",
+				}
+				sip.Spec.Services.LoadBalancer[0].Metrics = &airshipv1.LoadBalancerMetrics{}
+				Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+				set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+				serviceList, err := set.ServiceList()
+				Expect(err).To(Succeed())
+				Expect(serviceList[0].Deploy()).To(Succeed())
+
+				instance := types.NamespacedName{
+					Namespace: sip.Spec.ClusterName,
+					Name:      services.LoadBalancerServiceName + "-" + sip.GetName(),
+				}
+				secret := &corev1.Secret{}
+				Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+				config := string(secret.Data["haproxy.cfg"])
+				Expect(config).To(ContainSubstring("frontend apiserver\n  bind " + vip + ":6443 transparent\n"))
+				Expect(config).To(ContainSubstring("frontend stats\n  bind " + vip + ":8405 transparent\n"))
+				Expect(config).NotTo(ContainSubstring("bind *:"))
+
+				By("Routing the metrics Service to the virtual IP")
+				metricsKey := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name + "-metrics"}
+				metricsService := &corev1.Service{}
+				Expect(k8sClient.Get(context.Background(), metricsKey, metricsService)).To(Succeed())
+				Expect(metricsService.Spec.Selector).To(BeEmpty())
+				endpoints := &corev1.Endpoints{}
+				Expect(k8sClient.Get(context.Background(), metricsKey, endpoints)).To(Succeed())
+				Expect(endpoints.Subsets).To(HaveLen(1))
+				Expect(endpoints.Subsets[0].Addresses).To(Equal([]corev1.EndpointAddress{{IP: vip}}))
+				Expect(endpoints.Subsets[0].Ports[0].Port).To(Equal(int32(8405)))
+			}
+		})
+
+		It("Rolls load balancer pods when the configuration changes", func() {
+			By("Updating the configuration checksum when backends are added")
+
+			bmh1, _ = testutil.CreateBMH(1, "default", "control-plane", 1)
+			bmh2, _ = testutil.CreateBMH(2, "default", "control-plane", 2)
+			machineList := &vbmh.MachineList{
+				Machines: map[string]*vbmh.Machine{
+					bmh1.GetName(): {
+						BMH:    *bmh1,
+						VMRole: airshipv1.VMControlPlane,
+						Data:   &vbmh.MachineData{IPOnInterface: map[string]string{"eno3": ip1}},
+					},
+				},
+			}
+
+			sip := testutil.CreateSIPCluster("rolling", "default", 1, 1)
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.LoadBalancer[0].NodePort = 0
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			deploy := func() (*appsv1.Deployment, *corev1.Secret, *corev1.Service) {
+				set := services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
+				serviceList, err := set.ServiceList()
+				Expect(err).To(Succeed())
+				Expect(serviceList).To(HaveLen(1))
+				Expect(serviceList[0].Deploy()).To(Succeed())
+
+				instance := types.NamespacedName{
+					Namespace: sip.Spec.ClusterName,
+					Name:      services.LoadBalancerServiceName + "-" + sip.GetName(),
+				}
+				deployment := &appsv1.Deployment{}
+				Expect(k8sClient.Get(context.Background(), instance, deployment)).To(Succeed())
+				secret := &corev1.Secret{}
+				Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+				service := &corev1.Service{}
+				Expect(k8sClient.Get(context.Background(), instance, service)).To(Succeed())
+				return deployment, secret, service
+			}
+
+			deployment, secret, service := deploy()
+			checksum := deployment.Spec.Template.Annotations[services.ConfigChecksumAnnotation]
+			Expect(checksum).ToNot(BeEmpty())
+			Expect(string(secret.Data["haproxy.cfg"])).ToNot(ContainSubstring(ip2))
+			Expect(deployment.Spec.Strategy.RollingUpdate.MaxUnavailable.IntValue()).To(Equal(0))
+			nodePort := service.Spec.Ports[0].NodePort
+
+			machineList.Machines[bmh2.GetName()] = &vbmh.Machine{
+				BMH:    *bmh2,
+				VMRole: airshipv1.VMControlPlane,
+				Data:   &vbmh.MachineData{IPOnInterface: map[string]string{"eno3": ip2}},
+			}
+
+			deployment, secret, service = deploy()
+			Expect(string(secret.Data["haproxy.cfg"])).To(ContainSubstring(ip2))
+			Expect(deployment.Spec.Template.Annotations[services.ConfigChecksumAnnotation]).ToNot(Equal(checksum))
+			Expect(service.Spec.Ports[0].NodePort).To(Equal(nodePort))
+		})
+
+		It("Deploys load balancer metrics", func() {
+			By("Exposing HAProxy statistics and reporting backend state")
+
+			stats := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/stats;csv"))
+				_, err := w.Write([]byte(
+					"# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr," +
+						"wredis,status,weight\n" +
+						"apiserver,FRONTEND,,,0,0,262124,0,0,0,0,0,0,,,,,OPEN,\n" +
+						"apiserver-backends,node01,0,0,0,0,,0,0,0,,0,,0,0,0,0,UP,1\n" +
+						"apiserver-backends,node02,0,0,0,0,,0,0,0,,0,,0,0,0,0,DOWN,1\n" +
+						"apiserver-backends,BACKEND,0,0,0,0,26213,0,0,0,0,0,,0,0,0,0,UP,1\n" +
+						"stats,FRONTEND,,,1,1,262124,1,0,0,0,0,0,,,,,OPEN,\n"))
+				Expect(err).ToNot(HaveOccurred())
+			}))
+			defer stats.Close()
+
+			var statsService client.ObjectKey
+			defer services.SetStatsURL(func(service client.ObjectKey, port int) string {
+				statsService = service
+				return stats.URL + "/stats;csv"
+			})()
+
+			sip := testutil.CreateSIPCluster("metrics", "default", 1, 1)
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.LoadBalancer[0].NodePort = 30018
+			sip.Spec.Services.LoadBalancer[0].Metrics = &airshipv1.LoadBalancerMetrics{}
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(1))
+			Expect(serviceList[0].Deploy()).To(Succeed())
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.LoadBalancerServiceName + "-" + sip.GetName(),
+			}
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+			Expect(string(secret.Data["haproxy.cfg"])).To(ContainSubstring(
+				"frontend stats\n  bind *:8405\n  mode http"))
+			Expect(string(secret.Data["haproxy.cfg"])).To(ContainSubstring(
+				"http-request use-service prometheus-exporter if { path /metrics }"))
+
+			metricsService := &corev1.Service{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: instance.Namespace,
+				Name:      instance.Name + "-metrics",
+			}, metricsService)).To(Succeed())
+			Expect(metricsService.Labels).To(HaveKeyWithValue(vbmh.SipClusterLabel, sip.Spec.ClusterName))
+			Expect(metricsService.Spec.Ports[0].Port).To(Equal(int32(8405)))
+
+			reporter, ok := serviceList[0].(services.StatusReporter)
+			Expect(ok).To(BeTrue())
+			status := airshipv1.SIPClusterStatus{}
+			Expect(reporter.ReportStatus(&status)).To(Succeed())
+			Expect(statsService.Name).To(Equal(metricsService.GetName()))
+			Expect(status.LoadBalancers).To(HaveLen(1))
+			Expect(status.LoadBalancers[0].Name).To(Equal(instance.Name))
+			Expect(status.LoadBalancers[0].Backends).To(Equal([]airshipv1.LoadBalancerBackendStatus{
+				{Backend: "apiserver-backends", Server: "node01", State: "UP"},
+				{Backend: "apiserver-backends", Server: "node02", State: "DOWN"},
+			}))
+		})
+
+		It("Verifies infrastructure service readiness", func() {
+			By("Waiting for the Deployment, Service endpoints and a load balancer backend")
+
+			bmh1, _ = testutil.CreateBMH(1, "default", "control-plane", 1)
+			machineList := &vbmh.MachineList{
+				Machines: map[string]*vbmh.Machine{
+					bmh1.GetName(): {
+						BMH:    *bmh1,
+						VMRole: airshipv1.VMControlPlane,
+						Data:   &vbmh.MachineData{IPOnInterface: map[string]string{"eno3": ip1}},
+					},
+				},
+			}
+
+			sip := testutil.CreateSIPCluster("readiness", "default", 1, 1)
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.LoadBalancer[0].NodePort = 30019
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(1))
+			lb := serviceList[0]
+			Expect(lb.Deploy()).To(Succeed())
+			Expect(lb.ConditionType()).To(Equal(airshipv1.ConditionTypeLoadBalancerReady))
+			Expect(lb.Ready()).To(BeAssignableToTypeOf(services.ErrServiceNotReady{}))
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.LoadBalancerServiceName + "-" + sip.GetName(),
+			}
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(context.Background(), instance, deployment)).To(Succeed())
+			deployment.Status = appsv1.DeploymentStatus{
+				ObservedGeneration: deployment.Generation,
+				Replicas:           1,
+				UpdatedReplicas:    1,
+				ReadyReplicas:      1,
+				AvailableReplicas:  1,
+				Conditions: []appsv1.DeploymentCondition{
+					{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+				},
+			}
+			Expect(k8sClient.Status().Update(context.Background(), deployment)).To(Succeed())
+			Expect(lb.Ready()).To(MatchError(ContainSubstring("has no ready endpoints")))
+
+			Expect(k8sClient.Create(context.Background(), &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Name: instance.Name, Namespace: instance.Namespace},
+				Subsets: []corev1.EndpointSubset{
+					{
+						Addresses: []corev1.EndpointAddress{{IP: "10.0.0.10"}},
+						Ports:     []corev1.EndpointPort{{Name: "apiserver", Port: 6443}},
+					},
+				},
+			})).To(Succeed())
+
+			var probed []string
+			backendUp := false
+			defer services.SetProbeBackend(func(address string) error {
+				probed = append(probed, address)
+				if !backendUp {
+					return errors.New("connection refused")
+				}
+				return nil
+			})()
+
+			Expect(lb.Ready()).To(MatchError(ContainSubstring("no backend accepts connections")))
+			Expect(probed).To(ConsistOf("192.168.0.1:6443"))
+
+			backendUp = true
+			Expect(lb.Ready()).To(Succeed())
+		})
+
+		It("Uses the addresses of the selected families", func() {
+			By("Forwarding to each address of dual-stack hosts")
+
+			bmh1, _ = testutil.CreateBMH(1, "default", "control-plane", 1)
+			machineList := &vbmh.MachineList{
+				Machines: map[string]*vbmh.Machine{
+					bmh1.GetName(): {
+						BMH:    *bmh1,
+						VMRole: airshipv1.VMControlPlane,
+						Data: &vbmh.MachineData{
+							Addresses: map[string][]vbmh.Address{
+								"oam-ipv4": {{IP: ip1, Family: corev1.IPv4Protocol, Link: "bond0.41"}},
+								"oam-ipv6": {{IP: "fd00::1", Family: corev1.IPv6Protocol, Link: "bond0.41"}},
+							},
+						},
+					},
+				},
+			}
+
+			sip := testutil.CreateSIPCluster("dualstack", "default", 1, 1)
+			sip.Spec.Services.LoadBalancer[0].NodeInterface = "oam-ipv4"
+			sip.Spec.Services.LoadBalancer[0].IPFamily = airshipv1.IPFamilyDualStack
+			sip.Spec.Services.LoadBalancer[0].NodePort = 30025
+			sip.Spec.Services.JumpHost[0].NodeInterface = "oam-ipv4"
+			sip.Spec.Services.JumpHost[0].IPFamily = airshipv1.IPFamilyIPv6
+			sip.Spec.Services.JumpHost[0].NodePort = 30026
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			for _, svc := range serviceList {
+				Expect(svc.Deploy()).To(Succeed())
+			}
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.LoadBalancerServiceName + "-" + sip.GetName(),
+			}, secret)).To(Succeed())
+			config := string(secret.Data["haproxy.cfg"])
+			Expect(config).To(ContainSubstring("server node01-0 192.168.0.1:6443\n  server node01-1 [fd00::1]:6443"))
+			Expect(config).To(ContainSubstring("frontend apiserver\n  bind :::6443 v4v6\n"))
+
+			By("Aliasing the jump host to the addresses of the selected family")
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.JumpHostServiceName + "-" + sip.GetName(),
+			}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.HostAliases).To(Equal([]corev1.HostAlias{
+				{IP: "fd00::1", Hostnames: []string{bmh1.GetName()}},
+			}))
+		})
+
+		It("Publishes service endpoints", func() {
+			By("Reporting the virtual IP, node ports and cluster IPs of the load balancer and jump host")
+
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "endpoints-node"}}
+			Expect(k8sClient.Create(context.Background(), node)).To(Succeed())
+			node.Status.Addresses = []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "endpoints-node"},
+				{Type: corev1.NodeInternalIP, Address: "10.23.0.5"},
+			}
+			Expect(k8sClient.Status().Update(context.Background(), node)).To(Succeed())
+			defer func() {
+				Expect(k8sClient.Delete(context.Background(), node)).To(Succeed())
+			}()
+
+			sip := testutil.CreateSIPCluster("endpoints", "default", 1, 1)
+			sip.Spec.Services.LoadBalancer[0].NodePort = 30020
+			sip.Spec.Services.LoadBalancer[0].VirtualIP = &airshipv1.VirtualIPOpts{
+				Address:   "10.23.25.101",
+				Interface: "bond0",
+			}
+			sip.Spec.Services.JumpHost[0].NodePort = 30021
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(2))
+
+			status := airshipv1.SIPClusterStatus{}
+			for _, svc := range serviceList {
+				Expect(svc.Deploy()).To(Succeed())
+				reporter, ok := svc.(services.StatusReporter)
+				Expect(ok).To(BeTrue())
+				Expect(reporter.ReportStatus(&status)).To(Succeed())
+			}
+
+			clusterIP := func(name string) string {
+				service := &corev1.Service{}
+				Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+					Namespace: sip.Spec.ClusterName,
+					Name:      name,
+				}, service)).To(Succeed())
+				return service.Spec.ClusterIP
+			}
+
+			lbName := services.LoadBalancerServiceName + "-" + sip.GetName()
+			jhName := services.JumpHostServiceName + "-" + sip.GetName()
+			Expect(status.Endpoints).To(ConsistOf(
+				airshipv1.ServiceEndpoint{
+					Service:   lbName,
+					Name:      "apiserver",
+					Addresses: []string{"10.23.25.101:6443", "10.23.0.5:30020", clusterIP(lbName) + ":6443"},
+				},
+				airshipv1.ServiceEndpoint{
+					Service:   jhName,
+					Name:      "ssh",
+					Addresses: []string{"10.23.0.5:30021", clusterIP(jhName) + ":22"},
+				},
+			))
+
+			By("Replacing previously reported endpoints")
+			Expect(serviceList[0].(services.StatusReporter).ReportStatus(&status)).To(Succeed())
+			Expect(status.Endpoints).To(HaveLen(2))
+		})
+
+		It("Updates the control plane endpoint of a Cluster API cluster", func() {
+			By("Patching the referenced Metal3Cluster from the published load balancer endpoint")
+
+			metal3Cluster := &unstructured.Unstructured{}
+			metal3Cluster.SetAPIVersion("infrastructure.cluster.x-k8s.io/v1alpha4")
+			metal3Cluster.SetKind("Metal3Cluster")
+			metal3Cluster.SetName("endpoint-cluster")
+			metal3Cluster.SetNamespace("default")
+			Expect(k8sClient.Create(context.Background(), metal3Cluster)).To(Succeed())
+
+			sip := testutil.CreateSIPCluster("controlplane", "default", 1, 1)
+			sip.Spec.ControlPlaneEndpointRef = &airshipv1.ControlPlaneEndpointRef{
+				APIVersion: metal3Cluster.GetAPIVersion(),
+				Kind:       metal3Cluster.GetKind(),
+				Name:       metal3Cluster.GetName(),
+			}
+
+			err := services.UpdateControlPlaneEndpoint(*sip, k8sClient, logger)
+			Expect(err).To(BeAssignableToTypeOf(services.ErrControlPlaneEndpointUnavailable{}))
+
+			sip.Status.Endpoints = []airshipv1.ServiceEndpoint{
+				{
+					Service:   services.JumpHostServiceName + "-" + sip.GetName(),
+					Name:      "ssh",
+					Addresses: []string{"10.23.0.5:30001"},
+				},
+				{
+					Service:   services.LoadBalancerServiceName + "-" + sip.GetName(),
+					Name:      "apiserver",
+					Addresses: []string{"10.23.25.102:6443", "10.23.0.5:30000"},
+				},
+			}
+			Expect(services.UpdateControlPlaneEndpoint(*sip, k8sClient, logger)).To(Succeed())
+
+			key := client.ObjectKeyFromObject(metal3Cluster)
+			Expect(k8sClient.Get(context.Background(), key, metal3Cluster)).To(Succeed())
+			endpoint, _, err := unstructured.NestedMap(metal3Cluster.Object, "spec", "controlPlaneEndpoint")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoint).To(Equal(map[string]interface{}{"host": "10.23.25.102", "port": int64(6443)}))
+
+			By("Following the load balancer when its address changes")
+			sip.Status.Endpoints[1].Addresses = []string{"10.23.0.6:30000"}
+			Expect(services.UpdateControlPlaneEndpoint(*sip, k8sClient, logger)).To(Succeed())
+			Expect(k8sClient.Get(context.Background(), key, metal3Cluster)).To(Succeed())
+			endpoint, _, err = unstructured.NestedMap(metal3Cluster.Object, "spec", "controlPlaneEndpoint")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoint).To(Equal(map[string]interface{}{"host": "10.23.0.6", "port": int64(30000)}))
+		})
+
+		It("Generates and patches Metal3MachineTemplates", func() {
+			By("Selecting the hosts scheduled for each VM role")
+
+			existing := &unstructured.Unstructured{}
+			existing.SetAPIVersion("infrastructure.cluster.x-k8s.io/v1alpha4")
+			existing.SetKind("Metal3MachineTemplate")
+			existing.SetName("templates-workers")
+			existing.SetNamespace("default")
+			Expect(unstructured.SetNestedMap(existing.Object, map[string]interface{}{
+				"image": map[string]interface{}{"url": "http://images/worker.qcow2", "checksum": "worker.md5sum"},
+				"hostSelector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{"rack": "r01"},
+				},
+			}, "spec", "template", "spec")).To(Succeed())
+			Expect(k8sClient.Create(context.Background(), existing)).To(Succeed())
+
+			sip := testutil.CreateSIPCluster("templates", "default", 1, 1)
+			controlPlane := sip.Spec.Nodes[airshipv1.VMControlPlane]
+			controlPlane.MachineTemplate = &airshipv1.MachineTemplateOpts{
+				Name: "templates-control-plane",
+				Image: &airshipv1.MachineImage{
+					URL:        "http://images/control-plane.qcow2",
+					Checksum:   "control-plane.md5sum",
+					DiskFormat: "qcow2",
+				},
+			}
+			sip.Spec.Nodes[airshipv1.VMControlPlane] = controlPlane
+			worker := sip.Spec.Nodes[airshipv1.VMWorker]
+			worker.MachineTemplate = &airshipv1.MachineTemplateOpts{Name: existing.GetName()}
+			sip.Spec.Nodes[airshipv1.VMWorker] = worker
+
+			Expect(services.UpdateMachineTemplates(*sip, k8sClient, logger)).To(Succeed())
+
+			hostSelector := func(name string) map[string]interface{} {
+				template := &unstructured.Unstructured{}
+				template.SetGroupVersionKind(existing.GroupVersionKind())
+				Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+					Namespace: "default",
+					Name:      name,
+				}, template)).To(Succeed())
+				selector, _, err := unstructured.NestedMap(template.Object, "spec", "template", "spec", "hostSelector")
+				Expect(err).ToNot(HaveOccurred())
+				return selector
+			}
+
+			Expect(hostSelector("templates-control-plane")).To(Equal(map[string]interface{}{
+				"matchLabels": map[string]interface{}{
+					vbmh.SipScheduleLabel: "true",
+					vbmh.SipClusterLabel:  sip.Spec.ClusterName,
+					vbmh.SipNodeTypeLabel: string(airshipv1.VMControlPlane),
+				},
+			}))
+			Expect(hostSelector(existing.GetName())).To(Equal(map[string]interface{}{
+				"matchLabels": map[string]interface{}{
+					vbmh.SipScheduleLabel: "true",
+					vbmh.SipClusterLabel:  sip.Spec.ClusterName,
+					vbmh.SipNodeTypeLabel: string(airshipv1.VMWorker),
+				},
+			}))
+
+			By("Requiring an image to generate a missing Metal3MachineTemplate")
+			worker.MachineTemplate = &airshipv1.MachineTemplateOpts{Name: "templates-missing"}
+			sip.Spec.Nodes[airshipv1.VMWorker] = worker
+			err := services.UpdateMachineTemplates(*sip, k8sClient, logger)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("Applies service objects with server-side apply", func() {
+			By("Preserving fields of other field managers")
+
+			sip := testutil.CreateSIPCluster("apply", "default", 1, 1)
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.LoadBalancer[0].NodePort = 30022
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(1))
+			Expect(serviceList[0].Deploy()).To(Succeed())
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.LoadBalancerServiceName + "-" + sip.GetName(),
+			}
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(context.Background(), instance, service)).To(Succeed())
+			managers := []string{}
+			for _, entry := range service.GetManagedFields() {
+				managers = append(managers, entry.Manager)
+			}
+			Expect(managers).To(ContainElement(services.FieldManager))
+
+			service.Annotations = map[string]string{"example.com/owner": "another-controller"}
+			Expect(k8sClient.Update(context.Background(), service)).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			Expect(k8sClient.Get(context.Background(), instance, service)).To(Succeed())
+			Expect(service.Annotations).To(HaveKeyWithValue("example.com/owner", "another-controller"))
+			Expect(service.Spec.Ports[0].NodePort).To(Equal(int32(30022)))
+
+			By("Restoring objects changed by others and recording the correction")
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+			Expect(secret.Labels).To(HaveKeyWithValue(services.SIPClusterNameLabel, sip.GetName()))
+			Expect(secret.Labels).To(HaveKeyWithValue(services.SIPClusterNamespaceLabel, sip.GetNamespace()))
+			desired := secret.Data["haproxy.cfg"]
+			secret.Data["haproxy.cfg"] = []byte("global\n")
+			Expect(k8sClient.Update(context.Background(), secret)).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+			Expect(secret.Data["haproxy.cfg"]).To(Equal(desired))
+			Expect(eventRecorder.Events).To(Receive(Equal(
+				"Warning DriftCorrected Restored Secret " + instance.String() + " to its desired state")))
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			Expect(eventRecorder.Events).ToNot(Receive())
+
+			By("Ignoring changes to fields that are not set by SIP")
+			Expect(k8sClient.Get(context.Background(), instance, service)).To(Succeed())
+			service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.23.25.200"}}
+			Expect(k8sClient.Status().Update(context.Background(), service)).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			Expect(eventRecorder.Events).ToNot(Receive())
+
+			By("Applying desired state changes to objects changed by others")
+			Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+			secret.Data["haproxy.cfg"] = []byte("global\n")
+			Expect(k8sClient.Update(context.Background(), secret)).To(Succeed())
+			sip.Spec.Services.LoadBalancer[0].Metrics = &airshipv1.LoadBalancerMetrics{}
+			serviceList, err = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient,
+				eventRecorder).ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+			Expect(string(secret.Data["haproxy.cfg"])).To(ContainSubstring("frontend stats"))
+			Expect(eventRecorder.Events).ToNot(Receive())
+
+			By("Taking over fields of objects without the desired state annotation")
+			delete(secret.Annotations, services.DesiredStateAnnotation)
+			secret.Data["haproxy.cfg"] = []byte("global\n")
+			Expect(k8sClient.Update(context.Background(), secret)).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+			Expect(secret.Data["haproxy.cfg"]).ToNot(Equal([]byte("global\n")))
+			Expect(secret.Annotations).To(HaveKey(services.DesiredStateAnnotation))
+
+			By("Correcting drift without an event recorder")
+			secret.Data["haproxy.cfg"] = []byte("global\n")
+			Expect(k8sClient.Update(context.Background(), secret)).To(Succeed())
+			serviceList, err = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient,
+				nil).ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			Expect(k8sClient.Get(context.Background(), instance, secret)).To(Succeed())
+			Expect(secret.Data["haproxy.cfg"]).ToNot(Equal([]byte("global\n")))
+		})
+
+		It("Deploys custom services of registered types", func() {
+			By("Creating services with the factory registered for their type")
+
+			services.RegisterServiceType("greeting", newGreetingService)
+			Expect(services.ServiceTypes()).To(ContainElement("greeting"))
+			Expect(func() { services.RegisterServiceType("greeting", newGreetingService) }).To(Panic())
+
+			sip := testutil.CreateSIPCluster("custom", "default", 1, 1)
+			sip.Spec.Services.LoadBalancer = nil
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.Custom = []airshipv1.CustomService{
+				{
+					Type:   "greeting",
+					Config: runtime.RawExtension{Raw: []byte(`{"message":"hello"}`)},
+				},
+			}
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(1))
+			Expect(serviceList[0].ConditionType()).To(Equal("GreetingReady"))
+			Expect(serviceList[0].Deploy()).To(Succeed())
+
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      "greeting-" + sip.GetName(),
+			}, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKeyWithValue("message", "hello"))
+			Expect(configMap.Labels).To(HaveKeyWithValue(services.SIPClusterNameLabel, sip.GetName()))
+
+			By("Deploying named services of the same type as separate instances")
+			sip.Spec.Services.Custom = append(sip.Spec.Services.Custom, airshipv1.CustomService{
+				Type:   "greeting",
+				Name:   "farewell",
+				Config: runtime.RawExtension{Raw: []byte(`{"message":"goodbye"}`)},
+			})
+			serviceList, err = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient,
+				eventRecorder).ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(2))
+			Expect(serviceList[1].Deploy()).To(Succeed())
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      "greeting-farewell-" + sip.GetName(),
+			}, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKeyWithValue("message", "goodbye"))
+
+			By("Rejecting services of the same type and name")
+			sip.Spec.Services.Custom[1].Name = ""
+			_, err = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder).ServiceList()
+			Expect(err).To(Equal(services.ErrDuplicateCustomService{Type: "greeting"}))
+
+			By("Rejecting services of unknown types")
+			sip.Spec.Services.Custom[1].Type = "unknown"
+			_, err = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder).ServiceList()
+			Expect(err).To(BeAssignableToTypeOf(services.ErrUnknownServiceType{}))
+
+			By("Finalizing the services that can be created")
+			set = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			Expect(set.FinalizableServiceList()).To(HaveLen(1))
+		})
+
+		It("Deploys manifest templates", func() {
+			By("Rendering the templates against the scheduled hosts")
+
+			bmh1, _ = testutil.CreateBMH(1, "default", "control-plane", 1)
+			bmh2, _ = testutil.CreateBMH(2, "default", "worker", 2)
+			machineList := &vbmh.MachineList{
+				Machines: map[string]*vbmh.Machine{
+					bmh1.GetName(): {
+						BMH:    *bmh1,
+						VMRole: airshipv1.VMControlPlane,
+						Data:   &vbmh.MachineData{IPOnInterface: map[string]string{"oam-ipv4": ip1}},
+					},
+					bmh2.GetName(): {
+						BMH:    *bmh2,
+						VMRole: airshipv1.VMWorker,
+						Data:   &vbmh.MachineData{IPOnInterface: map[string]string{"oam-ipv4": ip2}},
+					},
+				},
+			}
+
+			templates := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "manifests", Namespace: "default"},
+				Data: map[string]string{
+					"hosts.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .InstanceName }}-hosts
+data:
+  cluster: {{ .Cluster.ClusterName }}
+{{- range .Hosts }}
+  {{ .Name }}: "{{ .Role }} {{ index .IPOnInterface "oam-ipv4" }} {{ .BMCAddress }}"
+{{- end }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .InstanceName }}
+spec:
+  ports:
+  - name: http
+    port: 80
+    protocol: TCP
+---
+`,
+					"per-host.yaml": `{{- range .Hosts }}
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ $.InstanceName }}-{{ .Name }}
+{{- end }}
+`,
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), templates)).To(Succeed())
+
+			sip := testutil.CreateSIPCluster("manifests", "default", 1, 1)
+			sip.Spec.Services.LoadBalancer = nil
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.Custom = []airshipv1.CustomService{
+				{
+					Type:   services.ManifestTemplateServiceType,
+					Config: runtime.RawExtension{Raw: []byte(`{"configMap":{"name":"manifests"}}`)},
+				},
+			}
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(1))
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			Expect(serviceList[0].Ready()).To(Succeed())
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.ManifestTemplateServiceType + "-" + sip.GetName(),
+			}
+			hosts := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: instance.Namespace,
+				Name:      instance.Name + "-hosts",
+			}, hosts)).To(Succeed())
+			Expect(hosts.Data).To(Equal(map[string]string{
+				"cluster":      sip.Spec.ClusterName,
+				bmh1.GetName(): "ControlPlane " + ip1 + " " + bmh1.Spec.BMC.Address,
+				bmh2.GetName(): "Worker " + ip2 + " " + bmh2.Spec.BMC.Address,
+			}))
+			Expect(k8sClient.Get(context.Background(), instance, &corev1.Service{})).To(Succeed())
+			hostSecret := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name + "-" + bmh1.GetName()}
+			Expect(k8sClient.Get(context.Background(), hostSecret, &corev1.Secret{})).To(Succeed())
+
+			By("Deleting objects no longer rendered")
+			hostsTemplate := templates.Data["hosts.yaml"]
+			templates.Data["hosts.yaml"] = strings.SplitAfter(hostsTemplate, "---\n")[0]
+			Expect(k8sClient.Update(context.Background(), templates)).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(Succeed())
+			err = k8sClient.Get(context.Background(), instance, &corev1.Service{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			templates.Data["hosts.yaml"] = hostsTemplate
+			Expect(k8sClient.Update(context.Background(), templates)).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(Succeed())
+
+			By("Deleting the applied objects on finalization without the hosts and templates")
+			Expect(k8sClient.Delete(context.Background(), templates)).To(Succeed())
+			serviceList, err = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient,
+				eventRecorder).ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList[0].Finalize()).To(Succeed())
+			err = k8sClient.Get(context.Background(), instance, &corev1.Service{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			err = k8sClient.Get(context.Background(), hostSecret, &corev1.Secret{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			Expect(serviceList[0].Finalize()).To(Succeed())
+
+			By("Reporting templates that cannot be rendered")
+			templates.ResourceVersion = ""
+			templates.Data["broken.yaml"] = "metadata:\n  name: {{ .Missing }}\n"
+			Expect(k8sClient.Create(context.Background(), templates)).To(Succeed())
+			err = serviceList[0].Deploy()
+			Expect(err).To(BeAssignableToTypeOf(services.ErrInvalidManifestTemplate{}))
+			Expect(err).To(MatchError(ContainSubstring("key 'broken.yaml'")))
+		})
+
+		It("Deploys a DNS zone of the scheduled hosts", func() {
+			By("Generating records for the hosts, their roles, the load balancer and the jump host")
+
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "dns-node"}}
+			Expect(k8sClient.Create(context.Background(), node)).To(Succeed())
+			node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.23.0.7"}}
+			Expect(k8sClient.Status().Update(context.Background(), node)).To(Succeed())
+			defer func() {
+				Expect(k8sClient.Delete(context.Background(), node)).To(Succeed())
+			}()
+
+			bmh1, _ = testutil.CreateBMH(1, "default", "control-plane", 1)
+			bmh2, _ = testutil.CreateBMH(2, "default", "worker", 2)
+			machineList := &vbmh.MachineList{
+				Machines: map[string]*vbmh.Machine{
+					bmh1.GetName(): {
+						BMH:    *bmh1,
+						VMRole: airshipv1.VMControlPlane,
+						Data:   &vbmh.MachineData{IPOnInterface: map[string]string{"oam-ipv4": ip1}},
+					},
+				},
+			}
+
+			sip := testutil.CreateSIPCluster("dns", "default", 1, 1)
+			sip.Spec.Services.Custom = []airshipv1.CustomService{
+				{
+					SIPClusterService: airshipv1.SIPClusterService{NodePort: 30023, NodeInterface: "oam-ipv4"},
+					Type:              services.DNSServiceType,
+					Config:            runtime.RawExtension{Raw: []byte(`{"upstreams":["10.23.0.53"]}`)},
+				},
+			}
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			dnsService := func(machines *vbmh.MachineList) services.InfraService {
+				set := services.NewServiceSet(logger, *sip, machines, k8sClient, eventRecorder)
+				serviceList, err := set.ServiceList()
+				Expect(err).To(Succeed())
+				Expect(serviceList).To(HaveLen(3))
+				return serviceList[2]
+			}
+			Expect(dnsService(machineList).Deploy()).To(Succeed())
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.DNSServiceType + "-" + sip.GetName(),
+			}
+			zone := func() string {
+				configMap := &corev1.ConfigMap{}
+				Expect(k8sClient.Get(context.Background(), instance, configMap)).To(Succeed())
+				Expect(configMap.Data["Corefile"]).To(ContainSubstring("forward . 10.23.0.53"))
+				return configMap.Data["db.zone"]
+			}
+			Expect(zone()).To(And(
+				HavePrefix("$ORIGIN "+sip.Spec.ClusterName+".sip.local.\n$TTL 60\n"),
+				HaveSuffix("api IN A 10.23.0.7\n"+
+					"controlplane IN A "+ip1+"\n"+
+					"jumphost IN A 10.23.0.7\n"+
+					bmh1.GetName()+" IN A "+ip1+"\n"),
+			))
+
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(context.Background(), instance, service)).To(Succeed())
+			Expect(service.Spec.Type).To(Equal(corev1.ServiceTypeNodePort))
+			Expect(service.Spec.Ports).To(HaveLen(2))
+			for _, port := range service.Spec.Ports {
+				Expect(port.NodePort).To(Equal(int32(30023)))
+			}
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(context.Background(), instance, deployment)).To(Succeed())
+			checksum := deployment.Spec.Template.Annotations[services.ConfigChecksumAnnotation]
+
+			By("Refreshing the records and rolling CoreDNS as hosts change")
+			machineList.Machines[bmh2.GetName()] = &vbmh.Machine{
+				BMH:    *bmh2,
+				VMRole: airshipv1.VMWorker,
+				Data:   &vbmh.MachineData{IPOnInterface: map[string]string{"oam-ipv4": ip2}},
+			}
+			Expect(dnsService(machineList).Deploy()).To(Succeed())
+			Expect(zone()).To(HaveSuffix(bmh1.GetName() + " IN A " + ip1 + "\n" +
+				bmh2.GetName() + " IN A " + ip2 + "\n" +
+				"worker IN A " + ip2 + "\n"))
+			Expect(k8sClient.Get(context.Background(), instance, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Annotations[services.ConfigChecksumAnnotation]).NotTo(Equal(checksum))
+
+			By("Reporting the endpoints of the zone")
+			status := airshipv1.SIPClusterStatus{}
+			Expect(dnsService(machineList).(services.StatusReporter).ReportStatus(&status)).To(Succeed())
+			Expect(status.Endpoints).To(ConsistOf(
+				airshipv1.ServiceEndpoint{
+					Service:   instance.Name,
+					Name:      "dns",
+					Addresses: []string{"10.23.0.7:30023", service.Spec.ClusterIP + ":53"},
+				},
+				airshipv1.ServiceEndpoint{
+					Service:   instance.Name,
+					Name:      "dns-tcp",
+					Addresses: []string{"10.23.0.7:30023", service.Spec.ClusterIP + ":53"},
+				},
+			))
+
+			By("Rejecting invalid configuration")
+			sip.Spec.Services.Custom[0].Config = runtime.RawExtension{Raw: []byte(`{"upstreams":["dns.example"]}`)}
+			_, err := services.NewServiceSet(logger, *sip, machineList, k8sClient, eventRecorder).ServiceList()
+			Expect(err).To(BeAssignableToTypeOf(services.ErrInvalidServiceConfig{}))
+		})
+
+		It("Deploys an NTP server", func() {
+			By("Configuring chrony with the upstreams and exposing it on a cluster IP")
+
+			sip := testutil.CreateSIPCluster("ntp", "default", 1, 1)
+			sip.Spec.Services.LoadBalancer = nil
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.Custom = []airshipv1.CustomService{
+				{
+					Type:   services.NTPServiceType,
+					Config: runtime.RawExtension{Raw: []byte(`{"upstreams":["ntp.example.com","10.23.0.123"]}`)},
+				},
+			}
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(1))
+			Expect(serviceList[0].Deploy()).To(Succeed())
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.NTPServiceType + "-" + sip.GetName(),
+			}
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(context.Background(), instance, configMap)).To(Succeed())
+			Expect(configMap.Data["chrony.conf"]).To(Equal("server ntp.example.com iburst\n" +
+				"server 10.23.0.123 iburst\n" +
+				"local stratum 10\n" +
+				"allow\n"))
+			Expect(k8sClient.Get(context.Background(), instance, &appsv1.Deployment{})).To(Succeed())
+
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(context.Background(), instance, service)).To(Succeed())
+			Expect(service.Spec.Type).To(Equal(corev1.ServiceTypeClusterIP))
+
+			By("Reporting the endpoint of the NTP server")
+			status := airshipv1.SIPClusterStatus{}
+			Expect(serviceList[0].(services.StatusReporter).ReportStatus(&status)).To(Succeed())
+			Expect(status.Endpoints).To(ConsistOf(airshipv1.ServiceEndpoint{
+				Service:   instance.Name,
+				Name:      "ntp",
+				Addresses: []string{service.Spec.ClusterIP + ":123"},
+			}))
+
+			By("Deleting the NTP server on finalization")
+			Expect(serviceList[0].Finalize()).To(Succeed())
+			err = k8sClient.Get(context.Background(), instance, &corev1.ConfigMap{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			By("Rejecting invalid upstreams")
+			sip.Spec.Services.Custom[0].Config = runtime.RawExtension{Raw: []byte(`{"upstreams":["ntp example"]}`)}
+			_, err = services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder).ServiceList()
+			Expect(err).To(BeAssignableToTypeOf(services.ErrInvalidServiceConfig{}))
+		})
+
+		It("Deploys registry mirrors", func() {
+			By("Running a mirror of each upstream on persistent storage, served with the referenced certificate")
+
+			tlsSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "mirror-tls", Namespace: "default"},
+				Data: map[string][]byte{
+					corev1.TLSCertKey:       []byte("certificate"),
+					corev1.TLSPrivateKeyKey: []byte("key"),
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), tlsSecret)).To(Succeed())
+
+			sip := testutil.CreateSIPCluster("mirror", "default", 1, 1)
+			sip.Spec.Services.LoadBalancer = nil
+			sip.Spec.Services.JumpHost = nil
+			sip.Spec.Services.Custom = []airshipv1.CustomService{
+				{
+					Type: services.RegistryMirrorServiceType,
+					Config: runtime.RawExtension{Raw: []byte(`{
+  "upstreams": [
+    {"name": "docker", "url": "https://registry-1.docker.io", "nodePort": 30024},
+    {"name": "quay", "url": "https://quay.io"}
+  ],
+  "storage": {"size": "50Gi"},
+  "tlsSecretRef": {"name": "mirror-tls"}
+}`)},
+				},
+			}
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).Should(Succeed())
+
+			set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			Expect(serviceList).To(HaveLen(1))
+			Expect(serviceList[0].Deploy()).To(Succeed())
+
+			instance := types.NamespacedName{
+				Namespace: sip.Spec.ClusterName,
+				Name:      services.RegistryMirrorServiceType + "-" + sip.GetName(),
+			}
+			claim := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(context.Background(), instance, claim)).To(Succeed())
+			Expect(claim.Spec.Resources.Requests.Storage().String()).To(Equal("50Gi"))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+				Namespace: instance.Namespace,
+				Name:      instance.Name + "-tls",
+			}, secret)).To(Succeed())
+			Expect(secret.Data).To(Equal(tlsSecret.Data))
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(context.Background(), instance, deployment)).To(Succeed())
+			containers := deployment.Spec.Template.Spec.Containers
+			Expect(containers).To(HaveLen(2))
+			Expect(containers[0].Env).To(ContainElements(
+				corev1.EnvVar{Name: "REGISTRY_HTTP_ADDR", Value: ":5000"},
+				corev1.EnvVar{Name: "REGISTRY_PROXY_REMOTEURL", Value: "https://registry-1.docker.io"},
+				corev1.EnvVar{Name: "REGISTRY_HTTP_TLS_CERTIFICATE", Value: "/certs/tls.crt"},
+			))
+			Expect(containers[1].Env).To(ContainElements(
+				corev1.EnvVar{Name: "REGISTRY_HTTP_ADDR", Value: ":5001"},
+				corev1.EnvVar{Name: "REGISTRY_PROXY_REMOTEURL", Value: "https://quay.io"},
+			))
+			Expect(containers[1].VolumeMounts[0].SubPath).To(Equal("quay"))
+
+			By("Reporting the endpoint of each mirror")
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(context.Background(), instance, service)).To(Succeed())
+			Expect(service.Spec.Type).To(Equal(corev1.ServiceTypeNodePort))
+
+			status := airshipv1.SIPClusterStatus{}
+			Expect(serviceList[0].(services.StatusReporter).ReportStatus(&status)).To(Succeed())
+			Expect(status.Endpoints).To(HaveLen(2))
+			Expect(status.Endpoints[0].Name).To(Equal("docker"))
+			Expect(status.Endpoints[0].Addresses).To(ContainElement(service.Spec.ClusterIP + ":5000"))
+			Expect(status.Endpoints[1].Name).To(Equal("quay"))
+			Expect(status.Endpoints[1].Addresses).To(ContainElement(service.Spec.ClusterIP + ":5001"))
+
+			By("Deleting the mirrors on finalization")
+			Expect(serviceList[0].Finalize()).To(Succeed())
+			err = k8sClient.Get(context.Background(), instance, &appsv1.Deployment{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			By("Reporting TLS secrets without a private key")
+			delete(tlsSecret.Data, corev1.TLSPrivateKeyKey)
+			Expect(k8sClient.Update(context.Background(), tlsSecret)).To(Succeed())
+			Expect(serviceList[0].Deploy()).To(BeAssignableToTypeOf(services.ErrMalformedRegistryTLSSecret{}))
+		})
+
+		It("Allocates infrastructure service IPs from IP pools", func() {
+			ctx := context.Background()
+
+			// The Services of other specs are assigned random cluster IPs, so the pool is made of blocks that none of
+			// them uses.
+			existing := &corev1.ServiceList{}
+			Expect(k8sClient.List(ctx, existing)).To(Succeed())
+			inUse := map[string]bool{}
+			for _, service := range existing.Items {
+				inUse[service.Spec.ClusterIP] = true
+			}
+			address := func(i int) string { return fmt.Sprintf("10.0.0.%d", i) }
+			freeBlock := func(from, size int) int {
+				for base := from; base+size <= 255; base += size {
+					free := true
+					for i := base; i < base+size; i++ {
+						free = free && !inUse[address(i)]
+					}
+					if free {
+						return base
+					}
+				}
+				Fail("no free block of cluster IPs")
+				return 0
+			}
+			lbBlock := freeBlock(200, 4)
+			jumpHostBlock := freeBlock(lbBlock+4, 4)
+			last := freeBlock(jumpHostBlock+4, 1)
+
+			pool := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "ip-pool", Namespace: "default"},
+				Data: map[string]string{services.IPPoolCIDRsKey: fmt.Sprintf("%s/30\n%s/30\n%s/32",
+					address(lbBlock), address(jumpHostBlock), address(last))},
+			}
+			Expect(k8sClient.Create(ctx, pool)).To(Succeed())
+			poolRef := &airshipv1.IPPoolReference{Name: pool.Name}
+			services.RegisterServiceType("clusterip", newClusterIPService)
+
+			sip := testutil.CreateSIPCluster("ipam", "default", 1, 1)
+			sip.Spec.Services = airshipv1.SIPClusterServices{
+				LoadBalancer: []airshipv1.LoadBalancerService{
+					{
+						SIPClusterService: airshipv1.SIPClusterService{
+							NodeInterface: "oam-ipv4",
+							NodePort:      30030,
+							ClusterIPPool: poolRef,
+						},
+						VirtualIP: &airshipv1.VirtualIPOpts{Interface: "eth0", AddressPool: poolRef},
+					},
+				},
+				JumpHost: []airshipv1.JumpHostService{
+					{
+						SIPClusterService: airshipv1.SIPClusterService{
+							Image:         "ubuntu:20.04",
+							NodeInterface: "oam-ipv4",
+							NodePort:      30031,
+							ClusterIPPool: poolRef,
+						},
+					},
+				},
+				Custom: []airshipv1.CustomService{
+					{Type: "clusterip", Name: "a", Config: runtime.RawExtension{Raw: []byte("{}")}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, sip)).To(Succeed())
+			Expect(services.CreateNS(sip.Spec.ClusterName, k8sClient)).To(Succeed())
+			updateStatus := func() {
+				Expect(retry.RetryOnConflict(retry.DefaultRetry, func() error {
+					latest := &airshipv1.SIPCluster{}
+					if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(sip), latest); err != nil {
+						return err
+					}
+					latest.Status = sip.Status
+					return k8sClient.Status().Update(ctx, latest)
+				})).To(Succeed())
+			}
+			deployedClusterIP := func(name string) string {
+				service := &corev1.Service{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: sip.Spec.ClusterName,
+					Name:      name,
+				}, service)).To(Succeed())
+				return service.Spec.ClusterIP
+			}
+			deployCustom := func() string {
+				set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+				serviceList, err := set.ServiceList()
+				Expect(err).To(Succeed())
+				Expect(serviceList[len(serviceList)-1].Deploy()).To(Succeed())
+				return deployedClusterIP("clusterip-a-ipam")
+			}
+
+			By("Applying the allocated cluster IPs to the deployed Services")
+			spec := sip.Spec.DeepCopy()
+			Expect(services.AllocateIPs(sip, k8sClient)).To(Succeed())
+			Expect(*sip.Spec.Services.LoadBalancer[0].ClusterIP).To(Equal(address(lbBlock + 1)))
+			Expect(sip.Spec.Services.LoadBalancer[0].VirtualIP.Address).To(Equal(address(lbBlock + 2)))
+			Expect(*sip.Spec.Services.JumpHost[0].ClusterIP).To(Equal(address(jumpHostBlock + 1)))
+			Expect(sip.Status.IPAllocations).To(Equal([]airshipv1.IPAllocation{
+				{
+					Service: "loadbalancer-ipam",
+					Type:    airshipv1.IPAllocationClusterIP,
+					Address: address(lbBlock + 1),
+					Pool:    "default/ip-pool",
+				},
+				{
+					Service: "loadbalancer-ipam",
+					Type:    airshipv1.IPAllocationVirtualIP,
+					Address: address(lbBlock + 2),
+					Pool:    "default/ip-pool",
+				},
+				{
+					Service: "jumphost-ipam",
+					Type:    airshipv1.IPAllocationClusterIP,
+					Address: address(jumpHostBlock + 1),
+					Pool:    "default/ip-pool",
+				},
+			}))
+			set := services.NewServiceSet(logger, *sip, &vbmh.MachineList{}, k8sClient, eventRecorder)
+			serviceList, err := set.ServiceList()
+			Expect(err).To(Succeed())
+			for _, svc := range serviceList {
+				Expect(svc.Deploy()).To(Succeed())
+			}
+			Expect(deployedClusterIP("loadbalancer-ipam")).To(Equal(address(lbBlock + 1)))
+			Expect(deployedClusterIP("jumphost-ipam")).To(Equal(address(jumpHostBlock + 1)))
+
+			By("Deploying a Service whose cluster IP is assigned by Kubernetes")
+			Expect(deployedClusterIP("clusterip-a-ipam")).NotTo(BeEmpty())
+			updateStatus()
+
+			By("Recreating the Service when its cluster IP is allocated from a pool")
+			spec.Services.Custom[0].ClusterIPPool = poolRef
+			spec.Services.Custom = append(spec.Services.Custom, airshipv1.CustomService{
+				SIPClusterService: airshipv1.SIPClusterService{ClusterIPPool: poolRef},
+				Type:              "clusterip",
+				Name:              "b",
+				Config:            runtime.RawExtension{Raw: []byte("{}")},
+			})
+			spec.DeepCopyInto(&sip.Spec)
+			Expect(services.AllocateIPs(sip, k8sClient)).To(Succeed())
+			Expect(sip.Status.IPAllocations).To(HaveLen(5))
+			Expect(*sip.Spec.Services.Custom[0].ClusterIP).To(Equal(address(jumpHostBlock + 2)))
+			Expect(*sip.Spec.Services.Custom[1].ClusterIP).To(Equal(address(last)))
+			sip.Spec.Services.Custom = sip.Spec.Services.Custom[:1]
+			Expect(deployCustom()).To(Equal(address(jumpHostBlock + 2)))
+			updateStatus()
+
+			By("Keeping the addresses of reordered services")
+			spec.Services.Custom[0], spec.Services.Custom[1] = spec.Services.Custom[1], spec.Services.Custom[0]
+			spec.DeepCopyInto(&sip.Spec)
+			Expect(services.AllocateIPs(sip, k8sClient)).To(Succeed())
+			Expect(sip.Spec.Services.Custom[0].Name).To(Equal("b"))
+			Expect(*sip.Spec.Services.Custom[0].ClusterIP).To(Equal(address(last)))
+			Expect(*sip.Spec.Services.Custom[1].ClusterIP).To(Equal(address(jumpHostBlock + 2)))
+			updateStatus()
+
+			By("Rejecting addresses in use by another SIPCluster")
+			other := testutil.CreateSIPCluster("ipam-other", "default", 1, 1)
+			other.Spec.Services = airshipv1.SIPClusterServices{
+				JumpHost: []airshipv1.JumpHostService{
+					{
+						SIPClusterService: airshipv1.SIPClusterService{
+							NodeInterface: "oam-ipv4",
+							ClusterIP:     stringPtr(address(jumpHostBlock + 1)),
+						},
+					},
+				},
+			}
+			Expect(services.AllocateIPs(other, k8sClient)).To(Equal(services.ErrIPAddressInUse{
+				Address:      address(jumpHostBlock + 1),
+				Service:      "jumphost-ipam-other",
+				SIPCluster:   "default/ipam",
+				OtherService: "jumphost-ipam",
+			}))
+
+			By("Rejecting allocations from an exhausted pool")
+			other.Spec.Services.JumpHost[0].ClusterIP = nil
+			other.Spec.Services.JumpHost[0].ClusterIPPool = poolRef
+			otherSpec := other.Spec.DeepCopy()
+			Expect(services.AllocateIPs(other, k8sClient)).To(Equal(services.ErrIPPoolExhausted{
+				Pool:    "default/ip-pool",
+				Service: "jumphost-ipam-other",
+			}))
+
+			By("Allocating released addresses")
+			sip.Status.IPAllocations = nil
+			updateStatus()
+			otherSpec.DeepCopyInto(&other.Spec)
+			Expect(services.AllocateIPs(other, k8sClient)).To(Succeed())
+			Expect(*other.Spec.Services.JumpHost[0].ClusterIP).To(Equal(address(lbBlock + 1)))
+		})
 	})
 })
 
+func int32Ptr(i int32) *int32 { return &i }
+
+func stringPtr(s string) *string { return &s }
+
 func testDeployment(sip *airshipv1.SIPCluster, machineList vbmh.MachineList) error {
 	loadBalancerDeployment := &appsv1.Deployment{}
 	err := k8sClient.Get(context.Background(), types.NamespacedName{
@@ -179,3 +1945,59 @@ func testDeployment(sip *airshipv1.SIPCluster, machineList vbmh.MachineList) err
 
 	return nil
 }
+
+// greetingService is a custom infrastructure service deploying a ConfigMap holding its configured message.
+type greetingService struct {
+	ctx     services.ServiceContext
+	message string
+}
+
+func newGreetingService(ctx services.ServiceContext, config airshipv1.CustomService) (services.InfraService, error) {
+	greeting := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(config.Config.Raw, &greeting); err != nil {
+		return nil, err
+	}
+
+	return greetingService{ctx: ctx, message: greeting.Message}, nil
+}
+
+func (g greetingService) Deploy() error {
+	return g.ctx.Apply(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: g.ctx.InstanceName("greeting"), Namespace: g.ctx.Namespace()},
+		Data:       map[string]string{"message": g.message},
+	})
+}
+
+func (g greetingService) Finalize() error { return nil }
+
+func (g greetingService) Ready() error { return nil }
+
+func (g greetingService) ConditionType() string { return "GreetingReady" }
+
+type clusterIPService struct {
+	ctx    services.ServiceContext
+	config airshipv1.CustomService
+}
+
+func newClusterIPService(ctx services.ServiceContext, config airshipv1.CustomService) (services.InfraService, error) {
+	return clusterIPService{ctx: ctx, config: config}, nil
+}
+
+func (s clusterIPService) Deploy() error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: s.ctx.InstanceName("clusterip"), Namespace: s.ctx.Namespace()},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 53, Protocol: corev1.ProtocolUDP}}},
+	}
+	if s.config.ClusterIP != nil {
+		service.Spec.ClusterIP = *s.config.ClusterIP
+	}
+	return s.ctx.Apply(service)
+}
+
+func (s clusterIPService) Finalize() error { return nil }
+
+func (s clusterIPService) Ready() error { return nil }
+
+func (s clusterIPService) ConditionType() string { return "ClusterIPReady" }
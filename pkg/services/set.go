@@ -16,22 +16,68 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
 
 	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 
 	airshipv1 "sipcluster/pkg/api/v1"
 	airshipvms "sipcluster/pkg/vbmh"
 )
 
+const (
+	// FieldManager is the server-side apply field manager owning the fields of infrastructure service objects set by
+	// SIP.
+	FieldManager = "sip"
+
+	// SIPClusterNameLabel and SIPClusterNamespaceLabel identify the SIPCluster owning an infrastructure service
+	// object, which is not in the namespace of the SIPCluster and therefore cannot have an owner reference to it.
+	SIPClusterNameLabel      = "sip.airshipit.org/sipcluster-name"
+	SIPClusterNamespaceLabel = "sip.airshipit.org/sipcluster-namespace"
+
+	// DesiredStateAnnotation records the checksum of the desired state last applied to an infrastructure service
+	// object.
+	DesiredStateAnnotation = "sip.airshipit.org/desired-state-checksum"
+
+	// ReasonDriftCorrected is the reason of the Events recorded when an infrastructure service object that was
+	// changed by others is restored to its desired state.
+	ReasonDriftCorrected = "DriftCorrected"
+
+	// ReasonRecreated is the reason of the Events recorded when an infrastructure service object is recreated to
+	// change an immutable field.
+	ReasonRecreated = "Recreated"
+)
+
 // InfraService generalizes inftracture services
 type InfraService interface {
 	Deploy() error
 	Finalize() error
+	// Ready returns nil when the deployed service is ready, or ErrServiceNotReady describing why it is not.
+	Ready() error
+	// ConditionType returns the SIPCluster status condition type reporting the readiness of the service.
+	ConditionType() string
+}
+
+// StatusReporter is implemented by infrastructure services that report their observed state in the SIPCluster status.
+type StatusReporter interface {
+	ReportStatus(status *airshipv1.SIPClusterStatus) error
 }
 
 // ServiceSet provides access to infrastructure services
@@ -40,6 +86,7 @@ type ServiceSet struct {
 	sip      airshipv1.SIPCluster
 	machines *airshipvms.MachineList
 	client   client.Client
+	recorder record.EventRecorder
 }
 
 // NewServiceSet returns new instance of ServiceSet
@@ -47,7 +94,8 @@ func NewServiceSet(
 	logger logr.Logger,
 	sip airshipv1.SIPCluster,
 	machines *airshipvms.MachineList,
-	client client.Client) ServiceSet {
+	client client.Client,
+	recorder record.EventRecorder) ServiceSet {
 	logger = logger.WithValues("SIPCluster", types.NamespacedName{Name: sip.GetNamespace(), Namespace: sip.GetName()})
 
 	return ServiceSet{
@@ -55,6 +103,7 @@ func NewServiceSet(
 		sip:      sip,
 		client:   client,
 		machines: machines,
+		recorder: recorder,
 	}
 }
 
@@ -68,7 +117,10 @@ func (ss ServiceSet) Finalize() error {
 			Name: ss.sip.Spec.ClusterName,
 		},
 	}
-	return ss.client.Delete(context.TODO(), serviceNamespace)
+	if err := ss.client.Delete(context.TODO(), serviceNamespace); err != nil && !apierror.IsNotFound(err) {
+		return err
+	}
+	return nil
 }
 
 func CreateNS(serviceNamespaceName string, c client.Client) error {
@@ -93,42 +145,393 @@ func CreateNS(serviceNamespaceName string, c client.Client) error {
 
 // ServiceList returns all services defined in Set
 func (ss ServiceSet) ServiceList() ([]InfraService, error) {
+	return ss.serviceList(false)
+}
+
+// FinalizableServiceList returns the services defined in Set that can be finalized. Unlike ServiceList, services
+// that cannot be created, such as custom services whose type is no longer registered or whose configuration is no
+// longer valid, are skipped rather than returned as an error, so that they do not prevent the deletion of the
+// SIPCluster. Their objects in the namespace of the sub-cluster are deleted along with it.
+func (ss ServiceSet) FinalizableServiceList() []InfraService {
+	serviceList, _ := ss.serviceList(true)
+	return serviceList
+}
+
+func (ss ServiceSet) serviceList(skipInvalid bool) ([]InfraService, error) {
 	serviceList := []InfraService{}
 	services := ss.sip.Spec.Services
 	for _, svc := range services.LoadBalancer {
 		serviceList = append(serviceList,
 			newLB(ss.sip.GetName(),
+				ss.sip.GetNamespace(),
 				ss.sip.Spec.ClusterName,
 				ss.logger,
 				svc,
 				ss.machines,
-				ss.client))
+				ss.client,
+				owner{sip: &ss.sip, recorder: ss.recorder}))
 	}
 	for _, svc := range services.Auth {
+		if skipInvalid {
+			continue
+		}
 		return nil, ErrInfraServiceNotSupported{svc}
 	}
 	for _, svc := range services.JumpHost {
 		serviceList = append(serviceList,
 			newJumpHost(ss.sip.GetName(),
+				ss.sip.GetNamespace(),
 				ss.sip.Spec.ClusterName,
 				ss.logger,
 				svc,
 				ss.machines,
-				ss.client))
+				ss.client,
+				owner{sip: &ss.sip, recorder: ss.recorder}))
+	}
+	instances := map[string]bool{}
+	for _, svc := range services.Custom {
+		ctx := ServiceContext{
+			SIPCluster: ss.sip,
+			Machines:   ss.machines,
+			Client:     ss.client,
+			Logger:     ss.logger.WithValues("type", svc.Type, "name", svc.Name),
+			name:       svc.Name,
+			owner:      owner{sip: &ss.sip, recorder: ss.recorder},
+		}
+		instance := ctx.InstanceName(svc.Type)
+		if instances[instance] {
+			if skipInvalid {
+				continue
+			}
+			return nil, ErrDuplicateCustomService{Type: svc.Type, Name: svc.Name}
+		}
+		instances[instance] = true
+
+		customService, err := newCustomService(ctx, svc)
+		if err != nil {
+			if skipInvalid {
+				ss.logger.Error(err, "skipping finalization of custom service", "type", svc.Type, "name", svc.Name)
+				continue
+			}
+			return nil, err
+		}
+		serviceList = append(serviceList, customService)
 	}
 	return serviceList, nil
 }
 
-func applyRuntimeObject(key client.ObjectKey, obj client.Object, c client.Client) error {
+// owner is the SIPCluster owning the objects of an infrastructure service. Objects are labeled with their owner so
+// that changes to them are reconciled, and changes that are not rendered from the owner are corrected as drift.
+type owner struct {
+	sip      *airshipv1.SIPCluster
+	recorder record.EventRecorder
+}
+
+// applyRuntimeObject applies the desired state of an object with server-side apply. Fields set by other field
+// managers, such as the cluster IP and node ports allocated to a Service, are preserved unless SIP sets them, in
+// which case SIP takes them over. When the desired state did not change since it was last applied, as recorded by
+// the DesiredStateAnnotation, the fields set by SIP can only differ from their desired values through changes made by
+// others, which are overwritten and recorded as a DriftCorrected Event.
+func applyRuntimeObject(obj client.Object, c client.Client, o owner) error {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return ErrUnsupportedObject{Object: obj}
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	obj.SetResourceVersion("")
+	obj.SetManagedFields(nil)
+
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[SIPClusterNameLabel] = o.sip.GetName()
+	labels[SIPClusterNamespaceLabel] = o.sip.GetNamespace()
+	obj.SetLabels(labels)
+	desired, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	checksum := fmt.Sprintf("%x", sha256.Sum256(desired))
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[DesiredStateAnnotation] = checksum
+	obj.SetAnnotations(annotations)
+
+	existing, err := newObject(obj, gvk, c)
+	if err != nil {
+		return err
+	}
 	ctx := context.Background()
-	switch err := c.Get(ctx, key, obj); {
+	key := client.ObjectKey{Name: obj.GetName(), Namespace: obj.GetNamespace()}
+	switch err = c.Get(ctx, key, existing); {
 	case apierror.IsNotFound(err):
-		return c.Create(ctx, obj)
-	case err == nil:
-		return c.Update(ctx, obj)
+		existing = nil
+	case err != nil:
+		return err
+	}
+
+	// The cluster IP of a Service is immutable, so a Service is recreated when its cluster IP changes, e.g. when the
+	// address of a Service whose cluster IP was assigned by Kubernetes is allocated from an IP pool.
+	if existing != nil && gvk.GroupKind() == (schema.GroupKind{Kind: "Service"}) &&
+		clusterIPChanged(existing, obj) {
+		if err = c.Delete(ctx, existing); err != nil && !apierror.IsNotFound(err) {
+			return err
+		}
+		if o.recorder != nil {
+			o.recorder.Eventf(o.sip, corev1.EventTypeNormal, ReasonRecreated,
+				"Recreated Service %s to change its cluster IP", key)
+		}
+		existing = nil
+	}
+
+	drifted := false
+	if existing != nil && existing.GetAnnotations()[DesiredStateAnnotation] == checksum {
+		if drifted, err = appliedFieldsDiffer(obj, existing); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+		return err
+	}
+
+	if drifted && o.recorder != nil {
+		o.recorder.Eventf(o.sip, corev1.EventTypeWarning, ReasonDriftCorrected,
+			"Restored %s %s to its desired state", gvk.Kind, key)
+	}
+
+	return nil
+}
+
+// clusterIPChanged reports whether the desired cluster IP of a Service differs from its current cluster IP. A Service
+// without a desired cluster IP keeps its current one.
+func clusterIPChanged(existing, desired client.Object) bool {
+	clusterIP := func(obj client.Object) string {
+		switch service := obj.(type) {
+		case *corev1.Service:
+			return service.Spec.ClusterIP
+		case *unstructured.Unstructured:
+			ip, _, _ := unstructured.NestedString(service.Object, "spec", "clusterIP") //nolint:errcheck
+			return ip
+		}
+		return ""
+	}
+
+	current, want := clusterIP(existing), clusterIP(desired)
+	return current != "" && want != "" && normalizeIP(current) != normalizeIP(want)
+}
+
+// newObject returns an empty object of the same kind as obj.
+func newObject(obj client.Object, gvk schema.GroupVersionKind, c client.Client) (client.Object, error) {
+	if _, isUnstructured := obj.(*unstructured.Unstructured); isUnstructured {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		return u, nil
+	}
+
+	empty, err := c.Scheme().New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	existing, ok := empty.(client.Object)
+	if !ok {
+		return nil, ErrUnsupportedObject{Object: obj}
+	}
+
+	return existing, nil
+}
+
+// appliedFieldsDiffer reports whether the live revision of an object differs from its desired state in the fields
+// set by SIP. Fields set by others, defaulted by the API server or in the status of the object are ignored.
+func appliedFieldsDiffer(desired, live client.Object) (bool, error) {
+	desiredFields, err := fieldsOf(desired)
+	if err != nil {
+		return false, err
+	}
+	liveFields, err := fieldsOf(live)
+	if err != nil {
+		return false, err
+	}
+
+	metadata, _ := desiredFields["metadata"].(map[string]interface{})
+	desiredFields["metadata"] = map[string]interface{}{
+		"labels":      metadata["labels"],
+		"annotations": metadata["annotations"],
+	}
+	delete(desiredFields, "apiVersion")
+	delete(desiredFields, "kind")
+	delete(desiredFields, "status")
+
+	return !containsFields(desiredFields, liveFields), nil
+}
+
+// fieldsOf returns the fields of an object as they are serialized.
+func fieldsOf(obj client.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return runtime.DeepCopyJSON(u.UnstructuredContent()), nil
+	}
+
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+// containsFields reports whether the live value of a field holds its desired value. Maps hold the desired value when
+// they hold each of its fields, and lists when they hold each of its elements at the same position. Empty and zero
+// desired values, such as a target port left to be defaulted, are held by any live value.
+func containsFields(desired, live interface{}) bool {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return len(d) == 0 && live == nil
+		}
+		for key, value := range d {
+			if !containsFields(value, l[key]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return len(d) == 0 && live == nil
+		}
+		if len(d) != len(l) {
+			return false
+		}
+		for i := range d {
+			if !containsFields(d[i], l[i]) {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return true
 	default:
+		return reflect.ValueOf(desired).IsZero() || equality.Semantic.DeepEqual(desired, live)
+	}
+}
+
+// deploymentReady verifies that the latest revision of a Deployment is rolled out and available.
+func deploymentReady(service string, key client.ObjectKey, c client.Client) error {
+	deployment := &appsv1.Deployment{}
+	if err := c.Get(context.Background(), key, deployment); err != nil {
+		return err
+	}
+
+	notReady := func(reason string) error {
+		return ErrServiceNotReady{Service: service, Reason: fmt.Sprintf("deployment %s %s", key, reason)}
+	}
+
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return notReady("has not been observed by the deployment controller")
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	if deployment.Status.UpdatedReplicas < replicas {
+		return notReady(fmt.Sprintf("has %d of %d updated replicas", deployment.Status.UpdatedReplicas, replicas))
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentAvailable && condition.Status == corev1.ConditionTrue {
+			return nil
+		}
+	}
+
+	return notReady("is not available")
+}
+
+// endpointsReady verifies that a Service has at least one ready endpoint.
+func endpointsReady(service string, key client.ObjectKey, c client.Client) error {
+	endpoints := &corev1.Endpoints{}
+	err := c.Get(context.Background(), key, endpoints)
+	if err != nil && !apierror.IsNotFound(err) {
 		return err
 	}
+
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return nil
+		}
+	}
+
+	return ErrServiceNotReady{Service: service, Reason: fmt.Sprintf("service %s has no ready endpoints", key)}
+}
+
+// serviceEndpoints returns the endpoints of the ports of a deployed Service, reachable through the node port on each
+// base cluster node and through the cluster IP. Addresses listed in preferred are placed first.
+func serviceEndpoints(key client.ObjectKey, c client.Client, preferred map[string][]string) (
+	[]airshipv1.ServiceEndpoint, error) {
+	ctx := context.Background()
+	service := &corev1.Service{}
+	if err := c.Get(ctx, key, service); err != nil {
+		return nil, err
+	}
+
+	nodeIPs, err := nodeInternalIPs(c)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]airshipv1.ServiceEndpoint, 0, len(service.Spec.Ports))
+	for _, port := range service.Spec.Ports {
+		addresses := append([]string{}, preferred[port.Name]...)
+		if port.NodePort != 0 {
+			for _, ip := range nodeIPs {
+				addresses = append(addresses, net.JoinHostPort(ip, strconv.Itoa(int(port.NodePort))))
+			}
+		}
+		if service.Spec.ClusterIP != "" && service.Spec.ClusterIP != corev1.ClusterIPNone {
+			addresses = append(addresses, net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(port.Port))))
+		}
+
+		endpoints = append(endpoints, airshipv1.ServiceEndpoint{
+			Service:   key.Name,
+			Name:      port.Name,
+			Addresses: addresses,
+		})
+	}
+
+	return endpoints, nil
+}
+
+// nodeInternalIPs returns the sorted internal IP addresses of the base cluster nodes, on which node ports are exposed.
+func nodeInternalIPs(c client.Client) ([]string, error) {
+	nodes := &corev1.NodeList{}
+	if err := c.List(context.Background(), nodes); err != nil {
+		return nil, err
+	}
+
+	nodeIPs := []string{}
+	for _, node := range nodes.Items {
+		for _, address := range node.Status.Addresses {
+			if address.Type == corev1.NodeInternalIP {
+				nodeIPs = append(nodeIPs, address.Address)
+			}
+		}
+	}
+	sort.Strings(nodeIPs)
+
+	return nodeIPs, nil
+}
+
+// setEndpoints replaces the endpoints of an infrastructure service instance in the SIPCluster status.
+func setEndpoints(status *airshipv1.SIPClusterStatus, service string, endpoints []airshipv1.ServiceEndpoint) {
+	merged := make([]airshipv1.ServiceEndpoint, 0, len(status.Endpoints)+len(endpoints))
+	for _, endpoint := range status.Endpoints {
+		if endpoint.Service != service {
+			merged = append(merged, endpoint)
+		}
+	}
+
+	status.Endpoints = append(merged, endpoints...)
 }
 
 func int32Ptr(i int32) *int32 { return &i }
+
+func boolPtr(b bool) *bool { return &b }
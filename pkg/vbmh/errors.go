@@ -2,6 +2,7 @@ package vbmh
 
 import (
 	"fmt"
+	"strings"
 
 	metal3 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 
@@ -26,13 +27,28 @@ func (e ErrorUnableToFullySchedule) Error() string {
 		e.TargetNode, e.TargetFlavor)
 }
 
+// ErrorNoBMHAvailable is returned when no vBMH is available for scheduling.
+type ErrorNoBMHAvailable struct {
+	Selector map[string]string
+}
+
+func (e ErrorNoBMHAvailable) Error() string {
+	return fmt.Sprintf("Unable to identify vBMH available for scheduling. Selecting  %v ", e.Selector)
+}
+
 type ErrorHostIPNotFound struct {
 	HostName    string
 	IPInterface string
-	Message     string
+	// IPFamily is the address family required by the Infrastructure Service, if any.
+	IPFamily airshipv1.IPFamily
+	Message  string
 }
 
 func (e ErrorHostIPNotFound) Error() string {
+	if e.IPFamily != "" {
+		return fmt.Sprintf("Unable to identify the vBMH Host %v %s IP address on interface %v required by "+
+			"Infrastructure Service %s", e.HostName, e.IPFamily, e.IPInterface, e.Message)
+	}
 	return fmt.Sprintf("Unable to identify the vBMH Host %v IP address on interface %v required by "+
 		"Infrastructure Service %s", e.HostName, e.IPInterface, e.Message)
 }
@@ -55,6 +71,47 @@ func (e ErrorNetworkDataNotFound) Error() string {
 	return fmt.Sprintf("vBMH Host %v does not define NetworkData, but is required for scheduling.", e.BMH)
 }
 
+// ErrMalformedNetworkData is returned when the Network Data of a BMH is not valid network_data.json.
+type ErrMalformedNetworkData struct {
+	BMH string
+	// Field is the path of the offending field, e.g. networks[2].link, if any.
+	Field  string
+	Reason string
+}
+
+func (e ErrMalformedNetworkData) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("vBMH Host %s has malformed Network Data: %s", e.BMH, e.Reason)
+	}
+	return fmt.Sprintf("vBMH Host %s has malformed Network Data: %s %s", e.BMH, e.Field, e.Reason)
+}
+
+// ErrNetworkDataKeyNotFound is returned when the Network Data secret of a BMH has none of the Network Data keys.
+type ErrNetworkDataKeyNotFound struct {
+	BMH        string
+	SecretName string
+	Keys       []string
+}
+
+func (e ErrNetworkDataKeyNotFound) Error() string {
+	return fmt.Sprintf("vBMH Host %s Network Data secret %s has none of the keys %s", e.BMH, e.SecretName,
+		strings.Join(e.Keys, ", "))
+}
+
+// ErrNetworkNotResolved occurs when the network of an infrastructure service is not found in nmstate or netplan
+// Network Data, whose network IDs are derived from the link and network type, e.g. bond0.41-ipv4.
+type ErrNetworkNotResolved struct {
+	BMH           string
+	NodeInterface string
+	Format        NetworkDataFormat
+}
+
+func (e ErrNetworkNotResolved) Error() string {
+	return fmt.Sprintf("vBMH Host %s %s Network Data has no network %s. Network IDs of %s Network Data are derived "+
+		"from the link and network type, e.g. bond0.41-ipv4: select the network with nodeInterfaceSelector or the %s "+
+		"label", e.BMH, e.Format, e.NodeInterface, e.Format, NetworkIDLabelPrefix+e.NodeInterface)
+}
+
 // ErrMalformedManagementCredentials occurs when a BMC credentials secret does not contain username and password fields.
 type ErrMalformedManagementCredentials struct {
 	SecretName string
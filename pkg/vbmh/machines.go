@@ -18,14 +18,15 @@ package vbmh
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-
+	"net"
+	"sort"
+	"strconv"
 	"strings"
 
 	airshipv1 "sipcluster/pkg/api/v1"
 
-	"github.com/PaesslerAG/jsonpath"
 	"github.com/go-logr/logr"
 	metal3 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
@@ -116,6 +117,8 @@ func NewMachine(bmh metal3.BareMetalHost, nodeRole airshipv1.VMRole, schedState
 		VMRole:         nodeRole,
 		Data: &MachineData{
 			IPOnInterface: make(map[string]string),
+			Addresses:     make(map[string][]Address),
+			NetworkIDs:    make(map[string]string),
 		},
 	}, nil
 }
@@ -123,9 +126,101 @@ func NewMachine(bmh metal3.BareMetalHost, nodeRole airshipv1.VMRole, schedState
 type MachineData struct {
 	// Collect all IP's for the interfaces defined
 	// In the list of Services
+	// IPOnInterface holds the first address of the host on each node interface network of the services.
 	IPOnInterface map[string]string
-	BMCUsername   string
-	BMCPassword   string
+	// Addresses maps the ID of each network in the Network Data of the host to the addresses of the host on it.
+	Addresses map[string][]Address
+	// NetworkIDs maps the node interfaces of the services to the ID of the network resolved for them on the host,
+	// when it differs from the node interface.
+	NetworkIDs  map[string]string
+	BMCUsername string
+	BMCPassword string
+}
+
+// Address is an address of a host on a network of its Network Data.
+type Address struct {
+	IP     string
+	Family corev1.IPFamily
+	// Netmask is the netmask of the network, as found in the Network Data, if any.
+	Netmask string
+	// Link is the ID of the link the network is configured on.
+	Link string
+}
+
+// IPs returns the addresses of the host used by a service on a node interface network. The addresses of the network
+// itself come first, followed by the addresses of the selected family of the other networks of its link. When the
+// addresses of the network are unknown, the address in IPOnInterface is used.
+func (md *MachineData) IPs(nodeInterface string, family airshipv1.IPFamily) []string {
+	networkID := nodeInterface
+	if id, exists := md.NetworkIDs[nodeInterface]; exists {
+		networkID = id
+	}
+
+	families := map[corev1.IPFamily]bool{
+		corev1.IPv4Protocol: family != airshipv1.IPFamilyIPv6,
+		corev1.IPv6Protocol: family != airshipv1.IPFamilyIPv4,
+	}
+
+	own := md.Addresses[networkID]
+	if len(own) == 0 {
+		if address, ok := newAddress(md.IPOnInterface[nodeInterface], "", ""); ok {
+			own = []Address{address}
+		}
+	}
+
+	ips := []string{}
+	for _, address := range own {
+		if families[address.Family] {
+			ips = append(ips, address.IP)
+		}
+	}
+
+	// Without a family selected, only the addresses of the network itself are used.
+	if family == "" || len(own) == 0 || own[0].Link == "" {
+		return ips
+	}
+
+	ids := make([]string, 0, len(md.Addresses))
+	for id := range md.Addresses {
+		if id != networkID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		for _, address := range md.Addresses[id] {
+			if families[address.Family] && address.Link == own[0].Link {
+				ips = append(ips, address.IP)
+			}
+		}
+	}
+
+	return ips
+}
+
+// hasFamilies reports whether the addresses include those of the selected family, of both families for DualStack,
+// or any address when no family is selected.
+func hasFamilies(ips []string, family airshipv1.IPFamily) bool {
+	hasIPv4, hasIPv6 := false, false
+	for _, ip := range ips {
+		if net.ParseIP(ip).To4() != nil {
+			hasIPv4 = true
+		} else {
+			hasIPv6 = true
+		}
+	}
+
+	switch family {
+	case airshipv1.IPFamilyIPv4:
+		return hasIPv4
+	case airshipv1.IPFamilyIPv6:
+		return hasIPv6
+	case airshipv1.IPFamilyDualStack:
+		return hasIPv4 && hasIPv6
+	default:
+		return len(ips) > 0
+	}
 }
 
 // MachineList contains the list of Scheduled or ToBeScheduled machines
@@ -136,6 +231,9 @@ type MachineList struct {
 	// Keep track  of how many we have mark for scheduled.
 	ReadyForScheduleCount map[airshipv1.VMRole]int
 	Log                   logr.Logger
+	// NetworkDataKeys are the keys of the BMH Network Data secrets that may hold the Network Data, in order of
+	// preference. Defaults to DefaultNetworkDataKeys.
+	NetworkDataKeys []string
 }
 
 func (ml *MachineList) hasMachine(bmh metal3.BareMetalHost) bool {
@@ -161,8 +259,10 @@ func (ml *MachineList) Schedule(sip airshipv1.SIPCluster, c client.Client) error
 	ml.init(sip.Spec.Nodes)
 
 	// IDentify vBMH's that meet the appropriate selction criteria
+	// When no vBMH is available, the vBMHs already scheduled for the SIP cluster may still satisfy it, which
+	// identifyNodes verifies.
 	bmhList, err := ml.getBMHs(c)
-	if err != nil {
+	if err != nil && !errors.As(err, &ErrorNoBMHAvailable{}) {
 		return err
 	}
 
@@ -216,7 +316,7 @@ func (ml *MachineList) getBMHs(c client.Client) (*metal3.BareMetalHostList, erro
 	if len(bmhList.Items) > 0 {
 		return bmhList, nil
 	}
-	return bmhList, fmt.Errorf("Unable to identify vBMH available for scheduling. Selecting  %v ", scheduleLabels)
+	return bmhList, ErrorNoBMHAvailable{Selector: scheduleLabels}
 }
 
 func (ml *MachineList) identifyNodes(sip airshipv1.SIPCluster,
@@ -405,7 +505,7 @@ func (ml *MachineList) ExtrapolateServiceAddresses(sip airshipv1.SIPCluster, c c
 	var extrapolateErrs error
 	for _, machine := range ml.Machines {
 		// Skip machines whose service addresses have been extracted
-		if len(machine.Data.IPOnInterface) > 0 {
+		if len(machine.Data.IPOnInterface) > 0 || len(machine.Data.Addresses) > 0 {
 			continue
 		}
 
@@ -634,46 +734,97 @@ func (ml *MachineList) ExtrapolateBMCAuth(sip airshipv1.SIPCluster, c client.Cli
 
 func (ml *MachineList) getIP(machine *Machine, networkDataSecret *corev1.Secret,
 	services airshipv1.SIPClusterServices) error {
-	var secretData interface{}
-	// Now I have the Secret
-	// Lets find the IP's for all Interfaces defined in Cfg
-	foundIP := false
-	for _, svcCfg := range services.GetAll() {
-		// Did I already find the IP for these interface
-		if machine.Data.IPOnInterface[svcCfg.NodeInterface] == "" {
-			err := json.Unmarshal(networkDataSecret.Data["networkData"], &secretData)
-			if err != nil {
-				return err
-			}
-			fmt.Printf("Schedule.Extrapolate.getIP secretData:%v\n", secretData)
+	keys := ml.NetworkDataKeys
+	if len(keys) == 0 {
+		keys = DefaultNetworkDataKeys
+	}
+	var data []byte
+	for _, key := range keys {
+		if value, exists := networkDataSecret.Data[key]; exists {
+			data = value
+			break
+		}
+	}
+	if data == nil {
+		return ErrNetworkDataKeyNotFound{BMH: machine.BMH.Name, SecretName: networkDataSecret.Name, Keys: keys}
+	}
 
-			queryFilter := fmt.Sprintf("$..networks[? (@.id==\"%s\")].ip_address", svcCfg.NodeInterface)
-			fmt.Printf("Schedule.Extrapolate.getIP queryFilter:%v\n", queryFilter)
-			ipAddress, err := jsonpath.Get(queryFilter, secretData)
+	networkData, err := ParseNetworkData(data)
+	if malformed, ok := err.(ErrMalformedNetworkData); ok {
+		malformed.BMH = machine.BMH.Name
+		return malformed
+	} else if err != nil {
+		return err
+	}
 
-			if err == nil {
-				foundIP = true
-				for _, value := range ipAddress.([]interface{}) {
-					machine.Data.IPOnInterface[svcCfg.NodeInterface] = value.(string) //nolint:errcheck
-				}
+	// Collect the addresses of the host on every network, so that services can select them by family.
+	for _, network := range networkData.Networks {
+		address, ok := newAddress(network.IPAddress, network.Netmask, network.Link)
+		if !ok {
+			continue
+		}
+		machine.Data.Addresses[network.ID] = append(machine.Data.Addresses[network.ID], address)
+	}
+
+	for _, svcCfg := range services.GetAll() {
+		networkID, found := networkData.ResolveNetwork(machine.BMH, svcCfg)
+		if found {
+			machine.Data.NetworkIDs[svcCfg.NodeInterface] = networkID
+		}
+
+		// The network IDs of nmstate and netplan Network Data are derived by SIP, so a host whose network is not
+		// found is excluded rather than scheduled without an address.
+		if !found && networkData.Format != NetworkDataFormatOpenStack {
+			return ErrNetworkNotResolved{
+				BMH:           machine.BMH.Name,
+				NodeInterface: svcCfg.NodeInterface,
+				Format:        networkData.Format,
 			}
-			// Skip if error
-			// Should signal that I need to exclude this machine
-			// Which also means I am now short potentially.
-			fmt.Printf("Schedule.Extrapolate.getIP machine.Data.IpOnInterface[%s]:%v\n",
-				svcCfg.NodeInterface, machine.Data.IPOnInterface[svcCfg.NodeInterface])
 		}
 
-		if !foundIP {
+		// Hosts are only excluded for lack of addresses when the service selects its network or requires addresses
+		// of a family.
+		ips := machine.Data.IPs(svcCfg.NodeInterface, svcCfg.IPFamily)
+		strict := svcCfg.IPFamily != "" || svcCfg.NodeInterfaceSelector != nil ||
+			networkID != svcCfg.NodeInterface
+		if strict && (!found || !hasFamilies(ips, svcCfg.IPFamily)) {
 			return &ErrorHostIPNotFound{
 				HostName:    machine.BMH.ObjectMeta.Name,
 				IPInterface: svcCfg.NodeInterface,
+				IPFamily:    svcCfg.IPFamily,
 			}
 		}
+
+		if networkIPs := machine.Data.IPs(svcCfg.NodeInterface, ""); len(networkIPs) > 0 {
+			machine.Data.IPOnInterface[svcCfg.NodeInterface] = networkIPs[0]
+		}
+		ml.Log.Info("extracted service address", "BMH", machine.BMH.Name,
+			"interface", svcCfg.NodeInterface, "IP", machine.Data.IPOnInterface[svcCfg.NodeInterface])
 	}
 	return nil
 }
 
+// newAddress parses the address of a network of the Network Data. The address may be in CIDR notation, in which
+// case the netmask is its prefix length.
+func newAddress(ipAddress, netmask, link string) (Address, bool) {
+	if ip, ipNet, err := net.ParseCIDR(ipAddress); err == nil {
+		ones, _ := ipNet.Mask.Size()
+		ipAddress, netmask = ip.String(), strconv.Itoa(ones)
+	}
+
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return Address{}, false
+	}
+
+	family := corev1.IPv6Protocol
+	if ip.To4() != nil {
+		family = corev1.IPv4Protocol
+	}
+
+	return Address{IP: ipAddress, Family: family, Netmask: netmask, Link: link}, true
+}
+
 // getManagementCredentials retrieves BMC credentials from a Kubernetes secret.
 func (ml *MachineList) getMangementCredentials(machine *Machine, secret *corev1.Secret) error {
 	username, exists := secret.Data[keyBMCUsername]
@@ -691,6 +842,30 @@ func (ml *MachineList) getMangementCredentials(machine *Machine, secret *corev1.
 	return nil
 }
 
+// GetBMCCredentials retrieves the BMC username and password of a BMH from its BMC credentials Secret.
+func GetBMCCredentials(bmh metal3.BareMetalHost, c client.Client) (string, string, error) {
+	secret := &corev1.Secret{}
+	err := c.Get(context.Background(), client.ObjectKey{
+		Namespace: bmh.Namespace,
+		Name:      bmh.Spec.BMC.CredentialsName,
+	}, secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	username, exists := secret.Data[keyBMCUsername]
+	if !exists {
+		return "", "", ErrMalformedManagementCredentials{SecretName: secret.Name}
+	}
+
+	password, exists := secret.Data[keyBMCPassword]
+	if !exists {
+		return "", "", ErrMalformedManagementCredentials{SecretName: secret.Name}
+	}
+
+	return string(username), string(password), nil
+}
+
 /*
   ScheduleSet is a simple object to encapsulate data that
   helps our poor man scheduler
@@ -804,6 +979,8 @@ func (ml *MachineList) GetCluster(sip airshipv1.SIPCluster, c client.Client) err
 			VMRole:         airshipv1.VMRole(bmh.Labels[SipNodeTypeLabel]),
 			Data: &MachineData{
 				IPOnInterface: make(map[string]string),
+				Addresses:     make(map[string][]Address),
+				NetworkIDs:    make(map[string]string),
 			},
 		}
 	}
@@ -0,0 +1,207 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vbmh
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// netplanConfig is a netplan version 2 configuration, whose devices may be nested under a network field.
+type netplanConfig struct {
+	Network *netplanNetwork `json:"network,omitempty"`
+	netplanNetwork
+}
+
+type netplanNetwork struct {
+	Version   int                      `json:"version,omitempty"`
+	Ethernets map[string]netplanDevice `json:"ethernets,omitempty"`
+	Bonds     map[string]netplanDevice `json:"bonds,omitempty"`
+	Bridges   map[string]netplanDevice `json:"bridges,omitempty"`
+	VLANs     map[string]netplanDevice `json:"vlans,omitempty"`
+}
+
+type netplanDevice struct {
+	Match struct {
+		MACAddress string `json:"macaddress,omitempty"`
+	} `json:"match,omitempty"`
+	MACAddress  string         `json:"macaddress,omitempty"`
+	MTU         int            `json:"mtu,omitempty"`
+	DHCP4       bool           `json:"dhcp4,omitempty"`
+	DHCP6       bool           `json:"dhcp6,omitempty"`
+	Addresses   []string       `json:"addresses,omitempty"`
+	Gateway4    string         `json:"gateway4,omitempty"`
+	Gateway6    string         `json:"gateway6,omitempty"`
+	Routes      []netplanRoute `json:"routes,omitempty"`
+	Nameservers struct {
+		Addresses []string `json:"addresses,omitempty"`
+	} `json:"nameservers,omitempty"`
+	// Interfaces are the ports of bonds and bridges.
+	Interfaces []string `json:"interfaces,omitempty"`
+	// ID and Link are the VLAN ID and underlying device of VLANs.
+	ID   int    `json:"id,omitempty"`
+	Link string `json:"link,omitempty"`
+}
+
+type netplanRoute struct {
+	To  string `json:"to"`
+	Via string `json:"via"`
+}
+
+// parseNetplan converts a netplan configuration to Network Data.
+func parseNetplan(data []byte) (*NetworkData, error) {
+	config := &netplanConfig{}
+	if err := unmarshalNetworkData(data, config); err != nil {
+		return nil, err
+	}
+	network := config.netplanNetwork
+	if config.Network != nil {
+		network = *config.Network
+	}
+
+	devices := map[string]bool{}
+	for _, section := range []map[string]netplanDevice{
+		network.Ethernets, network.Bonds, network.Bridges, network.VLANs,
+	} {
+		for name := range section {
+			devices[name] = true
+		}
+	}
+
+	networkData := &NetworkData{}
+	for _, section := range []struct {
+		name     string
+		linkType string
+		devices  map[string]netplanDevice
+	}{
+		{"ethernets", "phy", network.Ethernets},
+		{"bonds", "bond", network.Bonds},
+		{"bridges", "bridge", network.Bridges},
+		{"vlans", "vlan", network.VLANs},
+	} {
+		names := make([]string, 0, len(section.devices))
+		for name := range section.devices {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			field := section.name + "." + name
+			if err := networkData.addNetplanDevice(field, name, section.linkType, section.devices[name],
+				devices); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return networkData, nil
+}
+
+// addNetplanDevice adds the link, networks and routes of a netplan device.
+func (nd *NetworkData) addNetplanDevice(field, name, linkType string, device netplanDevice,
+	devices map[string]bool) error {
+	link := NetworkLink{
+		ID:                 name,
+		Name:               name,
+		Type:               linkType,
+		MTU:                device.MTU,
+		EthernetMACAddress: device.MACAddress,
+		VLANID:             device.ID,
+		VLANLink:           device.Link,
+	}
+	if link.EthernetMACAddress == "" {
+		link.EthernetMACAddress = device.Match.MACAddress
+	}
+	if device.Link != "" && !devices[device.Link] {
+		return unknownDevice(field+".link", device.Link)
+	}
+	for i, iface := range device.Interfaces {
+		if !devices[iface] {
+			return unknownDevice(fmt.Sprintf("%s.interfaces[%d]", field, i), iface)
+		}
+	}
+	if linkType == "bond" {
+		link.BondLinks = device.Interfaces
+	}
+	nd.Links = append(nd.Links, link)
+
+	for i, nameserver := range device.Nameservers.Addresses {
+		if net.ParseIP(nameserver) == nil {
+			return malformedIP(fmt.Sprintf("%s.nameservers.addresses[%d]", field, i), nameserver)
+		}
+	}
+
+	first := len(nd.Networks)
+	if device.DHCP4 {
+		nd.addNetwork(name, "ipv4_dhcp", Address{})
+	}
+	if device.DHCP6 {
+		nd.addNetwork(name, "ipv6_dhcp", Address{})
+	}
+	for i, cidr := range device.Addresses {
+		address, ok := Address{}, strings.Contains(cidr, "/")
+		if ok {
+			address, ok = newAddress(cidr, "", name)
+		}
+		if !ok {
+			return ErrMalformedNetworkData{
+				Field:  fmt.Sprintf("%s.addresses[%d]", field, i),
+				Reason: fmt.Sprintf("%q is not a valid address in CIDR notation", cidr),
+			}
+		}
+
+		networkType := "ipv6"
+		if address.Family == corev1.IPv4Protocol {
+			networkType = "ipv4"
+		}
+		nd.addNetwork(name, networkType, address)
+	}
+	for i := first; i < len(nd.Networks); i++ {
+		nd.Networks[i].DNSNameservers = device.Nameservers.Addresses
+	}
+
+	// Gateways are default routes, whose destination is not part of the configuration.
+	type route struct {
+		toField, to, viaField, via string
+	}
+	routes := make([]route, 0, len(device.Routes)+2)
+	for i, r := range device.Routes {
+		routeField := fmt.Sprintf("%s.routes[%d]", field, i)
+		routes = append(routes, route{routeField + ".to", r.To, routeField + ".via", r.Via})
+	}
+	if device.Gateway4 != "" {
+		routes = append(routes, route{field + ".gateway4", "0.0.0.0/0", field + ".gateway4", device.Gateway4})
+	}
+	if device.Gateway6 != "" {
+		routes = append(routes, route{field + ".gateway6", "::/0", field + ".gateway6", device.Gateway6})
+	}
+	for _, r := range routes {
+		destination, gateway, err := parseRoute(r.toField, r.to, r.viaField, r.via)
+		if err != nil {
+			return err
+		}
+		nd.addRoute(name, destination, gateway)
+	}
+
+	return nil
+}
+
+func unknownDevice(field, name string) error {
+	return ErrMalformedNetworkData{Field: field, Reason: fmt.Sprintf("references unknown device %q", name)}
+}
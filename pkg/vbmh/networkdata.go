@@ -0,0 +1,430 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vbmh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	metal3 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	airshipv1 "sipcluster/pkg/api/v1"
+)
+
+// NetworkIDLabelPrefix prefixes the BMH labels that map the node interface of an infrastructure service, named by
+// the rest of the label key, to the ID of the corresponding network in the Network Data of the host.
+const NetworkIDLabelPrefix = "network." + BaseAirshipSelector + "/"
+
+// DefaultNetworkDataKeys are the keys of the BMH Network Data secrets that may hold the Network Data, in order of
+// preference.
+var DefaultNetworkDataKeys = []string{"networkData", "network_data.json"}
+
+// NetworkDataFormat is a format of the Network Data of a host.
+type NetworkDataFormat string
+
+const (
+	// NetworkDataFormatOpenStack is the OpenStack network_data.json format.
+	NetworkDataFormatOpenStack NetworkDataFormat = "network_data.json"
+	// NetworkDataFormatNMState is the nmstate desired state format. See https://nmstate.io
+	NetworkDataFormatNMState NetworkDataFormat = "nmstate"
+	// NetworkDataFormatNetplan is the netplan version 2 format. See https://netplan.io/reference
+	NetworkDataFormatNetplan NetworkDataFormat = "netplan"
+)
+
+// NetworkData is the network configuration of a host in the OpenStack network_data.json format. See
+// https://docs.openstack.org/nova/latest/user/metadata.html#openstack-format-metadata
+type NetworkData struct {
+	Links    []NetworkLink    `json:"links,omitempty"`
+	Networks []Network        `json:"networks,omitempty"`
+	Services []NetworkService `json:"services,omitempty"`
+
+	// Format is the format the Network Data was parsed from.
+	Format NetworkDataFormat `json:"-"`
+}
+
+// NetworkLink is a physical or virtual interface of a host.
+type NetworkLink struct {
+	ID                 string   `json:"id"`
+	Name               string   `json:"name,omitempty"`
+	Type               string   `json:"type,omitempty"`
+	MTU                int      `json:"mtu,omitempty"`
+	EthernetMACAddress string   `json:"ethernet_mac_address,omitempty"`
+	VLANID             int      `json:"vlan_id,omitempty"`
+	VLANLink           string   `json:"vlan_link,omitempty"`
+	BondLinks          []string `json:"bond_links,omitempty"`
+}
+
+// Network is an IPv4 or IPv6 network configured on a link of a host.
+type Network struct {
+	ID             string         `json:"id"`
+	Type           string         `json:"type,omitempty"`
+	Link           string         `json:"link"`
+	IPAddress      string         `json:"ip_address,omitempty"`
+	Netmask        string         `json:"netmask,omitempty"`
+	DNSNameservers []string       `json:"dns_nameservers,omitempty"`
+	Routes         []NetworkRoute `json:"routes,omitempty"`
+}
+
+// NetworkRoute is a static route of a network.
+type NetworkRoute struct {
+	Network string `json:"network"`
+	Netmask string `json:"netmask"`
+	Gateway string `json:"gateway"`
+}
+
+// NetworkService is a network service, such as a DNS server, available to a host.
+type NetworkService struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// ParseNetworkData parses and validates Network Data in the network_data.json, nmstate or netplan format, which is
+// detected by DetectNetworkDataFormat. nmstate and netplan configurations are converted to their network_data.json
+// equivalent: each interface becomes a link and each of its addresses a network identified by the interface name
+// and the network type, e.g. bond0.41-ipv4. Validation errors are of type ErrMalformedNetworkData and name the
+// offending field in the format of the Network Data.
+func ParseNetworkData(data []byte) (*NetworkData, error) {
+	format, err := DetectNetworkDataFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var networkData *NetworkData
+	switch format {
+	case NetworkDataFormatNMState:
+		networkData, err = parseNMState(data)
+	case NetworkDataFormatNetplan:
+		networkData, err = parseNetplan(data)
+	default:
+		networkData = &NetworkData{}
+		err = unmarshalNetworkData(data, networkData)
+	}
+	if err != nil {
+		return nil, err
+	}
+	networkData.Format = format
+
+	if err = networkData.Validate(); err != nil {
+		return nil, err
+	}
+
+	return networkData, nil
+}
+
+// DetectNetworkDataFormat detects the format of Network Data from its top-level fields: nmstate configurations
+// define interfaces, netplan configurations a version or ethernets, bonds, vlans or bridges, optionally under a
+// network field, and network_data.json links, networks or services.
+func DetectNetworkDataFormat(data []byte) (NetworkDataFormat, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return "", ErrMalformedNetworkData{Reason: "is empty"}
+	}
+
+	fields := map[string]interface{}{}
+	if err := unmarshalNetworkData(data, &fields); err != nil {
+		return "", err
+	}
+	if network, ok := fields["network"].(map[string]interface{}); ok {
+		fields = network
+	}
+
+	has := func(keys ...string) bool {
+		for _, key := range keys {
+			if _, exists := fields[key]; exists {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case has("interfaces"):
+		return NetworkDataFormatNMState, nil
+	case has("version", "ethernets", "bonds", "vlans", "bridges"):
+		return NetworkDataFormatNetplan, nil
+	case has("links", "networks", "services") || len(fields) == 0:
+		return NetworkDataFormatOpenStack, nil
+	}
+
+	return "", ErrMalformedNetworkData{Reason: "is neither in the network_data.json, nmstate nor netplan format"}
+}
+
+// unmarshalNetworkData unmarshals JSON or YAML Network Data.
+func unmarshalNetworkData(data []byte, v interface{}) error {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return ErrMalformedNetworkData{Reason: err.Error()}
+	}
+
+	if err = json.Unmarshal(data, v); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			return ErrMalformedNetworkData{
+				Field:  typeErr.Field,
+				Reason: fmt.Sprintf("must be of type %s, not %s", typeErr.Type, typeErr.Value),
+			}
+		}
+		return ErrMalformedNetworkData{Reason: err.Error()}
+	}
+
+	return nil
+}
+
+// Validate checks that the IDs of the links and networks are unique, that every link reference resolves and that
+// every address, netmask and gateway is a valid IP address. It returns the first error found.
+func (nd *NetworkData) Validate() error {
+	links := map[string]bool{}
+	for i, link := range nd.Links {
+		field := fmt.Sprintf("links[%d]", i)
+		switch {
+		case link.ID == "":
+			return ErrMalformedNetworkData{Field: field + ".id", Reason: "must not be empty"}
+		case links[link.ID]:
+			return ErrMalformedNetworkData{Field: field + ".id", Reason: fmt.Sprintf("duplicates link %q", link.ID)}
+		}
+		links[link.ID] = true
+	}
+
+	for i, link := range nd.Links {
+		field := fmt.Sprintf("links[%d]", i)
+		if link.VLANLink != "" && !links[link.VLANLink] {
+			return danglingLink(field+".vlan_link", link.VLANLink)
+		}
+		for j, bondLink := range link.BondLinks {
+			if !links[bondLink] {
+				return danglingLink(fmt.Sprintf("%s.bond_links[%d]", field, j), bondLink)
+			}
+		}
+	}
+
+	networks := map[string]bool{}
+	for i, network := range nd.Networks {
+		field := fmt.Sprintf("networks[%d]", i)
+		switch {
+		case network.ID == "":
+			return ErrMalformedNetworkData{Field: field + ".id", Reason: "must not be empty"}
+		case networks[network.ID]:
+			return ErrMalformedNetworkData{
+				Field:  field + ".id",
+				Reason: fmt.Sprintf("duplicates network %q", network.ID),
+			}
+		case !links[network.Link]:
+			return danglingLink(field+".link", network.Link)
+		}
+		networks[network.ID] = true
+
+		if err := validateNetwork(field, network); err != nil {
+			return err
+		}
+	}
+
+	for i, service := range nd.Services {
+		if net.ParseIP(service.Address) == nil {
+			return malformedIP(fmt.Sprintf("services[%d].address", i), service.Address)
+		}
+	}
+
+	return nil
+}
+
+func validateNetwork(field string, network Network) error {
+	if network.IPAddress != "" {
+		address, ok := newAddress(network.IPAddress, network.Netmask, network.Link)
+		if !ok {
+			return malformedIP(field+".ip_address", network.IPAddress)
+		}
+		if (network.Type == "ipv4" && address.Family != corev1.IPv4Protocol) ||
+			(network.Type == "ipv6" && address.Family != corev1.IPv6Protocol) {
+			return ErrMalformedNetworkData{
+				Field:  field + ".ip_address",
+				Reason: fmt.Sprintf("%q is not an address of network type %s", network.IPAddress, network.Type),
+			}
+		}
+	}
+	if network.Netmask != "" && !isNetmask(network.Netmask) {
+		return malformedIP(field+".netmask", network.Netmask)
+	}
+
+	for i, nameserver := range network.DNSNameservers {
+		if net.ParseIP(nameserver) == nil {
+			return malformedIP(fmt.Sprintf("%s.dns_nameservers[%d]", field, i), nameserver)
+		}
+	}
+
+	for i, route := range network.Routes {
+		routeField := fmt.Sprintf("%s.routes[%d]", field, i)
+		switch {
+		case !isIPOrCIDR(route.Network):
+			return malformedIP(routeField+".network", route.Network)
+		case !isNetmask(route.Netmask):
+			return malformedIP(routeField+".netmask", route.Netmask)
+		case net.ParseIP(route.Gateway) == nil:
+			return malformedIP(routeField+".gateway", route.Gateway)
+		}
+	}
+
+	return nil
+}
+
+func danglingLink(field, id string) error {
+	return ErrMalformedNetworkData{Field: field, Reason: fmt.Sprintf("references unknown link %q", id)}
+}
+
+func malformedIP(field, value string) error {
+	return ErrMalformedNetworkData{Field: field, Reason: fmt.Sprintf("%q is not a valid IP address", value)}
+}
+
+func isIPOrCIDR(value string) bool {
+	_, _, err := net.ParseCIDR(value)
+	return err == nil || net.ParseIP(value) != nil
+}
+
+// isNetmask reports whether the value is a netmask in dotted or CIDR notation, or a prefix length.
+func isNetmask(value string) bool {
+	if prefix, err := strconv.Atoi(value); err == nil {
+		return prefix >= 0 && prefix <= 128
+	}
+
+	return isIPOrCIDR(value)
+}
+
+// Link returns the link with the given ID.
+func (nd *NetworkData) Link(id string) (NetworkLink, bool) {
+	for _, link := range nd.Links {
+		if link.ID == id {
+			return link, true
+		}
+	}
+
+	return NetworkLink{}, false
+}
+
+// ResolveNetwork returns the ID of the network of the node interface of a service on a host, and whether it was
+// found. See SIPClusterService.NodeInterfaceSelector for the order in which the network is resolved.
+func (nd *NetworkData) ResolveNetwork(bmh metal3.BareMetalHost, svc airshipv1.SIPClusterService) (string, bool) {
+	if id, exists := bmh.GetLabels()[NetworkIDLabelPrefix+svc.NodeInterface]; exists {
+		return id, nd.hasNetwork(id)
+	}
+
+	if selector := svc.NodeInterfaceSelector; selector != nil {
+		for _, network := range nd.Networks {
+			if nd.matches(network, *selector) {
+				return network.ID, true
+			}
+		}
+		return "", false
+	}
+
+	return svc.NodeInterface, nd.hasNetwork(svc.NodeInterface)
+}
+
+func (nd *NetworkData) hasNetwork(id string) bool {
+	for _, network := range nd.Networks {
+		if network.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (nd *NetworkData) matches(network Network, selector airshipv1.NodeInterfaceSelector) bool {
+	if selector.NetworkType != "" && network.Type != selector.NetworkType {
+		return false
+	}
+
+	link, exists := nd.Link(network.Link)
+	if selector.LinkName != "" {
+		name := link.Name
+		if name == "" {
+			name = network.Link
+		}
+		if name != selector.LinkName {
+			return false
+		}
+	}
+	if selector.VLANID != nil && (!exists || link.VLANID != *selector.VLANID) {
+		return false
+	}
+
+	return true
+}
+
+// addNetwork adds a network to a link for an address of an nmstate or netplan interface. Its ID is the link ID and
+// the network type, suffixed with an index for the second and later networks of the same type on the link.
+func (nd *NetworkData) addNetwork(link, networkType string, address Address) {
+	id := link + "-" + networkType
+	for i := 1; nd.hasNetwork(id); i++ {
+		id = fmt.Sprintf("%s-%s-%d", link, networkType, i)
+	}
+
+	nd.Networks = append(nd.Networks, Network{
+		ID:        id,
+		Type:      networkType,
+		Link:      link,
+		IPAddress: address.IP,
+		Netmask:   address.Netmask,
+	})
+}
+
+// addRoute adds a route of an nmstate or netplan interface to the first network of the family of its gateway on the
+// link. Routes of links without such a network are dropped, as they do not apply to any address of the host.
+func (nd *NetworkData) addRoute(link string, destination *net.IPNet, gateway net.IP) {
+	networkType := "ipv6"
+	if gateway.To4() != nil {
+		networkType = "ipv4"
+	}
+
+	for i := range nd.Networks {
+		network := &nd.Networks[i]
+		if network.Link == link && strings.HasPrefix(network.Type, networkType) {
+			ones, _ := destination.Mask.Size()
+			network.Routes = append(network.Routes, NetworkRoute{
+				Network: destination.IP.String(),
+				Netmask: strconv.Itoa(ones),
+				Gateway: gateway.String(),
+			})
+			return
+		}
+	}
+}
+
+// parseRoute parses the destination and gateway of a route of an nmstate or netplan interface. The destination is
+// in CIDR notation, or "default" for the default route of the family of the gateway.
+func parseRoute(destinationField, destination, gatewayField, gateway string) (*net.IPNet, net.IP, error) {
+	gatewayIP := net.ParseIP(gateway)
+	if gatewayIP == nil {
+		return nil, nil, malformedIP(gatewayField, gateway)
+	}
+
+	if destination == "default" {
+		destination = "::/0"
+		if gatewayIP.To4() != nil {
+			destination = "0.0.0.0/0"
+		}
+	}
+	_, destinationNet, err := net.ParseCIDR(destination)
+	if err != nil {
+		return nil, nil, ErrMalformedNetworkData{
+			Field:  destinationField,
+			Reason: fmt.Sprintf("%q is not a valid CIDR", destination),
+		}
+	}
+
+	return destinationNet, gatewayIP, nil
+}
@@ -0,0 +1,188 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vbmh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nmstateConfig is the subset of an nmstate desired state that describes the links, addresses, routes and DNS
+// servers of a host.
+type nmstateConfig struct {
+	Interfaces []nmstateInterface `json:"interfaces"`
+	Routes     struct {
+		Config []nmstateRoute `json:"config,omitempty"`
+	} `json:"routes,omitempty"`
+	DNSResolver struct {
+		Config struct {
+			Server []string `json:"server,omitempty"`
+		} `json:"config,omitempty"`
+	} `json:"dns-resolver,omitempty"`
+}
+
+type nmstateInterface struct {
+	Name            string                  `json:"name"`
+	Type            string                  `json:"type,omitempty"`
+	MTU             int                     `json:"mtu,omitempty"`
+	MACAddress      string                  `json:"mac-address,omitempty"`
+	IPv4            nmstateIP               `json:"ipv4,omitempty"`
+	IPv6            nmstateIP               `json:"ipv6,omitempty"`
+	VLAN            *nmstateVLAN            `json:"vlan,omitempty"`
+	LinkAggregation *nmstateLinkAggregation `json:"link-aggregation,omitempty"`
+}
+
+type nmstateIP struct {
+	Enabled bool               `json:"enabled,omitempty"`
+	DHCP    bool               `json:"dhcp,omitempty"`
+	Address []nmstateIPAddress `json:"address,omitempty"`
+}
+
+type nmstateIPAddress struct {
+	IP           string `json:"ip"`
+	PrefixLength int    `json:"prefix-length"`
+}
+
+type nmstateVLAN struct {
+	BaseIface string `json:"base-iface"`
+	ID        int    `json:"id"`
+}
+
+type nmstateLinkAggregation struct {
+	Port []string `json:"port,omitempty"`
+	// Slaves are the ports of the bond in nmstate releases prior to 1.0.
+	Slaves []string `json:"slaves,omitempty"`
+}
+
+type nmstateRoute struct {
+	Destination      string `json:"destination"`
+	NextHopAddress   string `json:"next-hop-address"`
+	NextHopInterface string `json:"next-hop-interface"`
+}
+
+// nmstateLinkTypes maps nmstate interface types to network_data.json link types. Other types are kept as is.
+var nmstateLinkTypes = map[string]string{
+	"ethernet":     "phy",
+	"linux-bridge": "bridge",
+	"ovs-bridge":   "bridge",
+}
+
+// parseNMState converts an nmstate desired state to Network Data.
+func parseNMState(data []byte) (*NetworkData, error) {
+	config := &nmstateConfig{}
+	if err := unmarshalNetworkData(data, config); err != nil {
+		return nil, err
+	}
+
+	interfaces := map[string]bool{}
+	for _, iface := range config.Interfaces {
+		interfaces[iface.Name] = true
+	}
+
+	networkData := &NetworkData{}
+	for i, iface := range config.Interfaces {
+		field := fmt.Sprintf("interfaces[%d]", i)
+		if iface.Name == "" {
+			return nil, ErrMalformedNetworkData{Field: field + ".name", Reason: "must not be empty"}
+		}
+
+		link := NetworkLink{
+			ID:                 iface.Name,
+			Name:               iface.Name,
+			Type:               iface.Type,
+			MTU:                iface.MTU,
+			EthernetMACAddress: iface.MACAddress,
+		}
+		if linkType, exists := nmstateLinkTypes[iface.Type]; exists {
+			link.Type = linkType
+		}
+		if iface.VLAN != nil {
+			if !interfaces[iface.VLAN.BaseIface] {
+				return nil, unknownInterface(field+".vlan.base-iface", iface.VLAN.BaseIface)
+			}
+			link.VLANID = iface.VLAN.ID
+			link.VLANLink = iface.VLAN.BaseIface
+		}
+		if iface.LinkAggregation != nil {
+			ports, portsField := iface.LinkAggregation.Port, field+".link-aggregation.port"
+			if len(ports) == 0 {
+				ports, portsField = iface.LinkAggregation.Slaves, field+".link-aggregation.slaves"
+			}
+			for j, port := range ports {
+				if !interfaces[port] {
+					return nil, unknownInterface(fmt.Sprintf("%s[%d]", portsField, j), port)
+				}
+			}
+			link.BondLinks = ports
+		}
+		networkData.Links = append(networkData.Links, link)
+
+		for _, ip := range []struct {
+			field       string
+			networkType string
+			family      corev1.IPFamily
+			config      nmstateIP
+		}{
+			{field + ".ipv4", "ipv4", corev1.IPv4Protocol, iface.IPv4},
+			{field + ".ipv6", "ipv6", corev1.IPv6Protocol, iface.IPv6},
+		} {
+			if !ip.config.Enabled {
+				continue
+			}
+			if ip.config.DHCP {
+				networkData.addNetwork(iface.Name, ip.networkType+"_dhcp", Address{})
+			}
+			for j, nmstateAddress := range ip.config.Address {
+				address, ok := newAddress(nmstateAddress.IP, strconv.Itoa(nmstateAddress.PrefixLength), iface.Name)
+				if !ok || address.Family != ip.family {
+					return nil, ErrMalformedNetworkData{
+						Field:  fmt.Sprintf("%s.address[%d].ip", ip.field, j),
+						Reason: fmt.Sprintf("%q is not a valid %s address", nmstateAddress.IP, ip.networkType),
+					}
+				}
+				networkData.addNetwork(iface.Name, ip.networkType, address)
+			}
+		}
+	}
+
+	for i, route := range config.Routes.Config {
+		field := fmt.Sprintf("routes.config[%d]", i)
+		if !interfaces[route.NextHopInterface] {
+			return nil, unknownInterface(field+".next-hop-interface", route.NextHopInterface)
+		}
+		destination, gateway, err := parseRoute(field+".destination", route.Destination,
+			field+".next-hop-address", route.NextHopAddress)
+		if err != nil {
+			return nil, err
+		}
+		networkData.addRoute(route.NextHopInterface, destination, gateway)
+	}
+
+	for i, server := range config.DNSResolver.Config.Server {
+		if net.ParseIP(server) == nil {
+			return nil, malformedIP(fmt.Sprintf("dns-resolver.config.server[%d]", i), server)
+		}
+		networkData.Services = append(networkData.Services, NetworkService{Type: "dns", Address: server})
+	}
+
+	return networkData, nil
+}
+
+func unknownInterface(field, name string) error {
+	return ErrMalformedNetworkData{Field: field, Reason: fmt.Sprintf("references unknown interface %q", name)}
+}
@@ -4,6 +4,7 @@ import (
 	metal3 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -126,14 +127,16 @@ var _ = Describe("MachineList", func() {
 
 		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
 		sipCluster.Spec.Services = airshipv1.SIPClusterServices{
-			LoadBalancer: []airshipv1.SIPClusterService{
+			LoadBalancer: []airshipv1.LoadBalancerService{
 				{
-					Image: "haproxy:latest",
-					NodeLabels: map[string]string{
-						"test": "true",
+					SIPClusterService: airshipv1.SIPClusterService{
+						Image: "haproxy:latest",
+						NodeLabels: map[string]string{
+							"test": "true",
+						},
+						NodePort:      30000,
+						NodeInterface: "oam-ipv4",
 					},
-					NodePort:      30000,
-					NodeInterface: "oam-ipv4",
 				},
 			},
 		}
@@ -143,6 +146,145 @@ var _ = Describe("MachineList", func() {
 		Expect(ml.Machines[bmh.Name].Data.IPOnInterface).To(Equal(map[string]string{"oam-ipv4": "32.68.51.139"}))
 	})
 
+	It("Should retrieve the BMH addresses of each family from the BMH's NetworkData secret", func() {
+		bmh, networkData := testutil.CreateBMH(1, "default", airshipv1.VMControlPlane, 6)
+		m, err := NewMachine(*bmh, airshipv1.VMControlPlane, NotScheduled)
+		Expect(err).To(BeNil())
+
+		ml := &MachineList{
+			Machines:              map[string]*Machine{bmh.Name: m},
+			ReadyForScheduleCount: map[airshipv1.VMRole]int{},
+			Log:                   ctrl.Log.WithName("controllers").WithName("SIPCluster"),
+		}
+
+		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
+		sipCluster.Spec.Services = airshipv1.SIPClusterServices{
+			LoadBalancer: []airshipv1.LoadBalancerService{
+				{
+					SIPClusterService: airshipv1.SIPClusterService{
+						NodeInterface: "oam-ipv4",
+						IPFamily:      airshipv1.IPFamilyDualStack,
+					},
+				},
+			},
+		}
+		k8sClient := mockClient.NewFakeClient(bmh, networkData)
+		Expect(ml.ExtrapolateServiceAddresses(*sipCluster, k8sClient)).To(BeNil())
+
+		data := ml.Machines[bmh.Name].Data
+		Expect(data.Addresses).To(HaveLen(8))
+		Expect(data.Addresses["oam-ipv4"]).To(Equal([]Address{
+			{IP: "32.68.51.139", Family: corev1.IPv4Protocol, Netmask: "255.255.255.128", Link: "bond0.41"},
+		}))
+		Expect(data.IPs("oam-ipv4", "")).To(Equal([]string{"32.68.51.139"}))
+		Expect(data.IPs("oam-ipv4", airshipv1.IPFamilyIPv6)).To(Equal([]string{"2001:1890:1001:293d::139"}))
+		Expect(data.IPs("oam-ipv4", airshipv1.IPFamilyDualStack)).To(Equal([]string{
+			"32.68.51.139",
+			"2001:1890:1001:293d::139",
+		}))
+	})
+
+	It("Should resolve the network of infra services by BMH label, link name, VLAN ID and network type", func() {
+		bmh, networkData := testutil.CreateBMH(1, "default", airshipv1.VMControlPlane, 6)
+		bmh.Labels[NetworkIDLabelPrefix+"pxe"] = "pxe-ipv4"
+		m, err := NewMachine(*bmh, airshipv1.VMControlPlane, NotScheduled)
+		Expect(err).To(BeNil())
+
+		ml := &MachineList{
+			Machines:              map[string]*Machine{bmh.Name: m},
+			ReadyForScheduleCount: map[airshipv1.VMRole]int{},
+			Log:                   ctrl.Log.WithName("controllers").WithName("SIPCluster"),
+		}
+
+		vlanID := 42
+		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
+		sipCluster.Spec.Services = airshipv1.SIPClusterServices{
+			LoadBalancer: []airshipv1.LoadBalancerService{
+				{
+					SIPClusterService: airshipv1.SIPClusterService{
+						NodeInterface: "oam",
+						NodeInterfaceSelector: &airshipv1.NodeInterfaceSelector{
+							LinkName:    "bond0.41",
+							NetworkType: "ipv4",
+						},
+					},
+				},
+			},
+			JumpHost: []airshipv1.JumpHostService{
+				{
+					SIPClusterService: airshipv1.SIPClusterService{
+						NodeInterface: "storage",
+						NodeInterfaceSelector: &airshipv1.NodeInterfaceSelector{
+							VLANID:      &vlanID,
+							NetworkType: "ipv6",
+						},
+					},
+				},
+			},
+			Custom: []airshipv1.CustomService{
+				{
+					SIPClusterService: airshipv1.SIPClusterService{NodeInterface: "pxe"},
+					Type:              "dns",
+				},
+			},
+		}
+		k8sClient := mockClient.NewFakeClient(bmh, networkData)
+		Expect(ml.ExtrapolateServiceAddresses(*sipCluster, k8sClient)).To(BeNil())
+
+		data := ml.Machines[bmh.Name].Data
+		Expect(data.IPOnInterface).To(Equal(map[string]string{
+			"oam":     "32.68.51.139",
+			"storage": "fd00:900:100:139::15",
+			"pxe":     "172.30.0.11",
+		}))
+		Expect(data.IPs("storage", airshipv1.IPFamilyDualStack)).To(Equal([]string{
+			"fd00:900:100:139::15",
+			"172.31.1.15",
+		}))
+
+		By("Not scheduling a BMH without a network matching the selector")
+		vlanID = 99
+		m, err = NewMachine(*bmh, airshipv1.VMControlPlane, NotScheduled)
+		Expect(err).To(BeNil())
+		ml.Machines[bmh.Name] = m
+		Expect(ml.ExtrapolateServiceAddresses(*sipCluster, k8sClient)).ToNot(BeNil())
+		Expect(m.ScheduleStatus).To(Equal(UnableToSchedule))
+	})
+
+	It("Should not schedule a BMH without addresses of the family required by an infra service", func() {
+		bmh, networkData := testutil.CreateBMH(1, "default", airshipv1.VMControlPlane, 6)
+		networkData.Data["networkData"] = []byte(`{
+			"links": [{"id": "bond0.41", "type": "vlan"}],
+			"networks": [{"id": "oam-ipv4", "link": "bond0.41", "type": "ipv4", "ip_address": "32.68.51.139/25"}]
+		}`)
+		m, err := NewMachine(*bmh, airshipv1.VMControlPlane, NotScheduled)
+		Expect(err).To(BeNil())
+
+		ml := &MachineList{
+			Machines:              map[string]*Machine{bmh.Name: m},
+			ReadyForScheduleCount: map[airshipv1.VMRole]int{},
+			Log:                   ctrl.Log.WithName("controllers").WithName("SIPCluster"),
+		}
+
+		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
+		sipCluster.Spec.Services = airshipv1.SIPClusterServices{
+			JumpHost: []airshipv1.JumpHostService{
+				{
+					SIPClusterService: airshipv1.SIPClusterService{
+						NodeInterface: "oam-ipv4",
+						IPFamily:      airshipv1.IPFamilyDualStack,
+					},
+				},
+			},
+		}
+		k8sClient := mockClient.NewFakeClient(bmh, networkData)
+		Expect(ml.ExtrapolateServiceAddresses(*sipCluster, k8sClient)).ToNot(BeNil())
+		Expect(m.ScheduleStatus).To(Equal(UnableToSchedule))
+		Expect(m.Data.Addresses["oam-ipv4"]).To(Equal([]Address{
+			{IP: "32.68.51.139", Family: corev1.IPv4Protocol, Netmask: "25", Link: "bond0.41"},
+		}))
+	})
+
 	It("Should not retrieve the BMH IP from the BMH's NetworkData secret if no infraServices are defined", func() {
 		// Create a BMH with a NetworkData secret
 		bmh, networkData := testutil.CreateBMH(1, "default", airshipv1.VMControlPlane, 6)
@@ -176,14 +318,16 @@ var _ = Describe("MachineList", func() {
 
 		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
 		sipCluster.Spec.Services = airshipv1.SIPClusterServices{
-			LoadBalancer: []airshipv1.SIPClusterService{
+			LoadBalancer: []airshipv1.LoadBalancerService{
 				{
-					Image: "haproxy:latest",
-					NodeLabels: map[string]string{
-						"test": "true",
+					SIPClusterService: airshipv1.SIPClusterService{
+						Image: "haproxy:latest",
+						NodeLabels: map[string]string{
+							"test": "true",
+						},
+						NodePort:      30000,
+						NodeInterface: "oam-ipv4",
 					},
-					NodePort:      30000,
-					NodeInterface: "oam-ipv4",
 				},
 			},
 		}
@@ -224,14 +368,16 @@ var _ = Describe("MachineList", func() {
 
 		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
 		sipCluster.Spec.Services = airshipv1.SIPClusterServices{
-			LoadBalancer: []airshipv1.SIPClusterService{
+			LoadBalancer: []airshipv1.LoadBalancerService{
 				{
-					Image: "haproxy:latest",
-					NodeLabels: map[string]string{
-						"test": "true",
+					SIPClusterService: airshipv1.SIPClusterService{
+						Image: "haproxy:latest",
+						NodeLabels: map[string]string{
+							"test": "true",
+						},
+						NodePort:      30000,
+						NodeInterface: "oam-ipv4",
 					},
-					NodePort:      30000,
-					NodeInterface: "oam-ipv4",
 				},
 			},
 		}
@@ -276,14 +422,16 @@ var _ = Describe("MachineList", func() {
 
 		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
 		sipCluster.Spec.Services = airshipv1.SIPClusterServices{
-			LoadBalancer: []airshipv1.SIPClusterService{
+			LoadBalancer: []airshipv1.LoadBalancerService{
 				{
-					Image: "haproxy:latest",
-					NodeLabels: map[string]string{
-						"test": "true",
+					SIPClusterService: airshipv1.SIPClusterService{
+						Image: "haproxy:latest",
+						NodeLabels: map[string]string{
+							"test": "true",
+						},
+						NodePort:      30000,
+						NodeInterface: "oam-ipv4",
 					},
-					NodePort:      30000,
-					NodeInterface: "oam-ipv4",
 				},
 			},
 		}
@@ -322,14 +470,16 @@ var _ = Describe("MachineList", func() {
 
 		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
 		sipCluster.Spec.Services = airshipv1.SIPClusterServices{
-			LoadBalancer: []airshipv1.SIPClusterService{
+			LoadBalancer: []airshipv1.LoadBalancerService{
 				{
-					Image: "haproxy:latest",
-					NodeLabels: map[string]string{
-						"test": "true",
+					SIPClusterService: airshipv1.SIPClusterService{
+						Image: "haproxy:latest",
+						NodeLabels: map[string]string{
+							"test": "true",
+						},
+						NodePort:      30000,
+						NodeInterface: "oam-ipv4",
 					},
-					NodePort:      30000,
-					NodeInterface: "oam-ipv4",
 				},
 			},
 		}
@@ -367,14 +517,16 @@ var _ = Describe("MachineList", func() {
 
 		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
 		sipCluster.Spec.Services = airshipv1.SIPClusterServices{
-			LoadBalancer: []airshipv1.SIPClusterService{
+			LoadBalancer: []airshipv1.LoadBalancerService{
 				{
-					Image: "haproxy:latest",
-					NodeLabels: map[string]string{
-						"test": "true",
+					SIPClusterService: airshipv1.SIPClusterService{
+						Image: "haproxy:latest",
+						NodeLabels: map[string]string{
+							"test": "true",
+						},
+						NodePort:      30000,
+						NodeInterface: "oam-ipv4",
 					},
-					NodePort:      30000,
-					NodeInterface: "oam-ipv4",
 				},
 			},
 		}
@@ -382,6 +534,253 @@ var _ = Describe("MachineList", func() {
 		Expect(ml.ExtrapolateServiceAddresses(*sipCluster, k8sClient)).ToNot(BeNil())
 	})
 
+	It("Should name the BMH and field of invalid Network Data", func() {
+		bmh, networkData := testutil.CreateBMH(1, "default", airshipv1.VMControlPlane, 6)
+		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
+
+		for data, expected := range map[string]ErrMalformedNetworkData{
+			`{"links": [{"id": "bond0", "bond_links": ["eno1"]}]}`: {
+				Field:  "links[0].bond_links[0]",
+				Reason: `references unknown link "eno1"`,
+			},
+			`{"links": [{"id": "eno1"}], "networks": [{"id": "oam", "link": "eno2"}]}`: {
+				Field:  "networks[0].link",
+				Reason: `references unknown link "eno2"`,
+			},
+			`{"links": [{"id": "eno1"}], "networks": [{"id": "oam", "link": "eno1", "ip_address": "32.68.51"}]}`: {
+				Field:  "networks[0].ip_address",
+				Reason: `"32.68.51" is not a valid IP address`,
+			},
+			`{"links": [{"id": "eno1"}], "networks": [{"id": "oam", "link": "eno1", "type": "ipv6",
+				"ip_address": "32.68.51.139"}]}`: {
+				Field:  "networks[0].ip_address",
+				Reason: `"32.68.51.139" is not an address of network type ipv6`,
+			},
+			`{"links": [{"id": "eno1"}], "networks": [{"id": "oam", "link": "eno1",
+				"routes": [{"network": "0.0.0.0", "netmask": "0.0.0.0", "gateway": "gw"}]}]}`: {
+				Field:  "networks[0].routes[0].gateway",
+				Reason: `"gw" is not a valid IP address`,
+			},
+			`{"services": [{"type": "dns", "address": "dns.example.com"}]}`: {
+				Field:  "services[0].address",
+				Reason: `"dns.example.com" is not a valid IP address`,
+			},
+			`{"links": [{"id": "eno1"}, {"id": "eno1"}]}`: {
+				Field:  "links[1].id",
+				Reason: `duplicates link "eno1"`,
+			},
+		} {
+			networkData.Data = map[string][]byte{"networkData": []byte(data)}
+			m, err := NewMachine(*bmh, airshipv1.VMControlPlane, NotScheduled)
+			Expect(err).To(BeNil())
+
+			ml := &MachineList{
+				Machines:              map[string]*Machine{bmh.Name: m},
+				ReadyForScheduleCount: map[airshipv1.VMRole]int{},
+				Log:                   ctrl.Log.WithName("controllers").WithName("SIPCluster"),
+			}
+			k8sClient := mockClient.NewFakeClient(bmh, networkData)
+
+			expected.BMH = bmh.Name
+			Expect(ml.ExtrapolateServiceAddresses(*sipCluster, k8sClient)).To(MatchError(expected))
+			Expect(m.ScheduleStatus).To(Equal(UnableToSchedule))
+		}
+	})
+
+	It("Should retrieve the BMH IPs from nmstate and netplan Network Data in configured secret keys", func() {
+		bmh, networkData := testutil.CreateBMH(1, "default", airshipv1.VMControlPlane, 6)
+		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
+		sipCluster.Spec.Services = airshipv1.SIPClusterServices{
+			LoadBalancer: []airshipv1.LoadBalancerService{
+				{
+					SIPClusterService: airshipv1.SIPClusterService{
+						NodeInterface:         "oam",
+						NodeInterfaceSelector: &airshipv1.NodeInterfaceSelector{LinkName: "bond0.41"},
+						IPFamily:              airshipv1.IPFamilyDualStack,
+					},
+				},
+			},
+		}
+
+		for key, data := range map[string]string{
+			"nmstate.yaml": `
+interfaces:
+- name: eno1
+  type: ethernet
+- name: eno2
+  type: ethernet
+- name: bond0
+  type: bond
+  link-aggregation:
+    mode: 802.3ad
+    port: [eno1, eno2]
+- name: bond0.41
+  type: vlan
+  vlan:
+    base-iface: bond0
+    id: 41
+  ipv4:
+    enabled: true
+    address:
+    - ip: 32.68.51.139
+      prefix-length: 25
+  ipv6:
+    enabled: true
+    address:
+    - ip: 2001:1890:1001:293d::139
+      prefix-length: 64
+routes:
+  config:
+  - destination: 0.0.0.0/0
+    next-hop-address: 32.68.51.129
+    next-hop-interface: bond0.41
+dns-resolver:
+  config:
+    server: [135.188.34.124]
+`,
+			"netplan.yaml": `
+network:
+  version: 2
+  ethernets:
+    eno1: {}
+    eno2: {}
+  bonds:
+    bond0:
+      interfaces: [eno1, eno2]
+  vlans:
+    bond0.41:
+      id: 41
+      link: bond0
+      addresses: [32.68.51.139/25, "2001:1890:1001:293d::139/64"]
+      gateway4: 32.68.51.129
+      nameservers:
+        addresses: [135.188.34.124]
+`,
+		} {
+			networkData.Data = map[string][]byte{key: []byte(data)}
+			m, err := NewMachine(*bmh, airshipv1.VMControlPlane, NotScheduled)
+			Expect(err).To(BeNil())
+
+			ml := &MachineList{
+				Machines:              map[string]*Machine{bmh.Name: m},
+				ReadyForScheduleCount: map[airshipv1.VMRole]int{},
+				Log:                   ctrl.Log.WithName("controllers").WithName("SIPCluster"),
+				NetworkDataKeys:       []string{"nmstate.yaml", "netplan.yaml"},
+			}
+			k8sClient := mockClient.NewFakeClient(bmh, networkData)
+			Expect(ml.ExtrapolateServiceAddresses(*sipCluster, k8sClient)).To(BeNil())
+
+			Expect(m.Data.NetworkIDs).To(Equal(map[string]string{"oam": "bond0.41-ipv4"}))
+			Expect(m.Data.IPs("oam", airshipv1.IPFamilyDualStack)).To(Equal([]string{
+				"32.68.51.139",
+				"2001:1890:1001:293d::139",
+			}))
+			Expect(m.Data.Addresses["bond0.41-ipv4"]).To(Equal([]Address{
+				{IP: "32.68.51.139", Family: corev1.IPv4Protocol, Netmask: "25", Link: "bond0.41"},
+			}))
+
+			By("Excluding hosts whose network is not selected by a derived network ID")
+			unselected := sipCluster.DeepCopy()
+			unselected.Spec.Services.LoadBalancer[0].NodeInterfaceSelector = nil
+			unselected.Spec.Services.LoadBalancer[0].IPFamily = ""
+			m, err = NewMachine(*bmh, airshipv1.VMControlPlane, NotScheduled)
+			Expect(err).To(BeNil())
+			ml.Machines = map[string]*Machine{bmh.Name: m}
+			format := NetworkDataFormatNMState
+			if key == "netplan.yaml" {
+				format = NetworkDataFormatNetplan
+			}
+			Expect(ml.ExtrapolateServiceAddresses(*unselected, k8sClient)).To(MatchError(ErrNetworkNotResolved{
+				BMH:           bmh.Name,
+				NodeInterface: "oam",
+				Format:        format,
+			}))
+			Expect(m.ScheduleStatus).To(Equal(UnableToSchedule))
+		}
+	})
+
+	It("Should parse nmstate and netplan Network Data into network_data.json", func() {
+		networkData, err := ParseNetworkData([]byte(`
+ethernets:
+  eno1:
+    match:
+      macaddress: "52:54:00:00:00:01"
+    dhcp4: true
+    addresses: [172.30.0.11/25]
+    routes:
+    - to: 10.0.0.0/8
+      via: 172.30.0.1
+`))
+		Expect(err).To(BeNil())
+		Expect(networkData).To(Equal(&NetworkData{
+			Links: []NetworkLink{{ID: "eno1", Name: "eno1", Type: "phy", EthernetMACAddress: "52:54:00:00:00:01"}},
+			Networks: []Network{
+				{
+					ID:   "eno1-ipv4_dhcp",
+					Type: "ipv4_dhcp",
+					Link: "eno1",
+					Routes: []NetworkRoute{
+						{Network: "10.0.0.0", Netmask: "8", Gateway: "172.30.0.1"},
+					},
+				},
+				{ID: "eno1-ipv4", Type: "ipv4", Link: "eno1", IPAddress: "172.30.0.11", Netmask: "25"},
+			},
+			Format: NetworkDataFormatNetplan,
+		}))
+
+		_, err = ParseNetworkData([]byte(`
+interfaces:
+- name: eno1
+  type: ethernet
+  ipv6:
+    enabled: true
+    address:
+    - ip: 172.30.0.11
+      prefix-length: 25
+`))
+		Expect(err).To(MatchError(ErrMalformedNetworkData{
+			Field:  "interfaces[0].ipv6.address[0].ip",
+			Reason: `"172.30.0.11" is not a valid ipv6 address`,
+		}))
+
+		_, err = ParseNetworkData([]byte(`
+vlans:
+  bond0.41:
+    id: 41
+    link: bond0
+`))
+		Expect(err).To(MatchError(ErrMalformedNetworkData{
+			Field:  "vlans.bond0.41.link",
+			Reason: `references unknown device "bond0"`,
+		}))
+
+		_, err = ParseNetworkData([]byte("hosts: [node01]"))
+		Expect(err).To(MatchError(ErrMalformedNetworkData{
+			Reason: "is neither in the network_data.json, nmstate nor netplan format",
+		}))
+	})
+
+	It("Should not process a BMH whose Network Data secret has none of the Network Data keys", func() {
+		bmh, networkData := testutil.CreateBMH(1, "default", airshipv1.VMControlPlane, 6)
+		m, err := NewMachine(*bmh, airshipv1.VMControlPlane, NotScheduled)
+		Expect(err).To(BeNil())
+
+		ml := &MachineList{
+			Machines:              map[string]*Machine{bmh.Name: m},
+			ReadyForScheduleCount: map[airshipv1.VMRole]int{},
+			Log:                   ctrl.Log.WithName("controllers").WithName("SIPCluster"),
+			NetworkDataKeys:       []string{"network_data.json"},
+		}
+		sipCluster := testutil.CreateSIPCluster("subcluster-1", "default", 1, 3)
+		k8sClient := mockClient.NewFakeClient(bmh, networkData)
+		Expect(ml.ExtrapolateServiceAddresses(*sipCluster, k8sClient)).To(MatchError(ErrNetworkDataKeyNotFound{
+			BMH:        bmh.Name,
+			SecretName: networkData.Name,
+			Keys:       []string{"network_data.json"},
+		}.Error()))
+		Expect(m.ScheduleStatus).To(Equal(UnableToSchedule))
+	})
+
 	It("Should not retrieve the BMH IP if it has been previously extrapolated", func() {
 		// Store an IP address for each machine
 		var objs []runtime.Object
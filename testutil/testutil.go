@@ -238,10 +238,12 @@ func CreateSIPCluster(name string, namespace string, controlPlanes int, workers
 				},
 			},
 			Services: airshipv1.SIPClusterServices{
-				LoadBalancer: []airshipv1.SIPClusterService{
+				LoadBalancer: []airshipv1.LoadBalancerService{
 					{
-						NodeInterface: "eno3",
-						NodePort:      30000,
+						SIPClusterService: airshipv1.SIPClusterService{
+							NodeInterface: "eno3",
+							NodePort:      30000,
+						},
 					},
 				},
 				JumpHost: []airshipv1.JumpHostService{